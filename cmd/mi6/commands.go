@@ -0,0 +1,512 @@
+package main
+
+import (
+	"archive/zip"
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"mi6/internal/bundle"
+	"mi6/internal/config"
+	"mi6/internal/db"
+	"mi6/internal/importer"
+	"mi6/internal/postman"
+)
+
+// commands are mi6's subcommands, keyed by their first one or two words.
+// Without a subcommand, mi6 runs the server.
+var commands = map[string]func(args []string) error{
+	"import openapi":  importOpenAPI,
+	"import har":      importHAR,
+	"import postman":  importPostman,
+	"import wiremock": importWireMock,
+	"import mockoon":  importMockoon,
+	"import bundle":   importBundle,
+	"export postman":  exportPostman,
+	"export bundle":   exportBundle,
+	"apply":           apply,
+	"diff":            diff,
+}
+
+// runCommand runs the subcommand named by args, e.g. "import openapi spec.yaml".
+func runCommand(args []string) error {
+	if cmd, ok := commands[args[0]]; ok {
+		return cmd(args[1:])
+	}
+	if len(args) >= 2 {
+		if cmd, ok := commands[args[0]+" "+args[1]]; ok {
+			return cmd(args[2:])
+		}
+	}
+	return fmt.Errorf("unknown command %q; available commands: %s", args, commandNames())
+}
+
+func commandNames() string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// openRepository opens the agents database, creating its tables if needed.
+func openRepository(path string) (*db.SQLiteRepository, func(), error) {
+	conn, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := db.RunMigrations(conn); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return db.NewSQLiteRepository(conn), func() { conn.Close() }, nil
+}
+
+// importOpenAPI implements "mi6 import openapi [flags] <spec>".
+func importOpenAPI(args []string) error {
+	fs := flag.NewFlagSet("import openapi", flag.ExitOnError)
+	name := fs.String("name", "", "agent name (default: the API's title)")
+	port := fs.String("port", "", "port the agent listens on (required)")
+	database := fs.String("db", dbPath, "path to the agents database")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: mi6 import openapi -port <port> [-name <name>] <spec.yaml|spec.json>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || *port == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	spec, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	repo, closeDB, err := openRepository(*database)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	result, err := importer.OpenAPI(context.Background(), repo, &db.Agent{Name: *name, Port: *port}, spec)
+	if err != nil {
+		return err
+	}
+	printResult(result)
+	return nil
+}
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string     { return strings.Join(*l, ",") }
+func (l *stringList) Set(v string) error { *l = append(*l, v); return nil }
+
+// importHAR implements "mi6 import har [flags] <file.har>".
+func importHAR(args []string) error {
+	fs := flag.NewFlagSet("import har", flag.ExitOnError)
+	name := fs.String("name", "", "name of the agent to create")
+	port := fs.String("port", "", "port of the agent to create")
+	agentID := fs.Int("agent", 0, "add the paths to this existing agent instead of creating one")
+	duplicates := fs.String("duplicates", importer.DuplicatesFirst, "repeated requests: keep the first, the last, or all as a sequence")
+	database := fs.String("db", dbPath, "path to the agents database")
+	var hosts, mimeTypes stringList
+	fs.Var(&hosts, "host", "only import requests to this host (repeatable)")
+	fs.Var(&mimeTypes, "mime", "only import responses of this MIME type, e.g. application/json or image/* (repeatable)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: mi6 import har (-name <name> -port <port> | -agent <id>) [flags] <file.har>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || (*agentID == 0 && (*name == "" || *port == "")) {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	repo, closeDB, err := openRepository(*database)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	opts := importer.HAROptions{Hosts: hosts, MimeTypes: mimeTypes, Duplicates: *duplicates}
+	var result *importer.Result
+	if *agentID != 0 {
+		result, err = importer.HARInto(context.Background(), repo, *agentID, data, opts)
+	} else {
+		result, err = importer.HAR(context.Background(), repo, &db.Agent{Name: *name, Port: *port}, data, opts)
+	}
+	if err != nil {
+		return err
+	}
+	printResult(result)
+	return nil
+}
+
+// importPostman implements "mi6 import postman [flags] <collection.json>".
+func importPostman(args []string) error {
+	fs := flag.NewFlagSet("import postman", flag.ExitOnError)
+	name := fs.String("name", "", "agent name (default: the collection's name)")
+	port := fs.String("port", "", "port of the agent to create")
+	agentID := fs.Int("agent", 0, "add the paths to this existing agent instead of creating one")
+	envFile := fs.String("env", "", "Postman environment to resolve variables from")
+	database := fs.String("db", dbPath, "path to the agents database")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: mi6 import postman (-port <port> [-name <name>] | -agent <id>) [-env <environment.json>] <collection.json>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || (*agentID == 0 && *port == "") {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	collection, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	var environment []byte
+	if *envFile != "" {
+		if environment, err = os.ReadFile(*envFile); err != nil {
+			return err
+		}
+	}
+	repo, closeDB, err := openRepository(*database)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	var result *importer.Result
+	if *agentID != 0 {
+		result, err = importer.PostmanInto(context.Background(), repo, *agentID, collection, environment)
+	} else {
+		result, err = importer.Postman(context.Background(), repo, &db.Agent{Name: *name, Port: *port}, collection, environment)
+	}
+	if err != nil {
+		return err
+	}
+	printResult(result)
+	return nil
+}
+
+// exportPostman implements "mi6 export postman -agent <id> [-o <file>]".
+func exportPostman(args []string) error {
+	fs := flag.NewFlagSet("export postman", flag.ExitOnError)
+	agentID := fs.Int("agent", 0, "agent to export (required)")
+	out := fs.String("o", "", "file to write the collection to (default: standard output)")
+	database := fs.String("db", dbPath, "path to the agents database")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: mi6 export postman -agent <id> [-o <collection.json>]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 || *agentID == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	repo, closeDB, err := openRepository(*database)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	ctx := context.Background()
+	a, err := repo.GetAgentByID(ctx, *agentID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("agent %d not found", *agentID)
+	} else if err != nil {
+		return err
+	}
+	paths, err := repo.GetAgentPaths(ctx, a.Id)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(postman.Export(a, paths), "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if *out == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(*out, data, 0o644)
+}
+
+// importWireMock implements "mi6 import wiremock [flags] <root|archive.zip|mappings.json>".
+func importWireMock(args []string) error {
+	fs := flag.NewFlagSet("import wiremock", flag.ExitOnError)
+	name := fs.String("name", "", "agent name (required)")
+	port := fs.String("port", "", "port the agent listens on (required)")
+	database := fs.String("db", dbPath, "path to the agents database")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: mi6 import wiremock -name <name> -port <port> <root directory|archive.zip|mappings.json>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || *name == "" || *port == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	source := fs.Arg(0)
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+	repo, closeDB, err := openRepository(*database)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	ctx, a := context.Background(), &db.Agent{Name: *name, Port: *port}
+	var result *importer.Result
+	switch {
+	case info.IsDir():
+		result, err = importer.WireMock(ctx, repo, a, os.DirFS(source))
+	case strings.EqualFold(filepath.Ext(source), ".zip"):
+		var archive *zip.ReadCloser
+		if archive, err = zip.OpenReader(source); err != nil {
+			return err
+		}
+		defer archive.Close()
+		result, err = importer.WireMock(ctx, repo, a, archive)
+	default:
+		var data []byte
+		if data, err = os.ReadFile(source); err != nil {
+			return err
+		}
+		result, err = importer.WireMockStubs(ctx, repo, a, data)
+	}
+	if err != nil {
+		return err
+	}
+	printResult(result)
+	return nil
+}
+
+// importMockoon implements "mi6 import mockoon [flags] <environment.json>".
+// Body files are looked up next to the environment file.
+func importMockoon(args []string) error {
+	fs := flag.NewFlagSet("import mockoon", flag.ExitOnError)
+	name := fs.String("name", "", "agent name (default: the environment's)")
+	port := fs.String("port", "", "port the agent listens on (default: the environment's)")
+	database := fs.String("db", dbPath, "path to the agents database")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: mi6 import mockoon [-name <name>] [-port <port>] <environment.json>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	repo, closeDB, err := openRepository(*database)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	files := os.DirFS(filepath.Dir(fs.Arg(0)))
+	result, err := importer.Mockoon(context.Background(), repo, &db.Agent{Name: *name, Port: *port}, data, files)
+	if err != nil {
+		return err
+	}
+	printResult(result)
+	return nil
+}
+
+// apply implements "mi6 apply -f <file|dir> [-prune]".
+func apply(args []string) error {
+	return reconcile("apply", args, false)
+}
+
+// diff implements "mi6 diff -f <file|dir> [-prune]", which shows what apply would change.
+func diff(args []string) error {
+	return reconcile("diff", args, true)
+}
+
+func reconcile(name string, args []string, dryRun bool) error {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	var files stringList
+	fs.Var(&files, "f", "YAML or JSON document, or a directory of them (repeatable)")
+	prune := fs.Bool("prune", false, "delete agents the documents do not declare")
+	database := fs.String("db", dbPath, "path to the agents database")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: mi6 %s -f <mocks.yaml|dir> [-f ...] [-prune]\n", name)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 || len(files) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	doc, err := config.Load(files...)
+	if err != nil {
+		return err
+	}
+	repo, closeDB, err := openRepository(*database)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	ctx := context.Background()
+	plan, err := config.Diff(ctx, repo, doc, config.Options{Prune: *prune})
+	if err != nil {
+		return err
+	}
+	if plan.Empty() {
+		fmt.Println("No changes.")
+		return nil
+	}
+	fmt.Print(plan)
+	if dryRun {
+		return nil
+	}
+	if err := plan.Apply(ctx, repo); err != nil {
+		return err
+	}
+	fmt.Printf("Applied %d changes.\n", len(plan.Changes))
+	return nil
+}
+
+// printResult summarizes an import.
+func printResult(result *importer.Result) {
+	fmt.Printf("Agent %d (%s) on port %s: %d paths imported\n", result.AgentID, result.Name, result.Port, len(result.Paths))
+	for _, p := range result.Paths {
+		fmt.Printf("  %-7s %s -> %d\n", p.Method, p.Path, p.StatusCode)
+	}
+	for _, key := range result.Skipped {
+		fmt.Printf("  skipped %s\n", key)
+	}
+	for _, problem := range result.Unsupported {
+		fmt.Printf("  unsupported: %s\n", problem)
+	}
+}
+
+// exportBundle implements "mi6 export bundle [-agent <id> ...] -o <file>".
+func exportBundle(args []string) error {
+	fs := flag.NewFlagSet("export bundle", flag.ExitOnError)
+	var agents stringList
+	fs.Var(&agents, "agent", "agent to export (repeatable; default: all)")
+	out := fs.String("o", "", "file to write the bundle to (required)")
+	database := fs.String("db", dbPath, "path to the agents database")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: mi6 export bundle [-agent <id> ...] -o <bundle.zip>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 || *out == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	var opts bundle.ExportOptions
+	for _, s := range agents {
+		id, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("invalid agent ID %q", s)
+		}
+		opts.AgentIDs = append(opts.AgentIDs, id)
+	}
+
+	repo, closeDB, err := openRepository(*database)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	m, err := bundle.Export(context.Background(), repo, repo, f, opts)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(*out)
+		return err
+	}
+	fmt.Printf("Exported %d agents to %s\n", len(m.Agents), *out)
+	return nil
+}
+
+// importBundle implements "mi6 import bundle [-conflict <policy>] <file>".
+func importBundle(args []string) error {
+	fs := flag.NewFlagSet("import bundle", flag.ExitOnError)
+	conflict := fs.String("conflict", bundle.ConflictSkip, "what to do with agents whose name or port is taken: skip, overwrite, rename or reassign-port")
+	database := fs.String("db", dbPath, "path to the agents database")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: mi6 import bundle [-conflict <policy>] <bundle.zip>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	opts := bundle.ImportOptions{Conflict: *conflict}
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	m, err := bundle.Read(f, info.Size())
+	if err != nil {
+		return err
+	}
+
+	repo, closeDB, err := openRepository(*database)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	result, err := bundle.Import(context.Background(), repo, repo, m, opts)
+	if result != nil {
+		for _, o := range result.Agents {
+			switch {
+			case o.Action == bundle.Skipped:
+				fmt.Printf("  skipped %s (%s)\n", o.Name, o.Reason)
+			case o.BundleName != "" || o.BundlePort != "":
+				fmt.Printf("  %s %s on port %s (bundled as %s on port %s)\n", o.Action, o.Name, o.Port,
+					cmp.Or(o.BundleName, o.Name), cmp.Or(o.BundlePort, o.Port))
+			default:
+				fmt.Printf("  %s %s on port %s\n", o.Action, o.Name, o.Port)
+			}
+		}
+	}
+	return err
+}
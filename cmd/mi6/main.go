@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -15,6 +16,7 @@ import (
 
 	"mi6/internal/agent"
 	"mi6/internal/api"
+	"mi6/internal/config"
 	"mi6/internal/db"
 )
 
@@ -26,8 +28,26 @@ func must(err error) {
 	}
 }
 
+// reportSchemaVersion logs the database's schema version.
+func reportSchemaVersion(conn *sql.DB) {
+	version, err := db.SchemaVersion(conn)
+	must(err)
+	log.Printf("database schema is at version %d", version)
+}
+
 func main() {
+	// Subcommands, such as "mi6 import openapi", run instead of the server.
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		must(runCommand(os.Args[1:]))
+		return
+	}
+
 	port := flag.String("port", "6969", "port to run the main MI6 server on")
+	journalSize := flag.Int("journal-size", agent.DefaultJournalSize, "number of received requests kept in memory per agent")
+	journalPersist := flag.Bool("journal-persist", false, "also persist received requests to the SQLite database")
+	watchDir := flag.String("watch", "", "directory of agent documents to apply, and re-apply whenever they change")
+	migrateOnly := flag.Bool("migrate-only", false, "apply pending database migrations, then exit")
+	migrateDown := flag.Int("migrate-down", 0, "roll back this many database migrations, then exit")
 	flag.Parse()
 
 	// 1. Initialize DB and Repository
@@ -35,17 +55,44 @@ func main() {
 	must(err)
 	defer dbConn.Close()
 
-	// Run migrations (ensure tables exist)
+	// Run migrations (bring the schema up to date)
+	if *migrateDown > 0 {
+		must(db.Rollback(dbConn, *migrateDown))
+		reportSchemaVersion(dbConn)
+		return
+	}
 	must(db.RunMigrations(dbConn))
+	if *migrateOnly {
+		reportSchemaVersion(dbConn)
+		return
+	}
 
 	// Instantiate the concrete repository implementation
 	repo := db.NewSQLiteRepository(dbConn)
 
 	// 2. Initialize Agent Registry
 	mgr := agent.NewRegistry(repo)
+	mgr.JournalSize = *journalSize
+	mgr.SpecStore = repo
+	if *journalPersist {
+		mgr.JournalStore = repo
+	}
+
+	// Keep the agents in sync with a directory of documents, if asked to
+	var watcher *config.Watcher
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	defer stopWatching()
+	if *watchDir != "" {
+		watcher = config.NewWatcher(*watchDir, mgr.Repo)
+		go func() {
+			if err := watcher.Run(watchCtx); err != nil {
+				log.Fatalf("MI6 watch failed: %v", err)
+			}
+		}()
+	}
 
 	// 3. Setup Router and Handlers
-	r := api.NewRouter(mgr)
+	r := api.NewRouter(mgr, watcher)
 
 	// 4. Start Main Server
 	srv := &http.Server{
@@ -2,9 +2,12 @@ module mi6
 
 go 1.25.1
 
-require github.com/mattn/go-sqlite3 v1.14.32
-
 require (
-	github.com/a-h/templ v0.3.943 // indirect
-	github.com/go-chi/chi/v5 v5.2.3 // indirect
+	github.com/a-h/templ v0.3.943
+	github.com/fsnotify/fsnotify v1.9.0
+	github.com/go-chi/chi/v5 v5.2.3
+	github.com/mattn/go-sqlite3 v1.14.32
+	gopkg.in/yaml.v3 v3.0.1
 )
+
+require golang.org/x/sys v0.34.0 // indirect
@@ -1,9 +1,17 @@
+-- The schema the migrations in internal/db/migrations build, for reference.
+-- MI6 applies those on startup; change the schema by adding a migration there.
+
 -- Agents Table: Holds configuration for each mock server (the Agent)
 CREATE TABLE IF NOT EXISTS agents (
     id INTEGER PRIMARY KEY AUTOINCREMENT, -- Use AUTOINCREMENT for easy creation
     name TEXT NOT NULL UNIQUE,          -- Agent names should be unique
     port TEXT NOT NULL UNIQUE,          -- Ports must be unique to avoid collisions
-    status TEXT NOT NULL DEFAULT 'stopped' -- Default status is helpful
+    status TEXT NOT NULL DEFAULT 'stopped', -- Default status is helpful
+    delay TEXT NOT NULL DEFAULT 'null',     -- JSON delay applied to paths without their own
+    throttle TEXT NOT NULL DEFAULT 'null',  -- JSON throttle applied to paths without their own
+    upstream_url TEXT NOT NULL DEFAULT '',  -- Requests no path matches are forwarded here
+    strip_prefix TEXT NOT NULL DEFAULT '',  -- Removed from the request path before forwarding
+    proxy_headers TEXT NOT NULL DEFAULT 'null' -- JSON headers set on forwarded requests
 );
 
 -- Agent Paths Table: Holds the mock endpoints and their responses for an Agent
@@ -11,11 +19,59 @@ CREATE TABLE IF NOT EXISTS agent_paths (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     agent_id INTEGER NOT NULL,      -- CRITICAL: Foreign Key linking to the agents table
     path TEXT NOT NULL,
+    path_group TEXT NOT NULL DEFAULT '',      -- Folder the path is filed under, e.g. 'Users/Admin'
+    method TEXT NOT NULL DEFAULT 'GET', -- HTTP method, or 'ANY' to match every method
     response TEXT NOT NULL,
+    status_code INTEGER NOT NULL DEFAULT 200, -- HTTP status returned with the response
+    headers TEXT NOT NULL DEFAULT '{}',       -- JSON object of response headers
+    templated INTEGER NOT NULL DEFAULT 0,     -- 1 when response is a Go text/template
+    encoding TEXT NOT NULL DEFAULT '',        -- 'base64' when response holds an encoded binary body
+    variants TEXT NOT NULL DEFAULT '[]',      -- JSON array of conditional response variants
+    scenario TEXT NOT NULL DEFAULT '',        -- Scenario state machine the path takes part in
+    required_state TEXT NOT NULL DEFAULT '',  -- Only respond while the scenario is in this state
+    new_state TEXT NOT NULL DEFAULT '',       -- Move the scenario to this state after responding
+    sequence TEXT NOT NULL DEFAULT '[]',      -- JSON array of responses served on successive calls
+    sequence_mode TEXT NOT NULL DEFAULT '',   -- 'cycle', 'stick' or 'fail' once the sequence is exhausted
+    delay TEXT NOT NULL DEFAULT 'null',       -- JSON delay before responding; overrides the agent's
+    fault TEXT NOT NULL DEFAULT 'null',       -- JSON network fault served instead of the response
+    throttle TEXT NOT NULL DEFAULT 'null',    -- JSON bandwidth limit for the response body; overrides the agent's
 
-    -- Constraint: An agent cannot have the same path defined twice
-    UNIQUE (agent_id, path),
+    -- Constraint: An agent cannot define the same method on a path twice
+    UNIQUE (agent_id, path, method),
 
     -- Define the Foreign Key relationship
     FOREIGN KEY (agent_id) REFERENCES agents(id) ON DELETE CASCADE
 );
+
+-- Request Journal Table: Optional persistent log of requests received by Agents
+CREATE TABLE IF NOT EXISTS request_journal (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    agent_id INTEGER NOT NULL,
+    path_id INTEGER NOT NULL DEFAULT 0,  -- Matched agent_paths.id, 0 when nothing matched
+    method TEXT NOT NULL,
+    url TEXT NOT NULL,
+    headers TEXT NOT NULL DEFAULT '{}',  -- JSON object of request headers
+    body TEXT NOT NULL DEFAULT '',
+    status INTEGER NOT NULL,             -- Status code the Agent responded with, 0 when a fault broke the connection
+    fault TEXT NOT NULL DEFAULT '',      -- Type of the fault served instead of a response, if any
+    received_at TIMESTAMP NOT NULL,
+    violations TEXT NOT NULL DEFAULT 'null', -- JSON list of OpenAPI spec violations
+
+    FOREIGN KEY (agent_id) REFERENCES agents(id) ON DELETE CASCADE
+);
+
+-- Agent Specs Table: OpenAPI documents that incoming requests to an Agent are validated against
+CREATE TABLE IF NOT EXISTS agent_specs (
+    agent_id INTEGER PRIMARY KEY,
+    document TEXT NOT NULL,                  -- The specification, as uploaded (JSON or YAML)
+    mode TEXT NOT NULL DEFAULT 'enforce',    -- 'enforce' rejects violations, 'log' only journals them
+
+    FOREIGN KEY (agent_id) REFERENCES agents(id) ON DELETE CASCADE
+);
+
+-- Schema Migrations Table: The migrations applied to this database
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INTEGER PRIMARY KEY,        -- Number the migration file starts with
+    name TEXT NOT NULL,
+    applied_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,73 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"mi6/internal/db"
+)
+
+// ValidateDelay checks that a delay names a known distribution with sensible parameters.
+func ValidateDelay(d *db.Delay) error {
+	if d == nil {
+		return nil
+	}
+	if d.FixedMs < 0 || d.MinMs < 0 || d.MaxMs < 0 || d.MeanMs < 0 || d.StddevMs < 0 || d.MedianMs < 0 || d.Sigma < 0 {
+		return fmt.Errorf("delay parameters must not be negative")
+	}
+
+	switch d.Distribution {
+	case "", db.DelayFixed, db.DelayNormal, db.DelayLogNormal:
+	case db.DelayUniform:
+		if d.MaxMs < d.MinMs {
+			return fmt.Errorf("delay max_ms %d is less than min_ms %d", d.MaxMs, d.MinMs)
+		}
+	default:
+		return fmt.Errorf("unknown delay distribution %q", d.Distribution)
+	}
+	return nil
+}
+
+// sampleDelay draws how long to wait before answering. Draws below zero,
+// possible with a normal distribution, are clamped to no delay.
+func sampleDelay(d *db.Delay) time.Duration {
+	var ms float64
+	switch d.Distribution {
+	case db.DelayUniform:
+		ms = float64(d.MinMs) + rand.Float64()*float64(d.MaxMs-d.MinMs)
+	case db.DelayNormal:
+		ms = float64(d.MeanMs) + rand.NormFloat64()*float64(d.StddevMs)
+	case db.DelayLogNormal:
+		ms = float64(d.MedianMs) * math.Exp(rand.NormFloat64()*d.Sigma)
+	default:
+		ms = float64(d.FixedMs)
+	}
+	if ms <= 0 {
+		return 0
+	}
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+// wait sleeps for a delay drawn from d. It gives up early, returning false,
+// when ctx is done, i.e. when the client has disconnected.
+func wait(ctx context.Context, d *db.Delay) bool {
+	if d == nil {
+		return true
+	}
+	duration := sampleDelay(d)
+	if duration == 0 {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,93 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"mi6/internal/db"
+)
+
+func TestValidateDelay(t *testing.T) {
+	tests := []struct {
+		name    string
+		delay   *db.Delay
+		wantErr string // Empty when the delay is valid
+	}{
+		{"none", nil, ""},
+		{"fixed by default", &db.Delay{FixedMs: 100}, ""},
+		{"uniform", &db.Delay{Distribution: db.DelayUniform, MinMs: 10, MaxMs: 20}, ""},
+		{"uniform of one value", &db.Delay{Distribution: db.DelayUniform, MinMs: 10, MaxMs: 10}, ""},
+		{"normal without spread", &db.Delay{Distribution: db.DelayNormal, MeanMs: 50}, ""},
+		{"lognormal", &db.Delay{Distribution: db.DelayLogNormal, MedianMs: 50, Sigma: 0.5}, ""},
+		{"negative", &db.Delay{FixedMs: -1}, "must not be negative"},
+		{"negative sigma", &db.Delay{Distribution: db.DelayLogNormal, MedianMs: 50, Sigma: -0.5}, "must not be negative"},
+		{"min above max", &db.Delay{Distribution: db.DelayUniform, MinMs: 20, MaxMs: 10}, "max_ms 10 is less than min_ms 20"},
+		{"unknown distribution", &db.Delay{Distribution: "poisson"}, `unknown delay distribution "poisson"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateDelay(tt.delay)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSampleDelayBounds(t *testing.T) {
+	ms := time.Millisecond
+	tests := []struct {
+		name     string
+		delay    db.Delay
+		min, max time.Duration
+	}{
+		{"fixed", db.Delay{Distribution: db.DelayFixed, FixedMs: 40}, 40 * ms, 40 * ms},
+		{"uniform", db.Delay{Distribution: db.DelayUniform, MinMs: 10, MaxMs: 20}, 10 * ms, 20 * ms},
+		{"normal without spread", db.Delay{Distribution: db.DelayNormal, MeanMs: 50}, 50 * ms, 50 * ms},
+		{"normal clamped at zero", db.Delay{Distribution: db.DelayNormal, MeanMs: 1, StddevMs: 100}, 0, time.Second},
+		{"lognormal", db.Delay{Distribution: db.DelayLogNormal, MedianMs: 50, Sigma: 0.25}, ms, 500 * ms},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 1000; i++ {
+				if d := sampleDelay(&tt.delay); d < tt.min || d > tt.max {
+					t.Fatalf("sampled %v, want between %v and %v", d, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestWait(t *testing.T) {
+	if !wait(context.Background(), nil) {
+		t.Error("expected no delay to return at once")
+	}
+
+	start := time.Now()
+	if !wait(context.Background(), &db.Delay{FixedMs: 20}) {
+		t.Error("expected a completed wait to return true")
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("waited %v, want at least 20ms", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	start = time.Now()
+	if wait(ctx, &db.Delay{FixedMs: 10_000}) {
+		t.Error("expected a cancelled wait to return false")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("waited %v after the client left", elapsed)
+	}
+
+	// A client already gone is noticed even without a delay to sleep
+	if wait(ctx, &db.Delay{FixedMs: 0}) {
+		t.Error("expected a cancelled context to return false")
+	}
+}
@@ -0,0 +1,83 @@
+package agent
+
+import (
+	"bufio"
+	cryptorand "crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net"
+	"net/http"
+
+	"mi6/internal/db"
+)
+
+// ValidateFault checks that a fault has a known type and a probability between 0 and 1.
+func ValidateFault(f *db.Fault) error {
+	if f == nil {
+		return nil
+	}
+	switch f.Type {
+	case db.FaultEmptyResponse, db.FaultRandomData, db.FaultConnectionReset, db.FaultMalformedChunk:
+	default:
+		return fmt.Errorf("unknown fault type %q", f.Type)
+	}
+	if p := f.Probability; p != nil && (*p < 0 || *p > 1) {
+		return fmt.Errorf("fault probability %v is not between 0 and 1", *p)
+	}
+	return nil
+}
+
+// faultFires decides whether a request is answered with the fault.
+func faultFires(f *db.Fault) bool {
+	if f == nil {
+		return false
+	}
+	return f.Probability == nil || rand.Float64() < *f.Probability
+}
+
+// injectFault takes over the client connection and breaks it the way the
+// fault describes. The status, headers and body are those the response
+// would otherwise have had; only a malformed chunk uses them.
+func injectFault(w http.ResponseWriter, r *http.Request, f *db.Fault, statusCode int, body []byte) {
+	header := w.Header().Clone()
+	conn, buf, err := http.NewResponseController(w).Hijack()
+	if errors.Is(err, http.ErrNotSupported) {
+		http.Error(w, "mi6: faults need an HTTP/1.x connection", http.StatusInternalServerError)
+		return
+	}
+	if err != nil {
+		log.Printf("Fault %s could not take over the connection: %v", f.Type, err)
+		return
+	}
+	defer conn.Close()
+	noteFault(r, f.Type)
+
+	switch f.Type {
+	case db.FaultConnectionReset:
+		// Closing with a zero linger makes the kernel send RST instead of FIN.
+		if tcp, ok := conn.(*net.TCPConn); ok {
+			tcp.SetLinger(0)
+		}
+	case db.FaultRandomData:
+		garbage := make([]byte, 1024)
+		cryptorand.Read(garbage)
+		buf.Write(garbage)
+		buf.Flush()
+	case db.FaultMalformedChunk:
+		writeMalformedChunk(buf.Writer, statusCode, header, body)
+	}
+}
+
+// writeMalformedChunk starts a chunked response whose first chunk announces
+// more bytes than it carries, and never terminates the body.
+func writeMalformedChunk(w *bufio.Writer, statusCode int, header http.Header, body []byte) {
+	header.Del("Content-Length")
+	header.Set("Transfer-Encoding", "chunked")
+	fmt.Fprintf(w, "HTTP/1.1 %d %s\r\n", statusCode, http.StatusText(statusCode))
+	header.Write(w)
+	fmt.Fprintf(w, "\r\n%x\r\n", len(body)+16)
+	w.Write(body[:len(body)/2])
+	w.Flush()
+}
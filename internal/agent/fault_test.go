@@ -0,0 +1,79 @@
+package agent
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"mi6/internal/db"
+)
+
+func float64Ptr(f float64) *float64 { return &f }
+
+func TestFaultProbability(t *testing.T) {
+	tests := []struct {
+		name        string
+		probability *float64
+		wantFires   int // Out of 100 requests; -1 when anything in between goes
+	}{
+		{"unset fails every request", nil, 100},
+		{"one fails every request", float64Ptr(1), 100},
+		{"zero never fails", float64Ptr(0), 0},
+		{"a half fails some", float64Ptr(0.5), -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &db.Fault{Type: db.FaultEmptyResponse, Probability: tt.probability}
+			if err := ValidateFault(f); err != nil {
+				t.Fatal(err)
+			}
+			fires := 0
+			for i := 0; i < 100; i++ {
+				if faultFires(f) {
+					fires++
+				}
+			}
+			if tt.wantFires >= 0 && fires != tt.wantFires {
+				t.Errorf("fault fired %d times out of 100, want %d", fires, tt.wantFires)
+			}
+		})
+	}
+}
+
+func TestValidateFaultRejectsOutOfRangeProbability(t *testing.T) {
+	for _, p := range []float64{-0.1, 1.5} {
+		if err := ValidateFault(&db.Fault{Type: db.FaultEmptyResponse, Probability: &p}); err == nil {
+			t.Errorf("probability %v accepted", p)
+		}
+	}
+}
+
+func TestFaultIsJournaled(t *testing.T) {
+	registry := NewRegistry(nil)
+	fault := &db.Fault{Type: db.FaultEmptyResponse}
+	handler := registry.recordRequests(1)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		injectFault(w, r, fault, http.StatusOK, nil)
+	}))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	if resp, err := http.Get(server.URL + "/orders"); err == nil {
+		resp.Body.Close()
+		t.Fatal("the faulted request got a response")
+	}
+
+	// The handler finishes journaling after the client has seen the connection drop.
+	deadline := time.Now().Add(2 * time.Second)
+	var entries []db.RequestEntry
+	for len(entries) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		entries = registry.journal(1).List(db.RequestFilter{})
+	}
+	if len(entries) != 1 {
+		t.Fatalf("journal holds %d entries, want 1", len(entries))
+	}
+	if e := entries[0]; e.Status != 0 || e.Fault != db.FaultEmptyResponse {
+		t.Errorf("journaled status %d and fault %q, want 0 and %q", e.Status, e.Fault, db.FaultEmptyResponse)
+	}
+}
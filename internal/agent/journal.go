@@ -0,0 +1,195 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"mi6/internal/db"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// DefaultJournalSize is the number of requests kept in memory per agent.
+const DefaultJournalSize = 1000
+
+// maxJournalBody caps how much of a request body is captured into the journal.
+const maxJournalBody = 64 << 10
+
+// maxJournalBytes caps the request data an agent's journal holds in memory.
+// The oldest entries are evicted to stay under it, even before the ring is full.
+const maxJournalBytes = 16 << 20
+
+// Journal is a bounded, in-memory ring of the requests an agent received.
+type Journal struct {
+	mu      sync.Mutex
+	entries []db.RequestEntry // Oldest first
+	size    int               // Maximum number of entries
+	bytes   int               // Total entrySize of the entries
+	lastID  int64
+}
+
+// NewJournal creates a journal holding at most size entries.
+func NewJournal(size int) *Journal {
+	if size <= 0 {
+		size = DefaultJournalSize
+	}
+	return &Journal{size: size}
+}
+
+// Add appends an entry, evicting the oldest ones when the ring is full or
+// holds more than maxJournalBytes.
+func (j *Journal) Add(e db.RequestEntry) db.RequestEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.lastID++
+	e.Id = j.lastID
+	j.entries = append(j.entries, e)
+	j.bytes += entrySize(e)
+	for len(j.entries) > j.size || (j.bytes > maxJournalBytes && len(j.entries) > 1) {
+		j.bytes -= entrySize(j.entries[0])
+		j.entries[0] = db.RequestEntry{} // Release the evicted body
+		j.entries = j.entries[1:]
+	}
+	return e
+}
+
+// entrySize approximates the memory an entry's request data takes.
+func entrySize(e db.RequestEntry) int {
+	n := len(e.Method) + len(e.URL) + len(e.Body)
+	for name, values := range e.Headers {
+		n += len(name)
+		for _, v := range values {
+			n += len(v)
+		}
+	}
+	return n
+}
+
+// List returns the matching entries in the order they were received.
+func (j *Journal) List(filter db.RequestFilter) []db.RequestEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var matched []db.RequestEntry
+	for _, e := range j.entries {
+		if filter.Matches(e) {
+			matched = append(matched, e)
+		}
+	}
+	if filter.Limit > 0 && len(matched) > filter.Limit {
+		matched = matched[len(matched)-filter.Limit:]
+	}
+	return matched
+}
+
+// Clear drops every entry.
+func (j *Journal) Clear() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.entries, j.bytes = nil, 0
+}
+
+type journalContextKey struct{}
+
+// markMatched records on the in-flight journal entry which mock path served the request.
+func markMatched(r *http.Request, pathID int) {
+	if e, ok := r.Context().Value(journalContextKey{}).(*db.RequestEntry); ok {
+		e.PathID = pathID
+	}
+}
+
+// noteFault records on the in-flight journal entry that the connection was
+// broken by a fault rather than answered.
+func noteFault(r *http.Request, faultType string) {
+	if e, ok := r.Context().Value(journalContextKey{}).(*db.RequestEntry); ok {
+		e.Fault = faultType
+	}
+}
+
+// noteViolations records on the in-flight journal entry how the request broke the agent's spec.
+func noteViolations(r *http.Request, violations []string) {
+	if e, ok := r.Context().Value(journalContextKey{}).(*db.RequestEntry); ok {
+		e.Violations = violations
+	}
+}
+
+// journal returns the agent's journal, creating it on first use.
+func (r *Registry) journal(agentID int) *Journal {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	j, ok := r.journals[agentID]
+	if !ok {
+		j = NewJournal(r.JournalSize)
+		r.journals[agentID] = j
+	}
+	return j
+}
+
+// recordRequests returns middleware that journals every request the agent receives.
+func (r *Registry) recordRequests(agentID int) func(http.Handler) http.Handler {
+	journal := r.journal(agentID)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			entry := &db.RequestEntry{
+				AgentID:    agentID,
+				Method:     req.Method,
+				URL:        req.URL.RequestURI(),
+				Headers:    req.Header.Clone(),
+				ReceivedAt: time.Now(),
+			}
+
+			// Capture the body, then hand an identical copy on to the mock handler.
+			if req.Body != nil {
+				body, _ := io.ReadAll(io.LimitReader(req.Body, maxJournalBody))
+				entry.Body = string(body)
+				req.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), req.Body))
+			}
+
+			ww := middleware.NewWrapResponseWriter(w, req.ProtoMajor)
+			ctx := context.WithValue(req.Context(), journalContextKey{}, entry)
+			next.ServeHTTP(ww, req.WithContext(ctx))
+
+			entry.Status = ww.Status()
+			switch {
+			case entry.Status != 0 || entry.Fault != "":
+			case req.Context().Err() != nil:
+				entry.Status = db.StatusClientClosedRequest // The client left before anything was written
+			default:
+				entry.Status = http.StatusOK // Nothing written counts as an implicit 200
+			}
+
+			*entry = journal.Add(*entry)
+			if r.JournalStore != nil {
+				if err := r.JournalStore.AppendRequest(context.Background(), entry); err != nil {
+					log.Printf("Agent %d journal persistence failed: %v", agentID, err)
+				}
+			}
+		})
+	}
+}
+
+// Requests lists the requests an agent has received. Persisted history is
+// preferred when a JournalStore is configured; otherwise the in-memory ring is used.
+func (r *Registry) Requests(ctx context.Context, agentID int, filter db.RequestFilter) ([]db.RequestEntry, error) {
+	if r.JournalStore != nil {
+		return r.JournalStore.ListRequests(ctx, agentID, filter)
+	}
+	return r.journal(agentID).List(filter), nil
+}
+
+// ClearRequests empties an agent's journal, including any persisted entries.
+func (r *Registry) ClearRequests(ctx context.Context, agentID int) error {
+	r.journal(agentID).Clear()
+	if r.JournalStore != nil {
+		return r.JournalStore.ClearRequests(ctx, agentID)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"mi6/internal/db"
+)
+
+func TestJournalEvictsOldestEntries(t *testing.T) {
+	j := NewJournal(3)
+	for _, url := range []string{"/1", "/2", "/3", "/4"} {
+		j.Add(db.RequestEntry{URL: url})
+	}
+	entries := j.List(db.RequestFilter{})
+	if len(entries) != 3 || entries[0].URL != "/2" || entries[2].URL != "/4" {
+		t.Fatalf("got %+v, want /2 to /4", entries)
+	}
+	if entries[2].Id != 4 {
+		t.Errorf("got id %d for the fourth entry, want 4", entries[2].Id)
+	}
+
+	j.Clear()
+	if entries := j.List(db.RequestFilter{}); len(entries) != 0 {
+		t.Errorf("got %d entries after clearing, want none", len(entries))
+	}
+}
+
+func TestJournalIsBoundedInBytes(t *testing.T) {
+	j := NewJournal(DefaultJournalSize)
+	body := strings.Repeat("x", maxJournalBody)
+	for range 2 * maxJournalBytes / maxJournalBody {
+		j.Add(db.RequestEntry{Body: body})
+	}
+	entries := j.List(db.RequestFilter{})
+	if len(entries) == 0 || len(entries)*maxJournalBody > maxJournalBytes {
+		t.Errorf("journal holds %d bodies of %d bytes, over the %d byte cap", len(entries), maxJournalBody, maxJournalBytes)
+	}
+	if j.bytes > maxJournalBytes {
+		t.Errorf("journal accounts for %d bytes, over the %d byte cap", j.bytes, maxJournalBytes)
+	}
+}
+
+func TestJournalRecordsClientClosedRequest(t *testing.T) {
+	registry := NewRegistry(nil)
+	handler := registry.recordRequests(1)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			wait(r.Context(), &db.Delay{FixedMs: 10_000})
+		}
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel() // The client is already gone
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/slow", nil).WithContext(ctx))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/silent", nil))
+
+	entries := registry.journal(1).List(db.RequestFilter{})
+	if len(entries) != 2 {
+		t.Fatalf("journal holds %d entries, want 2", len(entries))
+	}
+	if entries[0].Status != db.StatusClientClosedRequest {
+		t.Errorf("abandoned request journaled as %d, want %d", entries[0].Status, db.StatusClientClosedRequest)
+	}
+	if entries[1].Status != http.StatusOK {
+		t.Errorf("silent request journaled as %d, want an implicit 200", entries[1].Status)
+	}
+}
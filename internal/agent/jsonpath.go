@@ -0,0 +1,117 @@
+package agent
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jsonPathStep is one segment of a parsed JSONPath expression.
+type jsonPathStep struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// parseJSONPath parses the JSONPath subset MI6 supports: $, .name, ['name'],
+// [index] (negative counts from the end) and the .* / [*] wildcards.
+func parseJSONPath(expr string) ([]jsonPathStep, error) {
+	s := strings.TrimSpace(expr)
+	s = strings.TrimPrefix(s, "$")
+	if s != "" && s[0] != '.' && s[0] != '[' {
+		s = "." + s // Allow a bare "a.b" as shorthand for "$.a.b"
+	}
+
+	var steps []jsonPathStep
+	for s != "" {
+		switch s[0] {
+		case '.':
+			s = s[1:]
+			if strings.HasPrefix(s, ".") {
+				return nil, fmt.Errorf("jsonpath %q: recursive descent is not supported", expr)
+			}
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			name := s[:end]
+			s = s[end:]
+			if name == "" {
+				return nil, fmt.Errorf("jsonpath %q: empty name", expr)
+			}
+			steps = append(steps, jsonPathStep{key: name, wildcard: name == "*"})
+		case '[':
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("jsonpath %q: unterminated '['", expr)
+			}
+			inner := strings.TrimSpace(s[1:end])
+			s = s[end+1:]
+			switch {
+			case inner == "*":
+				steps = append(steps, jsonPathStep{wildcard: true})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				steps = append(steps, jsonPathStep{key: inner[1 : len(inner)-1]})
+			default:
+				n, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("jsonpath %q: invalid index %q", expr, inner)
+				}
+				steps = append(steps, jsonPathStep{index: n, isIndex: true})
+			}
+		default:
+			return nil, fmt.Errorf("jsonpath %q: unexpected %q", expr, s[0])
+		}
+	}
+	return steps, nil
+}
+
+// evalJSONPath evaluates expr against a document decoded by encoding/json.
+// Expressions containing a wildcard yield a []any of every match.
+func evalJSONPath(doc any, expr string) (any, bool) {
+	steps, err := parseJSONPath(expr)
+	if err != nil {
+		return nil, false
+	}
+
+	nodes := []any{doc}
+	multi := false
+	for _, step := range steps {
+		var next []any
+		for _, node := range nodes {
+			switch v := node.(type) {
+			case map[string]any:
+				if step.wildcard {
+					for _, child := range v {
+						next = append(next, child)
+					}
+				} else if child, ok := v[step.key]; ok && !step.isIndex {
+					next = append(next, child)
+				}
+			case []any:
+				if step.wildcard {
+					next = append(next, v...)
+				} else if step.isIndex {
+					i := step.index
+					if i < 0 {
+						i += len(v)
+					}
+					if i >= 0 && i < len(v) {
+						next = append(next, v[i])
+					}
+				}
+			}
+		}
+		multi = multi || step.wildcard
+		nodes = next
+	}
+
+	if multi {
+		return nodes, len(nodes) > 0
+	}
+	if len(nodes) == 0 {
+		return nil, false
+	}
+	return nodes[0], true
+}
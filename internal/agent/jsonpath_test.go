@@ -0,0 +1,56 @@
+package agent
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestEvalJSONPath(t *testing.T) {
+	var doc any
+	err := json.Unmarshal([]byte(`{
+		"order": {"id": 7, "status": "paid", "lines": [{"sku": "a"}, {"sku": "b"}]},
+		"odd key": true,
+		"tags": ["x", "y", "z"]
+	}`), &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		expr   string
+		want   any
+		wantOK bool
+	}{
+		{"$", doc, true},
+		{"$.order.status", "paid", true},
+		{"order.status", "paid", true},
+		{"$.order.id", float64(7), true},
+		{"$['odd key']", true, true},
+		{`$["order"]["status"]`, "paid", true},
+		{"$.tags[0]", "x", true},
+		{"$.tags[-1]", "z", true},
+		{"$.tags[3]", nil, false},
+		{"$.order.lines[*].sku", []any{"a", "b"}, true},
+		{"$.order.lines.*.sku", []any{"a", "b"}, true},
+		{"$.order.missing", nil, false},
+		{"$.tags.name", nil, false},
+		{"$..sku", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, ok := evalJSONPath(doc, tt.expr)
+			if ok != tt.wantOK || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, %v; want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestParseJSONPathErrors(t *testing.T) {
+	for _, expr := range []string{"$..a", "$.a.", "$[0", "$[x]"} {
+		if _, err := parseJSONPath(expr); err == nil {
+			t.Errorf("parseJSONPath(%q) succeeded, want an error", expr)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"mi6/internal/db"
+)
+
+// requestView is the part of a request that conditions are evaluated against.
+// It can be built from a live request or from a journal entry.
+type requestView struct {
+	query  url.Values
+	header http.Header
+	body   string
+
+	json       any // Body decoded as JSON, on first use by a JSONPath condition
+	jsonParsed bool
+}
+
+// viewOfEntry builds a requestView from a journaled request.
+func viewOfEntry(e db.RequestEntry) *requestView {
+	v := &requestView{header: e.Headers, body: e.Body}
+	if _, rawQuery, ok := strings.Cut(e.URL, "?"); ok {
+		v.query, _ = url.ParseQuery(rawQuery)
+	}
+	return v
+}
+
+// viewOfRequest builds a requestView from a live request, leaving its body readable.
+func viewOfRequest(r *http.Request) *requestView {
+	v := &requestView{query: r.URL.Query(), header: r.Header}
+	if r.Body != nil {
+		body, _ := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		v.body = string(body)
+	}
+	return v
+}
+
+// lookup returns the value a condition inspects and whether it is present.
+func (v *requestView) lookup(c db.Condition) (string, bool) {
+	switch c.Source {
+	case db.SourceQuery:
+		return v.query.Get(c.Key), v.query.Has(c.Key)
+	case db.SourceHeader:
+		values := v.header.Values(c.Key)
+		return strings.Join(values, ","), len(values) > 0
+	}
+
+	if c.Key == "" {
+		return v.body, v.body != ""
+	}
+	if !v.jsonParsed {
+		if json.Unmarshal([]byte(v.body), &v.json) != nil {
+			v.json = nil
+		}
+		v.jsonParsed = true
+	}
+	value, ok := evalJSONPath(v.json, c.Key)
+	if !ok || value == nil {
+		return "", false
+	}
+	if s, isString := value.(string); isString {
+		return s, true
+	}
+	b, _ := json.Marshal(value) // Numbers, booleans and objects compare as JSON
+	return string(b), true
+}
+
+// ValidateCondition checks that a condition names a known source and compiles.
+func ValidateCondition(c db.Condition) error {
+	switch c.Source {
+	case db.SourceQuery, db.SourceHeader:
+		if c.Key == "" {
+			return fmt.Errorf("%s condition requires a key", c.Source)
+		}
+	case db.SourceBody:
+		if c.Key != "" {
+			if _, err := parseJSONPath(c.Key); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unknown condition source %q", c.Source)
+	}
+	if c.Matches != "" {
+		if _, err := compileRegexp(c.Matches); err != nil {
+			return fmt.Errorf("invalid %s condition pattern: %w", c.Source, err)
+		}
+	}
+	return nil
+}
+
+// checkCondition evaluates a condition, returning a description of the failure if any.
+func checkCondition(c db.Condition, v *requestView) (bool, string) {
+	value, present := v.lookup(c)
+	name := c.Source
+	if c.Key != "" {
+		name += " " + c.Key
+	}
+
+	if c.Absent {
+		if present {
+			return false, fmt.Sprintf("%s expected to be absent", name)
+		}
+		return true, ""
+	}
+	if !present {
+		return false, fmt.Sprintf("%s is missing", name)
+	}
+	if c.Equals != nil && value != *c.Equals {
+		return false, fmt.Sprintf("%s is %q, expected %q", name, value, *c.Equals)
+	}
+	if c.Contains != "" && !strings.Contains(value, c.Contains) {
+		return false, fmt.Sprintf("%s does not contain %q", name, c.Contains)
+	}
+	if c.Matches != "" {
+		re, err := compileRegexp(c.Matches)
+		if err != nil || !re.MatchString(value) {
+			return false, fmt.Sprintf("%s does not match %q", name, c.Matches)
+		}
+	}
+	return true, ""
+}
+
+// maxCachedRegexps bounds the regexp cache, which also sees the patterns
+// clients send to /verify.
+const maxCachedRegexps = 1024
+
+// regexps caches compiled condition patterns, which are evaluated on every
+// request. Once full, it starts over.
+var regexps = struct {
+	sync.Mutex
+	m map[string]*regexp.Regexp
+}{m: map[string]*regexp.Regexp{}}
+
+func compileRegexp(pattern string) (*regexp.Regexp, error) {
+	regexps.Lock()
+	re, ok := regexps.m[pattern]
+	regexps.Unlock()
+	if ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	regexps.Lock()
+	if len(regexps.m) >= maxCachedRegexps {
+		clear(regexps.m)
+	}
+	regexps.m[pattern] = re
+	regexps.Unlock()
+	return re, nil
+}
@@ -0,0 +1,150 @@
+package agent
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"mi6/internal/db"
+)
+
+// call sends a request through an agent's router and returns the status and body.
+func call(mux http.Handler, method, target, body string, header http.Header) (int, string) {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	for k, v := range header {
+		r.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, r)
+	return rec.Code, rec.Body.String()
+}
+
+func cond(source, key string, p db.Predicate) db.Condition {
+	return db.Condition{Source: source, Key: key, Predicate: p}
+}
+
+func text(s string) db.MockResponse {
+	return db.MockResponse{StatusCode: http.StatusOK, Response: s}
+}
+
+func TestCheckCondition(t *testing.T) {
+	const order = `{"order": {"id": 7, "paid": true, "items": [{"sku": "A-1"}], "note": null}}`
+	tests := []struct {
+		name      string
+		condition db.Condition
+		target    string
+		header    http.Header
+		body      string
+		want      bool
+		wantWhy   string // Substring of the failure description
+	}{
+		{"query equals", cond(db.SourceQuery, "page", db.Predicate{Equals: strPtr("2")}), "/?page=2", nil, "", true, ""},
+		{"query differs", cond(db.SourceQuery, "page", db.Predicate{Equals: strPtr("2")}), "/?page=3", nil, "", false, `query page is "3", expected "2"`},
+		{"query missing", cond(db.SourceQuery, "page", db.Predicate{Equals: strPtr("")}), "/", nil, "", false, "query page is missing"},
+		{"query empty", cond(db.SourceQuery, "page", db.Predicate{Equals: strPtr("")}), "/?page=", nil, "", true, ""},
+		{"query absent", cond(db.SourceQuery, "debug", db.Predicate{Absent: true}), "/?page=1", nil, "", true, ""},
+		{"query present", cond(db.SourceQuery, "debug", db.Predicate{Absent: true}), "/?debug", nil, "", false, "expected to be absent"},
+		{"header contains", cond(db.SourceHeader, "accept", db.Predicate{Contains: "json"}), "/", http.Header{"Accept": {"application/json"}}, "", true, ""},
+		{"header lacks", cond(db.SourceHeader, "Accept", db.Predicate{Contains: "json"}), "/", http.Header{"Accept": {"text/html"}}, "", false, `does not contain "json"`},
+		{"repeated header", cond(db.SourceHeader, "X-Tag", db.Predicate{Equals: strPtr("a,b")}), "/", http.Header{"X-Tag": {"a", "b"}}, "", true, ""},
+		{"header matches", cond(db.SourceHeader, "Authorization", db.Predicate{Matches: `^Bearer \w+$`}), "/", http.Header{"Authorization": {"Bearer abc"}}, "", true, ""},
+		{"header does not match", cond(db.SourceHeader, "Authorization", db.Predicate{Matches: `^Bearer \w+$`}), "/", http.Header{"Authorization": {"Basic abc"}}, "", false, "does not match"},
+		{"whole body", cond(db.SourceBody, "", db.Predicate{Contains: "A-1"}), "/", nil, order, true, ""},
+		{"empty body", cond(db.SourceBody, "", db.Predicate{Contains: "A-1"}), "/", nil, "", false, "body is missing"},
+		{"JSONPath number", cond(db.SourceBody, "$.order.id", db.Predicate{Equals: strPtr("7")}), "/", nil, order, true, ""},
+		{"JSONPath boolean", cond(db.SourceBody, "$.order.paid", db.Predicate{Equals: strPtr("true")}), "/", nil, order, true, ""},
+		{"JSONPath string in array", cond(db.SourceBody, "$.order.items[0].sku", db.Predicate{Matches: "^A-"}), "/", nil, order, true, ""},
+		{"JSONPath object", cond(db.SourceBody, "$.order.items[0]", db.Predicate{Equals: strPtr(`{"sku":"A-1"}`)}), "/", nil, order, true, ""},
+		{"JSONPath null is absent", cond(db.SourceBody, "$.order.note", db.Predicate{Absent: true}), "/", nil, order, true, ""},
+		{"JSONPath missing", db.Condition{Source: db.SourceBody, Key: "$.order.total"}, "/", nil, order, false, "body $.order.total is missing"},
+		{"JSONPath on invalid JSON", db.Condition{Source: db.SourceBody, Key: "$.order"}, "/", nil, "not json", false, "is missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateCondition(tt.condition); err != nil {
+				t.Fatal(err)
+			}
+			r := httptest.NewRequest("POST", tt.target, strings.NewReader(tt.body))
+			for k, v := range tt.header {
+				r.Header[k] = v
+			}
+			ok, why := checkCondition(tt.condition, viewOfRequest(r))
+			if ok != tt.want || !strings.Contains(why, tt.wantWhy) {
+				t.Errorf("got %v %q, want %v %q", ok, why, tt.want, tt.wantWhy)
+			}
+		})
+	}
+}
+
+func TestValidateCondition(t *testing.T) {
+	tests := []struct {
+		condition db.Condition
+		wantErr   string
+	}{
+		{db.Condition{Source: db.SourceQuery, Key: "q"}, ""},
+		{db.Condition{Source: db.SourceBody}, ""},
+		{db.Condition{Source: db.SourceQuery}, "requires a key"},
+		{db.Condition{Source: db.SourceHeader}, "requires a key"},
+		{db.Condition{Source: "cookie", Key: "session"}, "unknown condition source"},
+		{db.Condition{Source: db.SourceBody, Key: "$[0"}, "$[0"},
+		{cond(db.SourceQuery, "q", db.Predicate{Matches: "("}), "invalid query condition pattern"},
+	}
+	for _, tt := range tests {
+		err := ValidateCondition(tt.condition)
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%+v: unexpected error: %v", tt.condition, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("%+v: got error %v, want one containing %q", tt.condition, err, tt.wantErr)
+		}
+	}
+}
+
+func TestVariantSelection(t *testing.T) {
+	paths := []db.AgentPath{{
+		Id: 1, Method: "POST", Path: "/orders", MockResponse: text("fallback"),
+		Variants: []db.ResponseVariant{
+			// Declared out of order: priorities decide
+			{Name: "any json", Priority: 5, MockResponse: text("json"),
+				Conditions: []db.Condition{cond(db.SourceHeader, "Content-Type", db.Predicate{Contains: "json"})}},
+			{Name: "vip", Priority: 1, MockResponse: text("vip"),
+				Conditions: []db.Condition{cond(db.SourceQuery, "tier", db.Predicate{Equals: strPtr("vip")}), cond(db.SourceBody, "$.total", db.Predicate{Matches: `^\d{4,}$`})}},
+			{Name: "big", Priority: 1, MockResponse: text("big"),
+				Conditions: []db.Condition{cond(db.SourceBody, "$.total", db.Predicate{Matches: `^\d{4,}$`})}},
+		},
+	}}
+	mux, err := buildRouter(paths, newAgentState())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jsonType := http.Header{"Content-Type": {"application/json"}}
+	tests := []struct {
+		name, target, body string
+		header             http.Header
+		want               string
+	}{
+		{"every condition of the first variant", "/orders?tier=vip", `{"total": 1500}`, jsonType, "vip"},
+		{"equal priorities keep their order", "/orders", `{"total": 1500}`, jsonType, "big"},
+		{"a lower priority", "/orders?tier=vip", `{"total": 15}`, jsonType, "json"},
+		{"nothing matches", "/orders?tier=vip", `{"total": 15}`, nil, "fallback"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := call(mux, "POST", tt.target, tt.body, tt.header)
+			if status != http.StatusOK || body != tt.want {
+				t.Errorf("got %d %q, want 200 %q", status, body, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompilePathRejectsInvalidVariants(t *testing.T) {
+	p := db.AgentPath{Method: "GET", Path: "/", Variants: []db.ResponseVariant{
+		{Name: "broken", Conditions: []db.Condition{{Source: db.SourceQuery}}},
+	}}
+	if _, err := compilePath(p, newAgentState()); err == nil || !strings.Contains(err.Error(), "variant broken") {
+		t.Fatalf("got %v, want the invalid variant named", err)
+	}
+}
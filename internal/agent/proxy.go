@@ -0,0 +1,111 @@
+package agent
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+
+	"mi6/internal/db"
+)
+
+// ValidateAgent checks the settings an agent applies on top of its paths:
+// the default delay and throttle, and the upstream to forward to.
+func ValidateAgent(a *db.Agent) error {
+	if err := ValidateDelay(a.Delay); err != nil {
+		return err
+	}
+	if err := ValidateThrottle(a.Throttle); err != nil {
+		return err
+	}
+	if a.UpstreamURL == "" {
+		if a.StripPrefix != "" || len(a.ProxyHeaders) > 0 {
+			return fmt.Errorf("strip_prefix and proxy_headers need an upstream_url")
+		}
+		return nil
+	}
+	if _, err := parseUpstream(a.UpstreamURL); err != nil {
+		return err
+	}
+	if a.StripPrefix != "" && !strings.HasPrefix(a.StripPrefix, "/") {
+		return fmt.Errorf("strip_prefix %q must start with '/'", a.StripPrefix)
+	}
+	return nil
+}
+
+func parseUpstream(raw string) (*url.URL, error) {
+	target, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream_url: %w", err)
+	}
+	if (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, fmt.Errorf("upstream_url %q must be an absolute http(s) URL", raw)
+	}
+	return target, nil
+}
+
+// newUpstreamProxy forwards requests to the agent's upstream, stripping the
+// configured prefix from the path and applying its header rewrites.
+func newUpstreamProxy(a *db.Agent) (*httputil.ReverseProxy, error) {
+	target, err := parseUpstream(a.UpstreamURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			stripPrefix(pr.Out.URL, a.StripPrefix)
+			pr.SetURL(target)
+			pr.SetXForwarded()
+
+			for name, value := range a.ProxyHeaders {
+				if value == "" {
+					pr.Out.Header.Del(name)
+				} else {
+					pr.Out.Header.Set(name, value)
+				}
+			}
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Printf("Agent %d: forwarding %s %s to %s failed: %v", a.Id, r.Method, r.URL.Path, target, err)
+			http.Error(w, fmt.Sprintf("mi6: upstream request failed: %v", err), http.StatusBadGateway)
+		},
+	}, nil
+}
+
+// stripPrefix removes prefix from u's path when the path is the prefix or
+// lies below it, so that "/api" strips "/api/users" but not "/apiary". The
+// escaped form of the path, which keeps e.g. "%2F" apart from "/", is
+// stripped alike.
+func stripPrefix(u *url.URL, prefix string) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" {
+		return
+	}
+	path, ok := cutPathPrefix(u.Path, prefix)
+	if !ok {
+		return
+	}
+	rawPath := ""
+	if u.RawPath != "" {
+		escaped := (&url.URL{Path: prefix}).EscapedPath()
+		if rawPath, ok = cutPathPrefix(u.RawPath, escaped); !ok {
+			rawPath = ""
+		}
+	}
+	u.Path, u.RawPath = path, rawPath
+}
+
+// cutPathPrefix returns what follows prefix in path, if path is prefix or
+// continues with a '/' after it.
+func cutPathPrefix(path, prefix string) (string, bool) {
+	switch {
+	case path == prefix:
+		return "/", true
+	case strings.HasPrefix(path, prefix+"/"):
+		return path[len(prefix):], true
+	}
+	return "", false
+}
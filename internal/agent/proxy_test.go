@@ -0,0 +1,80 @@
+package agent
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"mi6/internal/db"
+)
+
+func TestStripPrefix(t *testing.T) {
+	tests := []struct {
+		prefix, target string
+		wantPath       string
+		wantEscaped    string
+	}{
+		{"/api", "/api/users", "/users", "/users"},
+		{"/api/", "/api/users", "/users", "/users"},
+		{"/api", "/api", "/", "/"},
+		{"/api", "/apiary", "/apiary", "/apiary"},
+		{"/api", "/other/api/users", "/other/api/users", "/other/api/users"},
+		{"/api", "/api/files/a%2Fb", "/files/a/b", "/files/a%2Fb"},
+		{"/a b", "/a%20b/c", "/c", "/c"},
+		{"/", "/api/users", "/api/users", "/api/users"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prefix+" "+tt.target, func(t *testing.T) {
+			u, err := url.Parse(tt.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			stripPrefix(u, tt.prefix)
+			if u.Path != tt.wantPath || u.EscapedPath() != tt.wantEscaped {
+				t.Errorf("got path %q (escaped %q), want %q (%q)", u.Path, u.EscapedPath(), tt.wantPath, tt.wantEscaped)
+			}
+		})
+	}
+}
+
+// pathsRepository serves a fixed set of paths for any agent.
+type pathsRepository struct {
+	db.AgentRepository
+	paths []db.AgentPath
+}
+
+func (r pathsRepository) GetAgentPaths(ctx context.Context, agentID int) ([]db.AgentPath, error) {
+	return r.paths, nil
+}
+
+func TestUpstreamOnlyAgentJournalsForwardedRequests(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "upstream saw "+r.URL.EscapedPath())
+	}))
+	defer upstream.Close()
+
+	registry := NewRegistry(pathsRepository{})
+	agent := &db.Agent{Id: 1, UpstreamURL: upstream.URL, StripPrefix: "/api"}
+	mux, err := registry.buildAgentRouter(context.Background(), agent, &Server{state: newAgentState()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for target, want := range map[string]string{
+		"/api/orders/1":    "upstream saw /orders/1",
+		"/api/files/a%2Fb": "upstream saw /files/a%2Fb",
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+		if body := rec.Body.String(); body != want {
+			t.Errorf("%s: got %q from the upstream, want %q", target, body, want)
+		}
+	}
+	entries := registry.journal(1).List(db.RequestFilter{Path: "/api/orders/1"})
+	if len(entries) != 1 || entries[0].Status != http.StatusOK {
+		t.Errorf("journal holds %+v, want the forwarded request", entries)
+	}
+}
@@ -0,0 +1,282 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"sync"
+	"unicode/utf8"
+
+	"mi6/internal/db"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// maxRecordedBody caps the response bodies record mode captures; larger
+// responses are still passed through to the client, just not recorded.
+const maxRecordedBody = 10 << 20
+
+// unrecordedHeaders are response headers that describe one particular
+// transfer rather than the response, so they are left out of recorded mocks.
+var unrecordedHeaders = []string{"Connection", "Content-Length", "Date", "Keep-Alive", "Transfer-Encoding"}
+
+// Exchange is a request/response pair captured in record mode.
+type Exchange struct {
+	Method     string            `json:"method"`
+	Path       string            `json:"path"`
+	StatusCode int               `json:"status_code"`
+	Headers    map[string]string `json:"headers"`
+	Body       string            `json:"body"`
+}
+
+// recorder holds what record mode has captured for an agent. Captures are
+// kept after recording stops, until they are snapshotted.
+type recorder struct {
+	mu        sync.Mutex
+	recording bool
+	exchanges []Exchange
+}
+
+func (rec *recorder) active() bool {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return rec.recording
+}
+
+func (rec *recorder) setActive(on bool) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.recording = on
+}
+
+// captured returns a copy of the exchanges captured so far.
+func (rec *recorder) captured() []Exchange {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return append([]Exchange(nil), rec.exchanges...)
+}
+
+// discard drops the n oldest exchanges, once they have been snapshotted.
+// Exchanges captured since are kept.
+func (rec *recorder) discard(n int) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.exchanges = append([]Exchange(nil), rec.exchanges[min(n, len(rec.exchanges)):]...)
+}
+
+type recordContextKey struct{}
+
+// capture is the proxy's ModifyResponse hook: it copies the upstream's
+// answer into the exchange started by the recording router.
+func (rec *recorder) capture(resp *http.Response) error {
+	x, ok := resp.Request.Context().Value(recordContextKey{}).(*Exchange)
+	if !ok {
+		return nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRecordedBody+1))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+	if err != nil || len(body) > maxRecordedBody {
+		log.Printf("Not recording %s %s: response body unreadable or too large", x.Method, x.Path)
+		return nil
+	}
+
+	header := resp.Header.Clone()
+	for _, name := range unrecordedHeaders {
+		header.Del(name)
+	}
+	x.StatusCode = resp.StatusCode
+	x.Headers = make(map[string]string, len(header))
+	for name := range header {
+		x.Headers[name] = header.Get(name)
+	}
+	x.Body = string(body)
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.exchanges = append(rec.exchanges, *x)
+	return nil
+}
+
+// buildRecordingRouter sends every request to the agent's upstream, mocked
+// paths included, and captures the answers.
+func buildRecordingRouter(agent *db.Agent, rec *recorder, middlewares ...func(http.Handler) http.Handler) (*chi.Mux, error) {
+	proxy, err := newUpstreamProxy(agent)
+	if err != nil {
+		return nil, err
+	}
+	rewrite := proxy.Rewrite
+	proxy.Rewrite = func(pr *httputil.ProxyRequest) {
+		rewrite(pr)
+		// Let the transport negotiate compression itself, so that the
+		// recorded bodies are decoded.
+		pr.Out.Header.Del("Accept-Encoding")
+	}
+	proxy.ModifyResponse = rec.capture
+
+	mux := chi.NewRouter()
+	mux.Use(middlewares...)
+	mux.Handle("/*", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		x := &Exchange{Method: r.Method, Path: r.URL.Path}
+		proxy.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), recordContextKey{}, x)))
+	}))
+	return mux, nil
+}
+
+// RecordingStatus tells whether an agent is recording and how many exchanges await a snapshot.
+type RecordingStatus struct {
+	Recording bool `json:"recording"`
+	Captured  int  `json:"captured"`
+}
+
+// Recording reports the record mode of a running agent.
+func (r *Registry) Recording(agentID int) (RecordingStatus, error) {
+	server, err := r.runningServer(agentID)
+	if err != nil {
+		return RecordingStatus{}, err
+	}
+	rec := server.state.recorder
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return RecordingStatus{Recording: rec.recording, Captured: len(rec.exchanges)}, nil
+}
+
+// StartRecording switches a running agent to record mode: every request is
+// proxied to its upstream and the exchange captured.
+func (r *Registry) StartRecording(ctx context.Context, agentID int) error {
+	server, err := r.runningServer(agentID)
+	if err != nil {
+		return err
+	}
+	agent, err := r.Repo.GetAgentByID(ctx, agentID)
+	if err != nil {
+		return fmt.Errorf("agent not found: %w", err)
+	}
+	if agent.UpstreamURL == "" {
+		return fmt.Errorf("agent %d has no upstream_url to record from", agentID)
+	}
+
+	server.state.recorder.setActive(true)
+	if err := r.ReloadAgent(ctx, agentID); err != nil {
+		server.state.recorder.setActive(false)
+		return err
+	}
+	return nil
+}
+
+// StopRecording puts a running agent back to serving its mocks. What was
+// captured is kept for a snapshot.
+func (r *Registry) StopRecording(ctx context.Context, agentID int) error {
+	server, err := r.runningServer(agentID)
+	if err != nil {
+		return err
+	}
+	server.state.recorder.setActive(false)
+	return r.ReloadAgent(ctx, agentID)
+}
+
+// SnapshotOptions controls how captured exchanges become paths.
+type SnapshotOptions struct {
+	// Dedupe keeps only the first response captured for each method and
+	// path. Otherwise repeated calls become a response sequence.
+	Dedupe bool `json:"dedupe"`
+}
+
+// SnapshotResult lists the paths a snapshot created, and those it left
+// alone because the agent already mocks them.
+type SnapshotResult struct {
+	Created []db.AgentPath `json:"created"`
+	Skipped []string       `json:"skipped"`
+}
+
+// Snapshot turns the exchanges captured by record mode into mock paths of the
+// agent. The exchanges are only dropped once every path has been added; after
+// a failure, they are kept and a new snapshot skips the paths already added.
+func (r *Registry) Snapshot(ctx context.Context, agentID int, opts SnapshotOptions) (result SnapshotResult, err error) {
+	result = SnapshotResult{Created: []db.AgentPath{}, Skipped: []string{}}
+	server, err := r.runningServer(agentID)
+	if err != nil {
+		return result, err
+	}
+
+	// The paths are added behind the reloading repository's back, so that
+	// the agent is reloaded once rather than for every path, even when
+	// adding one of them fails.
+	defer func() {
+		if reloadErr := r.ReloadAgent(ctx, agentID); reloadErr != nil && err == nil {
+			err = reloadErr
+		}
+	}()
+
+	existing, err := r.Repo.GetAgentPaths(ctx, agentID)
+	if err != nil {
+		return result, fmt.Errorf("failed to load agent paths: %w", err)
+	}
+	mocked := make(map[string]bool, len(existing))
+	for _, p := range existing {
+		mocked[p.Method+" "+p.Path] = true
+	}
+
+	exchanges := server.state.recorder.captured()
+	for _, p := range pathsFromExchanges(exchanges, opts) {
+		key := p.Method + " " + p.Path
+		if mocked[key] {
+			result.Skipped = append(result.Skipped, key)
+			continue
+		}
+		if err := ValidatePath(&p); err != nil {
+			result.Skipped = append(result.Skipped, key)
+			log.Printf("Agent %d snapshot skipped %s: %v", agentID, key, err)
+			continue
+		}
+		id, err := r.store.AddPath(ctx, agentID, p)
+		if err != nil {
+			return result, fmt.Errorf("failed to add path %s: %w", key, err)
+		}
+		p.Id, p.AgentID = id, agentID
+		result.Created = append(result.Created, p)
+	}
+	server.state.recorder.discard(len(exchanges))
+	return result, nil
+}
+
+// pathsFromExchanges groups captured exchanges by method and path, in the
+// order they were first seen. Bodies that are not valid UTF-8 are stored
+// base64-encoded.
+func pathsFromExchanges(exchanges []Exchange, opts SnapshotOptions) []db.AgentPath {
+	var paths []db.AgentPath
+	index := make(map[string]int)
+	for _, x := range exchanges {
+		response := db.MockResponse{Response: x.Body, StatusCode: x.StatusCode, Headers: x.Headers}
+		if !utf8.ValidString(x.Body) {
+			response.Response, response.Encoding = base64.StdEncoding.EncodeToString([]byte(x.Body)), db.EncodingBase64
+		}
+
+		key := x.Method + " " + x.Path
+		i, seen := index[key]
+		if !seen {
+			index[key] = len(paths)
+			paths = append(paths, db.AgentPath{Method: x.Method, Path: x.Path, MockResponse: response})
+			continue
+		}
+		if opts.Dedupe {
+			continue
+		}
+
+		p := &paths[i]
+		if len(p.Sequence) == 0 {
+			p.Sequence = []db.MockResponse{p.MockResponse}
+			p.SequenceMode = db.SequenceStick
+		}
+		p.Sequence = append(p.Sequence, response)
+	}
+	return paths
+}
@@ -0,0 +1,104 @@
+package agent
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+
+	"mi6/internal/db"
+)
+
+func TestPathsFromExchanges(t *testing.T) {
+	exchanges := []Exchange{
+		{Method: "GET", Path: "/jobs/1", StatusCode: 202, Body: "pending"},
+		{Method: "GET", Path: "/logo.png", StatusCode: 200, Body: "\x89PNG\r\n\x1a\n\xff"},
+		{Method: "GET", Path: "/jobs/1", StatusCode: 200, Body: "done"},
+	}
+
+	paths := pathsFromExchanges(exchanges, SnapshotOptions{})
+	if len(paths) != 2 {
+		t.Fatalf("got %d paths, want 2", len(paths))
+	}
+	jobs, logo := paths[0], paths[1]
+	if len(jobs.Sequence) != 2 || jobs.Sequence[0].Response != "pending" || jobs.Sequence[1].Response != "done" || jobs.SequenceMode != db.SequenceStick {
+		t.Errorf("got %+v, want a sticky sequence of both job responses", jobs)
+	}
+	if logo.Encoding != db.EncodingBase64 || logo.Response != base64.StdEncoding.EncodeToString([]byte(exchanges[1].Body)) {
+		t.Errorf("binary body stored as %q with encoding %q, want it base64-encoded", logo.Response, logo.Encoding)
+	}
+
+	deduped := pathsFromExchanges(exchanges, SnapshotOptions{Dedupe: true})
+	if len(deduped[0].Sequence) != 0 || deduped[0].Response != "pending" {
+		t.Errorf("got %+v, want only the first job response", deduped[0])
+	}
+}
+
+// failingAddRepository fails every AddPath after the first ok ones.
+type failingAddRepository struct {
+	db.AgentRepository
+	ok *int
+}
+
+func (r failingAddRepository) AddPath(ctx context.Context, agentID int, path db.AgentPath) (int, error) {
+	if *r.ok == 0 {
+		return 0, errors.New("disk full")
+	}
+	*r.ok--
+	return r.AgentRepository.AddPath(ctx, agentID, path)
+}
+
+func TestSnapshotKeepsExchangesWhenAddingFails(t *testing.T) {
+	ctx := context.Background()
+	registry := newTestRegistry(t)
+	port := freePort(t)
+	id, err := registry.Repo.CreateAgent(ctx, &db.Agent{Name: "recorded", Port: port, UpstreamURL: "http://localhost:1"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.StartAgentServer(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	server, err := registry.runningServer(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.state.recorder.exchanges = []Exchange{
+		{Method: "GET", Path: "/ping", StatusCode: 200, Body: "pong"},
+		{Method: "GET", Path: "/users", StatusCode: 200, Body: "[]"},
+	}
+
+	store, ok := registry.store, 1
+	registry.store = failingAddRepository{AgentRepository: store, ok: &ok}
+	if _, err := registry.Snapshot(ctx, id, SnapshotOptions{}); err == nil {
+		t.Fatal("expected the snapshot to fail")
+	}
+	if status, _ := registry.Recording(id); status.Captured != 2 {
+		t.Errorf("%d exchanges left after a failed snapshot, want 2", status.Captured)
+	}
+	// The path added before the failure is served
+	getStatus(t, port)
+	resp, err := http.Get("http://localhost:" + port + "/ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "pong" {
+		t.Errorf("got %q from the snapshotted path, want pong", body)
+	}
+
+	registry.store = store
+	result, err := registry.Snapshot(ctx, id, SnapshotOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Created) != 1 || result.Created[0].Path != "/users" || len(result.Skipped) != 1 {
+		t.Errorf("retry created %+v and skipped %v, want /users created and /ping skipped", result.Created, result.Skipped)
+	}
+	if status, _ := registry.Recording(id); status.Captured != 0 {
+		t.Errorf("%d exchanges left after a snapshot, want none", status.Captured)
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"mi6/internal/db"
@@ -13,29 +15,70 @@ import (
 	"github.com/go-chi/chi/v5"
 )
 
+// Server is a running agent: its HTTP listener plus the router it currently serves.
+// The router is swapped atomically on reload, so the listener never has to be rebound,
+// while the runtime state is kept across reloads.
+type Server struct {
+	*http.Server
+	router atomic.Pointer[chi.Mux]
+	state  *agentState
+}
+
+// agentState is what a running agent remembers between requests.
+type agentState struct {
+	scenarios *scenarioStore
+	sequences *sequenceCounters
+	recorder  *recorder
+}
+
+func newAgentState() *agentState {
+	return &agentState{scenarios: newScenarioStore(), sequences: newSequenceCounters(), recorder: &recorder{}}
+}
+
+// ServeHTTP dispatches to whichever router is current at the time of the request.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.router.Load().ServeHTTP(w, r)
+}
+
 // Registry manages the lifecycle and access to all running mock servers.
 type Registry struct {
-	Servers map[int]*http.Server
-	mu      sync.Mutex // Protects access to the Servers map
-	Repo    db.AgentRepository
+	Servers  map[int]*Server
+	journals map[int]*Journal // Outlive their server so requests can be inspected after a stop
+	mu       sync.Mutex       // Protects access to the Servers and journals maps
+	Repo     db.AgentRepository
+	store    db.AgentRepository // Repo without the live reloading, for batched changes
+
+	JournalSize  int                  // Requests kept in memory per agent; DefaultJournalSize when zero
+	JournalStore db.JournalRepository // Optional: also persists every journaled request when set
+	SpecStore    db.SpecRepository    // Optional: enables validating requests against OpenAPI specs
 }
 
-// NewRegistry creates a new agent registry instance.
+// NewRegistry creates a new agent registry instance. The registry's Repo
+// reloads running agents whenever their configuration is changed through it.
 func NewRegistry(repo db.AgentRepository) *Registry {
-	return &Registry{
-		Servers: make(map[int]*http.Server),
-		Repo:    repo,
+	r := &Registry{
+		Servers:  make(map[int]*Server),
+		journals: make(map[int]*Journal),
 	}
+	r.store = repo
+	r.Repo = &reloadingRepository{AgentRepository: repo, registry: r}
+	return r
+}
+
+// IsRunning reports whether the agent currently has a server registered.
+func (r *Registry) IsRunning(agentID int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, running := r.Servers[agentID]
+	return running
 }
 
 // StartAgentServer retrieves configuration and launches the Agent server in a new goroutine.
+// The agent's port is bound before it returns, so a port in use is reported here.
 func (r *Registry) StartAgentServer(ctx context.Context, agentID int) error {
-	r.mu.Lock()
-	if _, running := r.Servers[agentID]; running {
-		r.mu.Unlock()
+	if r.IsRunning(agentID) {
 		return fmt.Errorf("agent %d is already running", agentID)
 	}
-	r.mu.Unlock()
 
 	// 1. Get Agent details
 	agent, err := r.Repo.GetAgentByID(ctx, agentID)
@@ -43,53 +86,157 @@ func (r *Registry) StartAgentServer(ctx context.Context, agentID int) error {
 		return fmt.Errorf("agent not found: %w", err)
 	}
 
-	// 2. Load paths from DB
-	paths, err := r.Repo.GetAgentPaths(ctx, agentID)
+	// 2. Build the mock router from the agent's paths and bind its port
+	server, ln, err := r.newAgentServer(ctx, agent, newAgentState())
 	if err != nil {
-		return fmt.Errorf("failed to load agent paths: %w", err)
+		return err
 	}
 
-	// 3. Setup mock server router
-	mux := chi.NewRouter()
-	for _, p := range paths {
-		path := p.Path // Capture loop variable
-		response := p.Response
-		mux.Get(path, func(w http.ResponseWriter, r *http.Request) {
-			w.Write([]byte(response))
-		})
+	// 3. Register and start in a new goroutine
+	r.mu.Lock()
+	if _, running := r.Servers[agentID]; running {
+		r.mu.Unlock()
+		ln.Close()
+		return fmt.Errorf("agent %d is already running", agentID)
 	}
+	r.Servers[agentID] = server
+	r.mu.Unlock()
+
+	go r.serve(agent, server, ln)
+	return nil
+}
 
-	server := &http.Server{
+// newAgentServer builds a server for the agent and binds its port.
+func (r *Registry) newAgentServer(ctx context.Context, agent *db.Agent, state *agentState) (*Server, net.Listener, error) {
+	server := &Server{state: state}
+	mux, err := r.buildAgentRouter(ctx, agent, server)
+	if err != nil {
+		return nil, nil, err
+	}
+	server.router.Store(mux)
+	server.Server = &http.Server{
 		Addr:    fmt.Sprintf(":%s", agent.Port),
-		Handler: mux,
+		Handler: server,
 	}
 
-	// 4. Register and start in a new goroutine
-	r.mu.Lock()
-	r.Servers[agentID] = server
-	r.mu.Unlock()
+	ln, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("agent %d cannot listen on port %s: %w", agent.Id, agent.Port, err)
+	}
+	return server, ln, nil
+}
 
-	go func() {
-		log.Printf("Agent %d (%s) starting on port %s", agent.Id, agent.Name, agent.Port)
+// serve runs a registered server on ln until it is shut down.
+func (r *Registry) serve(agent *db.Agent, server *Server, ln net.Listener) {
+	log.Printf("Agent %d (%s) starting on port %s", agent.Id, agent.Name, agent.Port)
 
-		// Update status to active
-		r.Repo.UpdateAgentStatus(context.Background(), agent.Id, "active")
+	// Update status to active
+	r.Repo.UpdateAgentStatus(context.Background(), agent.Id, "active")
 
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Printf("Agent %d failed to start: %v", agent.Id, err)
-		}
+	if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
+		log.Printf("Agent %d failed: %v", agent.Id, err)
+	}
 
-		// Cleanup: Remove server from map and update status
-		r.mu.Lock()
+	// Cleanup: Remove server from map and update status. A newer server may
+	// already have been registered for this agent, in which case it is left alone.
+	r.mu.Lock()
+	current := r.Servers[agent.Id] == server
+	if current {
 		delete(r.Servers, agent.Id)
-		r.mu.Unlock()
+	}
+	r.mu.Unlock()
+	if current {
 		r.Repo.UpdateAgentStatus(context.Background(), agent.Id, "stopped")
-		log.Printf("Agent %d stopped.", agent.Id)
-	}()
+	}
+	log.Printf("Agent %d stopped.", agent.Id)
+}
+
+// ReloadAgent rebuilds a running agent's routes from the repository and swaps
+// them in without restarting its listener. It is a no-op for stopped agents.
+// An agent whose port changed is restarted on the new one instead, which
+// resets its scenarios and sequences; if the new port cannot be bound, the
+// agent keeps serving on the old one and the error is returned.
+func (r *Registry) ReloadAgent(ctx context.Context, agentID int) error {
+	r.mu.Lock()
+	server, running := r.Servers[agentID]
+	r.mu.Unlock()
+
+	if !running {
+		return nil
+	}
+
+	agent, err := r.Repo.GetAgentByID(ctx, agentID)
+	if err != nil {
+		return fmt.Errorf("agent not found: %w", err)
+	}
+	if server.Addr != fmt.Sprintf(":%s", agent.Port) {
+		return r.restartAgentServer(ctx, agent, server)
+	}
+
+	mux, err := r.buildAgentRouter(ctx, agent, server)
+	if err != nil {
+		return err
+	}
+	server.router.Store(mux)
 
+	log.Printf("Agent %d (%s) routes reloaded.", agent.Id, agent.Name)
 	return nil
 }
 
+// buildAgentRouter loads an agent's paths and builds the router that serves them on server,
+// forwarding unmatched requests to the agent's upstream when it has one. In record mode,
+// all requests are forwarded instead.
+func (r *Registry) buildAgentRouter(ctx context.Context, agent *db.Agent, server *Server) (*chi.Mux, error) {
+	if server.state.recorder.active() && agent.UpstreamURL != "" {
+		return buildRecordingRouter(agent, server.state.recorder, r.recordRequests(agent.Id))
+	}
+
+	paths, err := r.Repo.GetAgentPaths(ctx, agent.Id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load agent paths: %w", err)
+	}
+	for i := range paths {
+		if paths[i].Delay == nil {
+			paths[i].Delay = agent.Delay
+		}
+		if paths[i].Throttle == nil {
+			paths[i].Throttle = agent.Throttle
+		}
+	}
+	middlewares := []func(http.Handler) http.Handler{r.recordRequests(agent.Id)}
+	validation, err := r.specValidation(ctx, agent.Id)
+	if err != nil {
+		return nil, err
+	}
+	if validation != nil {
+		middlewares = append(middlewares, validation)
+	}
+
+	mux, err := buildRouter(paths, server.state, middlewares...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Anything no mocked path answers, including known paths called with
+	// another method, is passed through to the upstream.
+	if agent.UpstreamURL != "" {
+		proxy, err := newUpstreamProxy(agent)
+		if err != nil {
+			return nil, err
+		}
+		handleUnmatched(mux, proxy.ServeHTTP)
+		mux.MethodNotAllowed(proxy.ServeHTTP)
+	}
+	return mux, nil
+}
+
+// forgetAgent drops the runtime state kept for a deleted agent.
+func (r *Registry) forgetAgent(agentID int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.journals, agentID)
+}
+
 // StopAgentServer sends a graceful shutdown signal to a running agent.
 func (r *Registry) StopAgentServer(agentID int) error {
 	r.mu.Lock()
@@ -111,10 +258,39 @@ func (r *Registry) StopAgentServer(agentID int) error {
 	return nil
 }
 
+// restartAgentServer replaces a running agent's server with a new one. The
+// new port is bound first, so the old server is only shut down once its
+// replacement is certain to start; it is unregistered before it shuts down,
+// so that its exit leaves the agent's status alone.
+func (r *Registry) restartAgentServer(ctx context.Context, agent *db.Agent, server *Server) error {
+	replacement, ln, err := r.newAgentServer(ctx, agent, newAgentState())
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	if r.Servers[agent.Id] != server {
+		r.mu.Unlock()
+		ln.Close()
+		return fmt.Errorf("agent %d was stopped or restarted meanwhile", agent.Id)
+	}
+	r.Servers[agent.Id] = replacement
+	r.mu.Unlock()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Agent %d forced shutdown of its old server: %v", agent.Id, err)
+	}
+
+	go r.serve(agent, replacement, ln)
+	return nil
+}
+
 // ShutdownAll gracefully shuts down all running agents during application exit.
 func (r *Registry) ShutdownAll() {
 	r.mu.Lock()
-	servers := make(map[int]*http.Server)
+	servers := make(map[int]*Server)
 	for id, srv := range r.Servers {
 		servers[id] = srv // Copy map to release lock quickly
 	}
@@ -130,7 +306,7 @@ func (r *Registry) ShutdownAll() {
 
 	for id, srv := range servers {
 		wg.Add(1)
-		go func(id int, srv *http.Server) {
+		go func(id int, srv *Server) {
 			defer wg.Done()
 			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 			defer cancel()
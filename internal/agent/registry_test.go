@@ -0,0 +1,172 @@
+package agent
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"mi6/internal/db"
+)
+
+// newTestRegistry returns a registry backed by a fresh SQLite database.
+func newTestRegistry(t *testing.T) *Registry {
+	t.Helper()
+	conn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "agents.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if err := db.RunMigrations(conn); err != nil {
+		t.Fatal(err)
+	}
+	registry := NewRegistry(db.NewSQLiteRepository(conn))
+	t.Cleanup(registry.ShutdownAll)
+	return registry
+}
+
+// freePort returns a port nothing listens on.
+func freePort(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return fmt.Sprint(ln.Addr().(*net.TCPAddr).Port)
+}
+
+// getStatus requests /ping from the given port, retrying until the server answers.
+func getStatus(t *testing.T, port string) int {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		resp, err := http.Get("http://localhost:" + port + "/ping")
+		if err == nil {
+			resp.Body.Close()
+			return resp.StatusCode
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("nothing answers on port %s: %v", port, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStartAgentServerReportsPortInUse(t *testing.T) {
+	ctx := context.Background()
+	registry := newTestRegistry(t)
+	taken, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+
+	port := fmt.Sprint(taken.Addr().(*net.TCPAddr).Port)
+	id, err := registry.Repo.CreateAgent(ctx, &db.Agent{Name: "busy", Port: port}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.StartAgentServer(ctx, id); !errors.Is(err, syscall.EADDRINUSE) {
+		t.Fatalf("got %v, want the port in use reported", err)
+	}
+	if registry.IsRunning(id) {
+		t.Error("an agent that could not bind its port is registered as running")
+	}
+}
+
+func TestPortChangeMovesRunningAgent(t *testing.T) {
+	ctx := context.Background()
+	registry := newTestRegistry(t)
+	oldPort, newPort := freePort(t), freePort(t)
+
+	a := &db.Agent{Name: "ping", Port: oldPort}
+	id, err := registry.Repo.CreateAgent(ctx, a, []db.AgentPath{{Method: "GET", Path: "/ping"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.StartAgentServer(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	getStatus(t, oldPort)
+
+	a.Id, a.Port = id, newPort
+	if err := registry.Repo.UpdateAgent(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	if status := getStatus(t, newPort); status != http.StatusOK {
+		t.Errorf("got %d on the new port, want 200", status)
+	}
+	if !registry.IsRunning(id) {
+		t.Error("the agent stopped after moving")
+	}
+}
+
+func TestPortChangeToBusyPortKeepsRunningAgent(t *testing.T) {
+	ctx := context.Background()
+	registry := newTestRegistry(t)
+	port := freePort(t)
+	taken, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+
+	a := &db.Agent{Name: "ping", Port: port}
+	id, err := registry.Repo.CreateAgent(ctx, a, []db.AgentPath{{Method: "GET", Path: "/ping"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.StartAgentServer(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	getStatus(t, port)
+
+	a.Id, a.Port = id, fmt.Sprint(taken.Addr().(*net.TCPAddr).Port)
+	if err := registry.Repo.UpdateAgent(ctx, a); !errors.Is(err, syscall.EADDRINUSE) {
+		t.Fatalf("got %v, want the port in use reported", err)
+	}
+	if status := getStatus(t, port); status != http.StatusOK {
+		t.Errorf("got %d on the old port, want 200", status)
+	}
+	stored, err := registry.Repo.GetAgentByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Port != port || stored.Status != "active" {
+		t.Errorf("stored agent has port %s and status %s, want %s and active", stored.Port, stored.Status, port)
+	}
+}
+
+func TestDeleteStopsRunningAgent(t *testing.T) {
+	ctx := context.Background()
+	registry := newTestRegistry(t)
+	port := freePort(t)
+
+	id, err := registry.Repo.CreateAgent(ctx, &db.Agent{Name: "ping", Port: port}, []db.AgentPath{{Method: "GET", Path: "/ping"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.StartAgentServer(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	getStatus(t, port)
+
+	if err := registry.Repo.DeleteAgent(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.Repo.GetAgentByID(ctx, id); err != sql.ErrNoRows {
+		t.Errorf("got %v looking the agent up, want it deleted", err)
+	}
+	if _, err := http.Get("http://localhost:" + port + "/ping"); err == nil {
+		t.Error("the deleted agent still answers")
+	}
+}
@@ -0,0 +1,90 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"mi6/internal/db"
+)
+
+// reloadingRepository decorates an AgentRepository so that every change to an
+// agent's configuration is pushed live to its running server, if any, and the
+// registry's runtime state for deleted agents is released.
+type reloadingRepository struct {
+	db.AgentRepository
+	registry *Registry
+}
+
+// UpdateAgent moves a running agent to its new port, if it changed. When the
+// new port cannot be bound, the agent keeps serving on the old one, its
+// previous settings are restored and the error is returned.
+func (r *reloadingRepository) UpdateAgent(ctx context.Context, agent *db.Agent) error {
+	previous, err := r.AgentRepository.GetAgentByID(ctx, agent.Id)
+	if err != nil {
+		return err
+	}
+	if err := r.AgentRepository.UpdateAgent(ctx, agent); err != nil {
+		return err
+	}
+	if previous.Port == agent.Port || !r.registry.IsRunning(agent.Id) {
+		r.reload(ctx, agent.Id)
+		return nil
+	}
+
+	if err := r.registry.ReloadAgent(ctx, agent.Id); err != nil {
+		if restoreErr := r.AgentRepository.UpdateAgent(ctx, previous); restoreErr != nil {
+			return fmt.Errorf("%w; restoring the previous settings also failed: %v", err, restoreErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// DeleteAgent stops the agent first if it is running, so that no server is
+// left serving a deleted agent.
+func (r *reloadingRepository) DeleteAgent(ctx context.Context, id int) error {
+	if r.registry.IsRunning(id) {
+		if err := r.registry.StopAgentServer(id); err != nil {
+			return err
+		}
+	}
+	if err := r.AgentRepository.DeleteAgent(ctx, id); err != nil {
+		return err
+	}
+	r.registry.forgetAgent(id)
+	return nil
+}
+
+func (r *reloadingRepository) AddPath(ctx context.Context, agentID int, path db.AgentPath) (int, error) {
+	id, err := r.AgentRepository.AddPath(ctx, agentID, path)
+	if err != nil {
+		return 0, err
+	}
+	r.reload(ctx, agentID)
+	return id, nil
+}
+
+func (r *reloadingRepository) UpdatePath(ctx context.Context, path db.AgentPath) error {
+	if err := r.AgentRepository.UpdatePath(ctx, path); err != nil {
+		return err
+	}
+	r.reload(ctx, path.AgentID)
+	return nil
+}
+
+func (r *reloadingRepository) DeletePath(ctx context.Context, agentID, pathID int) error {
+	if err := r.AgentRepository.DeletePath(ctx, agentID, pathID); err != nil {
+		return err
+	}
+	r.reload(ctx, agentID)
+	return nil
+}
+
+// reload refreshes a running agent. The repository change has already been
+// committed at this point, so a failure is logged rather than returned.
+func (r *reloadingRepository) reload(ctx context.Context, agentID int) {
+	if err := r.registry.ReloadAgent(ctx, agentID); err != nil {
+		log.Printf("Agent %d reload failed: %v", agentID, err)
+	}
+}
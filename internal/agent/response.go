@@ -0,0 +1,195 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"mi6/internal/db"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// RequestData exposes the incoming request to templated responses, e.g.
+// {{.PathParams.id}}, {{.Query.page}} or {{.Headers.X-Request-Id}}.
+type RequestData struct {
+	Method     string
+	Path       string
+	PathParams map[string]string // Includes "*" for a trailing wildcard
+	Query      map[string]string // First value of each query parameter
+	Headers    map[string]string // Canonical header names, multiple values joined by ","
+	Body       string
+	JSON       any // Request body decoded as JSON, nil when it is not valid JSON
+}
+
+// newRequestData captures the request, including the URL parameters chi matched.
+func newRequestData(r *http.Request) RequestData {
+	data := RequestData{
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		PathParams: map[string]string{},
+		Query:      map[string]string{},
+		Headers:    map[string]string{},
+	}
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		for i, key := range rctx.URLParams.Keys {
+			data.PathParams[key] = rctx.URLParams.Values[i]
+		}
+	}
+	for key, values := range r.URL.Query() {
+		data.Query[key] = values[0]
+	}
+	for key, values := range r.Header {
+		data.Headers[key] = strings.Join(values, ",")
+	}
+	return data
+}
+
+// placeholder matches {{.Method}}, {{.Path}} and {{.PathParams.<name>}}-style references.
+var placeholder = regexp.MustCompile(`\{\{\s*\.(Method|Path|PathParams|Query|Headers)(?:\.([\w*-]+))?\s*\}\}`)
+
+// substitute replaces placeholders in a templated response's header values
+// with values from the request. Unknown names expand to an empty string;
+// anything else is left untouched.
+func substitute(s string, data RequestData) string {
+	if !strings.Contains(s, "{{") {
+		return s
+	}
+	return placeholder.ReplaceAllStringFunc(s, func(m string) string {
+		parts := placeholder.FindStringSubmatch(m)
+		field, key := parts[1], parts[2]
+		switch field {
+		case "Method":
+			return data.Method
+		case "Path":
+			return data.Path
+		case "PathParams":
+			return data.PathParams[key]
+		case "Query":
+			return data.Query[key]
+		case "Headers":
+			return data.Headers[http.CanonicalHeaderKey(key)]
+		}
+		return m
+	})
+}
+
+// indexPlaceholders rewrites the placeholders text/template cannot parse as
+// field references, such as {{.Headers.X-Request-Id}} or {{.PathParams.*}},
+// into index calls. Header names are canonicalized, as in substitute.
+func indexPlaceholders(body string) string {
+	return placeholder.ReplaceAllStringFunc(body, func(m string) string {
+		parts := placeholder.FindStringSubmatch(m)
+		field, key := parts[1], parts[2]
+		if key == "" {
+			return m
+		}
+		if field == "Headers" {
+			key = http.CanonicalHeaderKey(key)
+		} else if !strings.ContainsAny(key, "*-") {
+			return m
+		}
+		return fmt.Sprintf("{{index .%s %q}}", field, key)
+	})
+}
+
+// readBody loads the request body into Body and, when it is valid JSON, JSON.
+func (d *RequestData) readBody(r *http.Request) {
+	if r.Body == nil {
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	d.Body = string(body)
+	if json.Unmarshal(body, &d.JSON) != nil {
+		d.JSON = nil
+	}
+}
+
+// compiledResponse is a response ready to be served. Templated bodies are
+// parsed once when the route is built rather than on every request.
+type compiledResponse struct {
+	statusCode int
+	headers    map[string]string
+	body       string
+	tmpl       *template.Template // nil for static bodies, which are served as they are
+	raw        bool               // body is decoded binary
+	fault      *db.Fault
+}
+
+// compileResponse prepares a response; name identifies it in template errors.
+func compileResponse(name string, m db.MockResponse) (*compiledResponse, error) {
+	c := &compiledResponse{statusCode: m.StatusCode, headers: m.Headers, body: m.Response, fault: m.Fault}
+	if c.statusCode == 0 {
+		c.statusCode = http.StatusOK
+	}
+	if c.statusCode < 100 || c.statusCode > 599 {
+		return nil, fmt.Errorf("invalid status code %d", c.statusCode)
+	}
+	if err := ValidateFault(m.Fault); err != nil {
+		return nil, err
+	}
+	switch m.Encoding {
+	case "":
+	case db.EncodingBase64:
+		if m.Templated {
+			return nil, fmt.Errorf("a base64-encoded response cannot be templated")
+		}
+		body, err := base64.StdEncoding.DecodeString(m.Response)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 response: %w", err)
+		}
+		c.body, c.raw = string(body), true
+	default:
+		return nil, fmt.Errorf("unknown response encoding %q", m.Encoding)
+	}
+	if m.Templated {
+		tmpl, err := parseTemplate(name, indexPlaceholders(m.Response))
+		if err != nil {
+			return nil, fmt.Errorf("invalid response template: %w", err)
+		}
+		c.tmpl = tmpl
+	}
+	return c, nil
+}
+
+// write renders the response for a request, or breaks the connection when
+// the response's fault fires. Template failures are answered with a 500 so
+// the problem is visible to the caller.
+func (c *compiledResponse) write(w http.ResponseWriter, r *http.Request) {
+	var body []byte
+	var data RequestData
+	if c.tmpl != nil {
+		data = newRequestData(r)
+		data.readBody(r)
+		var buf bytes.Buffer
+		if err := c.tmpl.Execute(&buf, data); err != nil {
+			log.Printf("Response template %s failed: %v", c.tmpl.Name(), err)
+			http.Error(w, fmt.Sprintf("mi6: response template failed: %v", err), http.StatusInternalServerError)
+			return
+		}
+		body = buf.Bytes()
+	} else {
+		body = []byte(c.body)
+	}
+
+	for name, value := range c.headers {
+		if c.tmpl != nil {
+			value = substitute(value, data)
+		}
+		w.Header().Set(name, value)
+	}
+	if faultFires(c.fault) {
+		injectFault(w, r, c.fault, c.statusCode, body)
+		return
+	}
+	w.WriteHeader(c.statusCode)
+	w.Write(body)
+}
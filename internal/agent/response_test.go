@@ -0,0 +1,57 @@
+package agent
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"mi6/internal/db"
+)
+
+func TestPlaceholdersAreOptIn(t *testing.T) {
+	tests := []struct {
+		name       string
+		response   db.MockResponse
+		wantBody   string
+		wantHeader string
+	}{
+		{
+			name: "static",
+			response: db.MockResponse{
+				Response: `{"path": "{{.Path}}", "id": "{{.Headers.X-Id}}"}`,
+				Headers:  map[string]string{"X-Echo": "{{.PathParams.*}}"},
+			},
+			wantBody:   `{"path": "{{.Path}}", "id": "{{.Headers.X-Id}}"}`,
+			wantHeader: "{{.PathParams.*}}",
+		},
+		{
+			name: "templated",
+			response: db.MockResponse{
+				Response:  `{{.Method}} {{.Path}} {{.PathParams.*}} {{.Headers.x-id}} {{.Query.page}}[{{.Query.missing}}]`,
+				Headers:   map[string]string{"X-Echo": "{{.PathParams.*}}"},
+				Templated: true,
+			},
+			wantBody:   "GET /files/a/b a/b 42 2[]",
+			wantHeader: "a/b",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paths := []db.AgentPath{{Id: 1, Method: "GET", Path: "/files/*", MockResponse: tt.response}}
+			mux, err := buildRouter(paths, newAgentState())
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest("GET", "/files/a/b?page=2", nil)
+			req.Header.Set("X-Id", "42")
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if body := rec.Body.String(); body != tt.wantBody {
+				t.Errorf("got body %q, want %q", body, tt.wantBody)
+			}
+			if header := rec.Header().Get("X-Echo"); header != tt.wantHeader {
+				t.Errorf("got header %q, want %q", header, tt.wantHeader)
+			}
+		})
+	}
+}
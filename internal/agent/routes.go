@@ -0,0 +1,261 @@
+package agent
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"mi6/internal/db"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// supportedMethods lists the HTTP methods a mock path can be registered for.
+var supportedMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodOptions: true,
+	http.MethodConnect: true,
+	http.MethodTrace:   true,
+	db.MethodAny:       true,
+}
+
+// ValidatePath normalizes a path definition and checks that it can be routed.
+func ValidatePath(p *db.AgentPath) error {
+	p.Method = db.NormalizeMethod(p.Method)
+	if !supportedMethods[p.Method] {
+		return fmt.Errorf("unsupported method %q for path %q", p.Method, p.Path)
+	}
+	if !strings.HasPrefix(p.Path, "/") {
+		return fmt.Errorf("path %q must begin with '/'", p.Path)
+	}
+	if err := route(chi.NewRouter(), *p, http.NotFoundHandler()); err != nil {
+		return err
+	}
+	if p.StatusCode == 0 {
+		p.StatusCode = http.StatusOK
+	}
+	for i := range p.Variants {
+		if p.Variants[i].StatusCode == 0 {
+			p.Variants[i].StatusCode = http.StatusOK
+		}
+	}
+	for i := range p.Sequence {
+		if p.Sequence[i].StatusCode == 0 {
+			p.Sequence[i].StatusCode = http.StatusOK
+		}
+	}
+	switch p.SequenceMode {
+	case "", db.SequenceCycle, db.SequenceStick, db.SequenceFail:
+	default:
+		return fmt.Errorf("path %q: unknown sequence mode %q", p.Path, p.SequenceMode)
+	}
+	if err := ValidateDelay(p.Delay); err != nil {
+		return fmt.Errorf("path %q: %w", p.Path, err)
+	}
+	if err := ValidateThrottle(p.Throttle); err != nil {
+		return fmt.Errorf("path %q: %w", p.Path, err)
+	}
+	if _, err := compilePath(*p, newAgentState()); err != nil {
+		return fmt.Errorf("path %q: %w", p.Path, err)
+	}
+	return nil
+}
+
+// compiledVariant is a response ready to be matched and served: either one of
+// a path's variants or, without conditions, its fallback response.
+type compiledVariant struct {
+	conditions []db.Condition
+	step       db.ScenarioStep
+	response   *compiledResponse
+}
+
+// compiledPath holds everything needed to answer requests for one path.
+type compiledPath struct {
+	id           int
+	candidates   []compiledVariant   // Variants by priority, then the fallback
+	sequence     []*compiledResponse // Replaces the fallback's response when set
+	sequenceMode string
+	delay        *db.Delay    // The path's own delay, or the agent's default
+	throttle     *db.Throttle // Likewise
+	state        *agentState  // Shared by every path of the agent
+	stateful     bool         // Some response is gated by, or moves, a scenario
+}
+
+// compilePath validates and prepares a path's responses, registering the
+// scenarios it takes part in with the agent's state.
+func compilePath(p db.AgentPath, state *agentState) (*compiledPath, error) {
+	name := fmt.Sprintf("%s %s", p.Method, p.Path)
+	fallback, err := compileResponse(name, p.MockResponse)
+	if err != nil {
+		return nil, err
+	}
+	cp := &compiledPath{id: p.Id, sequenceMode: p.SequenceMode, delay: p.Delay, throttle: p.Throttle, state: state}
+
+	for i, m := range p.Sequence {
+		response, err := compileResponse(fmt.Sprintf("%s sequence #%d", name, i+1), m)
+		if err != nil {
+			return nil, fmt.Errorf("sequence #%d: %w", i+1, err)
+		}
+		cp.sequence = append(cp.sequence, response)
+	}
+
+	variants := append([]db.ResponseVariant(nil), p.Variants...)
+	sort.SliceStable(variants, func(i, j int) bool { return variants[i].Priority < variants[j].Priority })
+	for i, v := range variants {
+		label := v.Name
+		if label == "" {
+			label = fmt.Sprintf("#%d", i+1)
+		}
+		for _, c := range v.Conditions {
+			if err := ValidateCondition(c); err != nil {
+				return nil, fmt.Errorf("variant %s: %w", label, err)
+			}
+		}
+		response, err := compileResponse(name+" variant "+label, v.MockResponse)
+		if err != nil {
+			return nil, fmt.Errorf("variant %s: %w", label, err)
+		}
+		if v.Scenario == "" {
+			v.Scenario = p.Scenario
+		}
+		cp.candidates = append(cp.candidates, compiledVariant{conditions: v.Conditions, step: v.ScenarioStep, response: response})
+	}
+	cp.candidates = append(cp.candidates, compiledVariant{step: p.ScenarioStep, response: fallback})
+
+	for _, v := range cp.candidates {
+		if v.step.Scenario != "" && (v.step.RequiredState != "" || v.step.NewState != "") {
+			cp.stateful = true
+			state.scenarios.declare(v.step.Scenario)
+		}
+	}
+	return cp, nil
+}
+
+// selectResponse returns the first variant whose conditions and scenario
+// state hold, falling back to the path's own response, and applies its
+// scenario transition. It returns nil when nothing may be served.
+func (cp *compiledPath) selectResponse(r *http.Request) *compiledVariant {
+	if len(cp.candidates) == 1 && !cp.stateful {
+		return &cp.candidates[0]
+	}
+
+	var view *requestView
+	if len(cp.candidates) > 1 {
+		view = viewOfRequest(r)
+	}
+
+	// Choosing a response and moving the scenario on happen atomically, so
+	// concurrent requests observe the transitions one at a time.
+	scenarios := cp.state.scenarios
+	if cp.stateful {
+		scenarios.mu.Lock()
+		defer scenarios.mu.Unlock()
+	}
+	for i, v := range cp.candidates {
+		if scenarios.allows(v.step) && v.matches(view) {
+			scenarios.advance(v.step)
+			return &cp.candidates[i]
+		}
+	}
+	return nil
+}
+
+// fallbackResponse serves the path's own response, or the next entry of its
+// sequence. It returns nil once a SequenceFail sequence is exhausted.
+func (cp *compiledPath) fallbackResponse(v *compiledVariant) *compiledResponse {
+	if len(cp.sequence) == 0 {
+		return v.response
+	}
+	i := cp.state.sequences.next(cp.id, len(cp.sequence), cp.sequenceMode)
+	if i < 0 {
+		return nil
+	}
+	return cp.sequence[i]
+}
+
+func (v compiledVariant) matches(view *requestView) bool {
+	for _, c := range v.conditions {
+		if ok, _ := checkCondition(c, view); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (cp *compiledPath) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	markMatched(r, cp.id)
+	if !wait(r.Context(), cp.delay) {
+		return // The client went away while we were waiting
+	}
+	if cp.throttle != nil {
+		w = newThrottledWriter(w, r, cp.throttle)
+	}
+	selected := cp.selectResponse(r)
+	if selected == nil {
+		http.Error(w, "mi6: no response for the current scenario state", http.StatusNotFound)
+		return
+	}
+
+	response := selected.response
+	if selected == &cp.candidates[len(cp.candidates)-1] {
+		if response = cp.fallbackResponse(selected); response == nil {
+			http.Error(w, "mi6: response sequence exhausted", http.StatusInternalServerError)
+			return
+		}
+	}
+	response.write(w, r)
+}
+
+// buildRouter registers every path on a fresh chi router behind the given
+// middlewares. Paths registered for any method go first so that a
+// method-specific definition of the same path takes precedence.
+func buildRouter(paths []db.AgentPath, state *agentState, middlewares ...func(http.Handler) http.Handler) (*chi.Mux, error) {
+	sort.SliceStable(paths, func(i, j int) bool {
+		return paths[i].Method == db.MethodAny && paths[j].Method != db.MethodAny
+	})
+	mux := chi.NewRouter()
+	mux.Use(middlewares...)
+	for _, p := range paths {
+		handler, err := compilePath(p, state)
+		if err != nil {
+			return nil, fmt.Errorf("path %d (%s %s): %w", p.Id, p.Method, p.Path, err)
+		}
+		if err := route(mux, p, handler); err != nil {
+			return nil, fmt.Errorf("path %d: %w", p.Id, err)
+		}
+	}
+	handleUnmatched(mux, http.NotFound)
+	return mux, nil
+}
+
+// handleUnmatched sets the handler for requests no path answers. chi skips
+// the middlewares of a mux without routes, going straight to its NotFound
+// handler, so for an agent without paths the handler is wrapped in them.
+func handleUnmatched(mux *chi.Mux, h http.HandlerFunc) {
+	if len(mux.Routes()) == 0 {
+		h = chi.Chain(mux.Middlewares()...).HandlerFunc(h).ServeHTTP
+	}
+	mux.NotFound(h)
+}
+
+// route registers a path's handler on mux. chi panics on patterns it cannot
+// parse, such as "/users/{id"; the panic is returned as an error instead.
+func route(mux *chi.Mux, p db.AgentPath, handler http.Handler) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("invalid path %q: %v", p.Path, v)
+		}
+	}()
+	if p.Method == db.MethodAny {
+		mux.Handle(p.Path, handler)
+	} else {
+		mux.Method(p.Method, p.Path, handler)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package agent
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"mi6/internal/db"
+)
+
+func TestValidatePath(t *testing.T) {
+	tests := []struct {
+		method, path string
+		wantErr      string // Empty when the path is valid
+	}{
+		{"GET", "/users/{id}", ""},
+		{"any", "/files/*", ""},
+		{"post", "/users/{id:[0-9]+}", ""},
+		{"GET", "users", "must begin with '/'"},
+		{"BREW", "/coffee", "unsupported method"},
+		{"GET", "/users/{id", "closing delimiter"},
+		{"GET", "/a/*/b", "wildcard"},
+		{"GET", "/a/{id}/{id}", "duplicate param key"},
+		{"GET", "/a/{id:(}", "invalid regexp"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			p := db.AgentPath{Method: tt.method, Path: tt.path}
+			err := ValidatePath(&p)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBuildRouterRejectsInvalidPattern(t *testing.T) {
+	paths := []db.AgentPath{{Id: 7, Method: "GET", Path: "/users/{id"}}
+	if _, err := buildRouter(paths, newAgentState()); err == nil {
+		t.Fatal("buildRouter accepted a pattern chi cannot parse")
+	}
+}
+
+func TestBuildRouterRunsMiddlewaresWithoutPaths(t *testing.T) {
+	for _, paths := range [][]db.AgentPath{nil, {{Method: "GET", Path: "/known"}}} {
+		calls := 0
+		count := func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				next.ServeHTTP(w, r)
+			})
+		}
+		mux, err := buildRouter(paths, newAgentState(), count)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", "/unknown", nil))
+		if calls != 1 || rec.Code != http.StatusNotFound {
+			t.Errorf("%d paths: middleware ran %d times, status %d; want once, 404", len(paths), calls, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package agent
+
+import (
+	"fmt"
+	"sync"
+
+	"mi6/internal/db"
+)
+
+// scenarioStore tracks the current state of each scenario of a running agent.
+// It is part of the Server's runtime state, so route reloads keep the states intact.
+type scenarioStore struct {
+	mu     sync.Mutex
+	states map[string]string
+}
+
+func newScenarioStore() *scenarioStore {
+	return &scenarioStore{states: make(map[string]string)}
+}
+
+// declare registers a scenario in its starting state, keeping any existing state.
+func (s *scenarioStore) declare(name string) {
+	if name == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.states[name]; !ok {
+		s.states[name] = db.ScenarioStarted
+	}
+}
+
+// allows reports whether a response gated by step may be served. Callers hold s.mu.
+func (s *scenarioStore) allows(step db.ScenarioStep) bool {
+	if step.Scenario == "" || step.RequiredState == "" {
+		return true
+	}
+	return s.states[step.Scenario] == step.RequiredState
+}
+
+// advance applies step's transition, if any. Callers hold s.mu.
+func (s *scenarioStore) advance(step db.ScenarioStep) {
+	if step.Scenario != "" && step.NewState != "" {
+		s.states[step.Scenario] = step.NewState
+	}
+}
+
+// snapshot returns a copy of every scenario's current state.
+func (s *scenarioStore) snapshot() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	states := make(map[string]string, len(s.states))
+	for name, state := range s.states {
+		states[name] = state
+	}
+	return states
+}
+
+// reset moves the named scenarios, or all of them when none are given, back to ScenarioStarted.
+func (s *scenarioStore) reset(names ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(names) == 0 {
+		for name := range s.states {
+			s.states[name] = db.ScenarioStarted
+		}
+		return nil
+	}
+	for _, name := range names {
+		if _, ok := s.states[name]; !ok {
+			return fmt.Errorf("unknown scenario %q", name)
+		}
+		s.states[name] = db.ScenarioStarted
+	}
+	return nil
+}
+
+// set forces a scenario into a state.
+func (s *scenarioStore) set(name, state string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.states[name]; !ok {
+		return fmt.Errorf("unknown scenario %q", name)
+	}
+	s.states[name] = state
+	return nil
+}
+
+// runningServer returns the agent's server or an error when it is stopped.
+func (r *Registry) runningServer(agentID int) (*Server, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	server, running := r.Servers[agentID]
+	if !running {
+		return nil, fmt.Errorf("agent %d is not running", agentID)
+	}
+	return server, nil
+}
+
+// Scenarios returns the current state of every scenario of a running agent.
+func (r *Registry) Scenarios(agentID int) (map[string]string, error) {
+	server, err := r.runningServer(agentID)
+	if err != nil {
+		return nil, err
+	}
+	return server.state.scenarios.snapshot(), nil
+}
+
+// ResetScenarios moves the named scenarios, or all when none are given, back to their starting state.
+func (r *Registry) ResetScenarios(agentID int, names ...string) error {
+	server, err := r.runningServer(agentID)
+	if err != nil {
+		return err
+	}
+	return server.state.scenarios.reset(names...)
+}
+
+// SetScenarioState forces a scenario of a running agent into the given state.
+func (r *Registry) SetScenarioState(agentID int, name, state string) error {
+	server, err := r.runningServer(agentID)
+	if err != nil {
+		return err
+	}
+	return server.state.scenarios.set(name, state)
+}
@@ -0,0 +1,151 @@
+package agent
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+
+	"mi6/internal/db"
+)
+
+// cartPaths model a cart: it starts empty, POST fills it once, and DELETE
+// empties it again from any state.
+func cartPaths() []db.AgentPath {
+	return []db.AgentPath{
+		{Id: 1, Method: "GET", Path: "/cart", MockResponse: text("empty"),
+			ScenarioStep: db.ScenarioStep{Scenario: "cart", RequiredState: db.ScenarioStarted},
+			Variants: []db.ResponseVariant{
+				// Inherits the path's scenario
+				{Name: "full", MockResponse: text("full"), ScenarioStep: db.ScenarioStep{RequiredState: "added"}},
+			}},
+		{Id: 2, Method: "POST", Path: "/cart", MockResponse: text("added"),
+			ScenarioStep: db.ScenarioStep{Scenario: "cart", RequiredState: db.ScenarioStarted, NewState: "added"}},
+		{Id: 3, Method: "DELETE", Path: "/cart", MockResponse: text("cleared"),
+			ScenarioStep: db.ScenarioStep{Scenario: "cart", NewState: db.ScenarioStarted}},
+	}
+}
+
+func TestScenarioTransitions(t *testing.T) {
+	state := newAgentState()
+	mux, err := buildRouter(cartPaths(), state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := state.scenarios.snapshot(); got["cart"] != db.ScenarioStarted {
+		t.Fatalf("got states %v, want cart declared as started", got)
+	}
+
+	steps := []struct {
+		method     string
+		wantStatus int
+		wantBody   string
+		wantState  string
+	}{
+		{"GET", http.StatusOK, "empty", db.ScenarioStarted},
+		{"POST", http.StatusOK, "added", "added"},
+		{"POST", http.StatusNotFound, "mi6: no response for the current scenario state\n", "added"},
+		{"GET", http.StatusOK, "full", "added"},
+		{"DELETE", http.StatusOK, "cleared", db.ScenarioStarted},
+		{"GET", http.StatusOK, "empty", db.ScenarioStarted},
+	}
+	for i, s := range steps {
+		status, body := call(mux, s.method, "/cart", "", nil)
+		if status != s.wantStatus || body != s.wantBody {
+			t.Fatalf("step %d, %s /cart: got %d %q, want %d %q", i+1, s.method, status, body, s.wantStatus, s.wantBody)
+		}
+		if got := state.scenarios.snapshot()["cart"]; got != s.wantState {
+			t.Fatalf("step %d, %s /cart: scenario is %q, want %q", i+1, s.method, got, s.wantState)
+		}
+	}
+}
+
+func TestScenarioResetAndSet(t *testing.T) {
+	state := newAgentState()
+	mux, err := buildRouter(cartPaths(), state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	call(mux, "POST", "/cart", "", nil)
+
+	// Reloading the routes keeps the states
+	if mux, err = buildRouter(cartPaths(), state); err != nil {
+		t.Fatal(err)
+	}
+	if _, body := call(mux, "GET", "/cart", "", nil); body != "full" {
+		t.Fatalf("got %q after a reload, want the cart still full", body)
+	}
+
+	if err := state.scenarios.reset("cart"); err != nil {
+		t.Fatal(err)
+	}
+	if _, body := call(mux, "GET", "/cart", "", nil); body != "empty" {
+		t.Errorf("got %q after a reset, want the cart empty", body)
+	}
+
+	if err := state.scenarios.set("cart", "added"); err != nil {
+		t.Fatal(err)
+	}
+	if _, body := call(mux, "GET", "/cart", "", nil); body != "full" {
+		t.Errorf("got %q after setting the state, want the cart full", body)
+	}
+	if err := state.scenarios.reset(); err != nil {
+		t.Fatal(err)
+	}
+	if got := state.scenarios.snapshot()["cart"]; got != db.ScenarioStarted {
+		t.Errorf("got %q after resetting every scenario, want %q", got, db.ScenarioStarted)
+	}
+
+	if err := state.scenarios.reset("checkout"); err == nil {
+		t.Error("expected resetting an unknown scenario to fail")
+	}
+	if err := state.scenarios.set("checkout", "paid"); err == nil {
+		t.Error("expected setting an unknown scenario to fail")
+	}
+}
+
+// TestScenarioTransitionsAreAtomic sends concurrent requests that may each
+// move the scenario on; exactly one of them must observe the transition.
+func TestScenarioTransitionsAreAtomic(t *testing.T) {
+	paths := []db.AgentPath{{Id: 1, Method: "POST", Path: "/claim", MockResponse: text("too late"),
+		Variants: []db.ResponseVariant{{Name: "winner", MockResponse: text("winner"),
+			ScenarioStep: db.ScenarioStep{Scenario: "prize", RequiredState: db.ScenarioStarted, NewState: "claimed"}}},
+	}}
+	mux, err := buildRouter(paths, newAgentState())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const requests = 64
+	var wg sync.WaitGroup
+	bodies := make(chan string, requests)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, body := call(mux, "POST", "/claim", "", nil)
+			bodies <- body
+		}()
+	}
+	wg.Wait()
+	close(bodies)
+
+	winners := 0
+	for body := range bodies {
+		if body == "winner" {
+			winners++
+		}
+	}
+	if winners != 1 {
+		t.Errorf("%d requests won the prize, want exactly 1", winners)
+	}
+}
+
+func TestRegistryScenariosRequireRunningAgent(t *testing.T) {
+	registry := newTestRegistry(t)
+	if _, err := registry.Scenarios(42); err == nil {
+		t.Error("expected the scenarios of a stopped agent to be refused")
+	}
+	if err := registry.ResetScenarios(42); err == nil {
+		t.Error("expected resetting the scenarios of a stopped agent to be refused")
+	}
+}
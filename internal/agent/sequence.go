@@ -0,0 +1,83 @@
+package agent
+
+import (
+	"sync"
+
+	"mi6/internal/db"
+)
+
+// sequenceCounters tracks, per path, how many responses of its sequence have
+// been served. Like scenario states, the counters survive route reloads.
+type sequenceCounters struct {
+	mu    sync.Mutex
+	calls map[int]int // Keyed by path ID
+}
+
+func newSequenceCounters() *sequenceCounters {
+	return &sequenceCounters{calls: make(map[int]int)}
+}
+
+// next picks the sequence entry for the path's next call and counts the call.
+// It returns -1 when the sequence is exhausted in SequenceFail mode.
+func (s *sequenceCounters) next(pathID, length int, mode string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := s.calls[pathID]
+	s.calls[pathID] = n + 1
+	if n < length {
+		return n
+	}
+	switch mode {
+	case db.SequenceStick:
+		return length - 1
+	case db.SequenceFail:
+		return -1
+	default:
+		return n % length
+	}
+}
+
+func (s *sequenceCounters) get(pathID int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[pathID]
+}
+
+func (s *sequenceCounters) reset(pathID int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.calls, pathID)
+}
+
+// SequenceStatus describes how far a path's response sequence has progressed.
+type SequenceStatus struct {
+	PathID int    `json:"path_id"`
+	Calls  int    `json:"calls"`  // Responses served from the sequence so far
+	Length int    `json:"length"` // Number of responses in the sequence
+	Mode   string `json:"mode"`
+}
+
+// Sequence reports the call counter of a path on a running agent.
+func (r *Registry) Sequence(agentID int, path *db.AgentPath) (SequenceStatus, error) {
+	server, err := r.runningServer(agentID)
+	if err != nil {
+		return SequenceStatus{}, err
+	}
+
+	mode := path.SequenceMode
+	if mode == "" {
+		mode = db.SequenceCycle
+	}
+	return SequenceStatus{PathID: path.Id, Calls: server.state.sequences.get(path.Id), Length: len(path.Sequence), Mode: mode}, nil
+}
+
+// ResetSequence rewinds a path's response sequence to its first entry.
+func (r *Registry) ResetSequence(agentID, pathID int) error {
+	server, err := r.runningServer(agentID)
+	if err != nil {
+		return err
+	}
+	server.state.sequences.reset(pathID)
+	return nil
+}
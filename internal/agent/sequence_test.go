@@ -0,0 +1,91 @@
+package agent
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"mi6/internal/db"
+)
+
+func sequencePath(mode string) db.AgentPath {
+	return db.AgentPath{Id: 1, Method: "GET", Path: "/status", MockResponse: text("unused"),
+		Sequence:     []db.MockResponse{text("queued"), text("running"), {StatusCode: http.StatusCreated, Response: "done"}},
+		SequenceMode: mode,
+		Variants: []db.ResponseVariant{{Name: "peek", MockResponse: text("peeked"),
+			Conditions: []db.Condition{cond(db.SourceQuery, "peek", db.Predicate{})}}},
+	}
+}
+
+// serveN calls GET /status n times, describing each answer as "status body".
+func serveN(mux http.Handler, n int) string {
+	var got []string
+	for i := 0; i < n; i++ {
+		status, body := call(mux, "GET", "/status", "", nil)
+		got = append(got, fmt.Sprintf("%d %s", status, strings.TrimSpace(body)))
+	}
+	return strings.Join(got, ", ")
+}
+
+func TestSequenceModes(t *testing.T) {
+	tests := []struct {
+		mode string
+		want string
+	}{
+		{"", "200 queued, 200 running, 201 done, 200 queued, 200 running"},
+		{db.SequenceCycle, "200 queued, 200 running, 201 done, 200 queued, 200 running"},
+		{db.SequenceStick, "200 queued, 200 running, 201 done, 201 done, 201 done"},
+		{db.SequenceFail, "200 queued, 200 running, 201 done, 500 mi6: response sequence exhausted, 500 mi6: response sequence exhausted"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			mux, err := buildRouter([]db.AgentPath{sequencePath(tt.mode)}, newAgentState())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := serveN(mux, 5); got != tt.want {
+				t.Errorf("got %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSequenceSurvivesReloads(t *testing.T) {
+	state := newAgentState()
+	mux, err := buildRouter([]db.AgentPath{sequencePath(db.SequenceFail)}, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serveN(mux, 1)
+
+	// A matching variant answers without moving the sequence on
+	if _, body := call(mux, "GET", "/status?peek", "", nil); body != "peeked" {
+		t.Fatalf("got %q, want the variant", body)
+	}
+	if mux, err = buildRouter([]db.AgentPath{sequencePath(db.SequenceFail)}, state); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := serveN(mux, 3), "200 running, 201 done, 500 mi6: response sequence exhausted"; got != want {
+		t.Errorf("after a reload got %s, want %s", got, want)
+	}
+	if calls := state.sequences.get(1); calls != 4 {
+		t.Errorf("counted %d calls, want 4", calls)
+	}
+
+	state.sequences.reset(1)
+	if got, want := serveN(mux, 1), "200 queued"; got != want {
+		t.Errorf("after a reset got %s, want %s", got, want)
+	}
+}
+
+func TestRegistrySequenceRequiresRunningAgent(t *testing.T) {
+	registry := newTestRegistry(t)
+	path := sequencePath("")
+	if _, err := registry.Sequence(42, &path); err == nil {
+		t.Error("expected the sequence of a stopped agent to be refused")
+	}
+	if err := registry.ResetSequence(42, path.Id); err == nil {
+		t.Error("expected resetting the sequence of a stopped agent to be refused")
+	}
+}
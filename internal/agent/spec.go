@@ -0,0 +1,101 @@
+package agent
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"mi6/internal/db"
+	"mi6/internal/openapi"
+)
+
+// validateRequests returns middleware checking requests against the agent's
+// OpenAPI spec. Violations are noted on the journal entry; in enforce mode,
+// the request is also answered with a 400 describing them.
+func validateRequests(v *openapi.Validator, mode string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			violations := v.Validate(r)
+			if len(violations) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			noteViolations(r, violations)
+			if mode == db.SpecLogOnly {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]any{
+				"error":      "mi6: request does not match the OpenAPI spec",
+				"violations": violations,
+			})
+		})
+	}
+}
+
+// specValidation loads the agent's spec, if it has one, as middleware for its router.
+func (r *Registry) specValidation(ctx context.Context, agentID int) (func(http.Handler) http.Handler, error) {
+	if r.SpecStore == nil {
+		return nil, nil
+	}
+	spec, err := r.SpecStore.GetAgentSpec(ctx, agentID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load agent spec: %w", err)
+	}
+
+	s, err := openapi.Parse([]byte(spec.Document))
+	if err != nil {
+		return nil, err
+	}
+	return validateRequests(s.Validator(), spec.Mode), nil
+}
+
+// Spec returns the spec attached to an agent.
+func (r *Registry) Spec(ctx context.Context, agentID int) (*db.AgentSpec, error) {
+	if r.SpecStore == nil {
+		return nil, fmt.Errorf("specs are not enabled")
+	}
+	return r.SpecStore.GetAgentSpec(ctx, agentID)
+}
+
+// AttachSpec stores an agent's spec, replacing any previous one, and starts
+// validating the requests of the running agent against it.
+func (r *Registry) AttachSpec(ctx context.Context, spec *db.AgentSpec) error {
+	if r.SpecStore == nil {
+		return fmt.Errorf("specs are not enabled")
+	}
+	if spec.Mode == "" {
+		spec.Mode = db.SpecEnforce
+	}
+	if spec.Mode != db.SpecEnforce && spec.Mode != db.SpecLogOnly {
+		return fmt.Errorf("unknown spec mode %q", spec.Mode)
+	}
+	if _, err := openapi.Parse([]byte(spec.Document)); err != nil {
+		return err
+	}
+
+	if err := r.SpecStore.SetAgentSpec(ctx, spec); err != nil {
+		return err
+	}
+	return r.ReloadAgent(ctx, spec.AgentID)
+}
+
+// DetachSpec removes an agent's spec and stops validating its requests.
+func (r *Registry) DetachSpec(ctx context.Context, agentID int) error {
+	if r.SpecStore == nil {
+		return fmt.Errorf("specs are not enabled")
+	}
+	if err := r.SpecStore.DeleteAgentSpec(ctx, agentID); err != nil {
+		return err
+	}
+	return r.ReloadAgent(ctx, agentID)
+}
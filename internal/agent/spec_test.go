@@ -0,0 +1,81 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"mi6/internal/db"
+	"mi6/internal/openapi"
+)
+
+const ordersSpec = `
+openapi: 3.0.3
+info: {title: Orders, version: "1"}
+paths:
+  /orders:
+    post:
+      parameters:
+        - {name: page, in: query, schema: {type: integer}}
+      requestBody:
+        content:
+          application/json:
+            schema: {type: object, required: [sku]}
+      responses: {"201": {description: created}}
+`
+
+func TestValidateRequests(t *testing.T) {
+	spec, err := openapi.Parse([]byte(ordersSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name, mode     string
+		target, body   string
+		wantStatus     int
+		wantViolations int
+	}{
+		{"enforce passes a valid request", db.SpecEnforce, "/orders?page=1", `{"sku": "A-1"}`, http.StatusOK, 0},
+		{"enforce rejects a bad parameter", db.SpecEnforce, "/orders?page=one", `{"sku": "A-1"}`, http.StatusBadRequest, 1},
+		{"enforce rejects a bad body", db.SpecEnforce, "/orders", `{}`, http.StatusBadRequest, 1},
+		{"enforce passes paths not in the spec", db.SpecEnforce, "/health", "", http.StatusOK, 0},
+		{"log only passes a bad parameter", db.SpecLogOnly, "/orders?page=one", `{"sku": "A-1"}`, http.StatusOK, 1},
+		{"log only passes a bad body", db.SpecLogOnly, "/orders", `[]`, http.StatusOK, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := NewRegistry(nil)
+			served := false
+			mock := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				served = true
+				w.Write([]byte("mocked"))
+			})
+			handler := registry.recordRequests(1)(validateRequests(spec.Validator(), tt.mode)(mock))
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest("POST", tt.target, strings.NewReader(tt.body)))
+			if rec.Code != tt.wantStatus || served != (tt.wantStatus == http.StatusOK) {
+				t.Fatalf("got %d, served %v; want %d", rec.Code, served, tt.wantStatus)
+			}
+			if rec.Code == http.StatusBadRequest {
+				var answer struct {
+					Error      string   `json:"error"`
+					Violations []string `json:"violations"`
+				}
+				if err := json.Unmarshal(rec.Body.Bytes(), &answer); err != nil || len(answer.Violations) != tt.wantViolations {
+					t.Errorf("got body %s, want the %d violations listed", rec.Body, tt.wantViolations)
+				}
+			}
+
+			entries := registry.journal(1).List(db.RequestFilter{})
+			if len(entries) != 1 || len(entries[0].Violations) != tt.wantViolations {
+				t.Fatalf("journaled %+v, want one entry with %d violations", entries, tt.wantViolations)
+			}
+			if entries[0].Status != rec.Code {
+				t.Errorf("journaled status %d, want %d", entries[0].Status, rec.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package agent
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"text/template"
+	"time"
+)
+
+// templateFuncs are the helpers available to templated responses.
+var templateFuncs = template.FuncMap{
+	// now formats the current time, as RFC 3339 unless a Go layout is given.
+	"now": func(layout ...string) string {
+		if len(layout) > 0 {
+			return time.Now().Format(layout[0])
+		}
+		return time.Now().Format(time.RFC3339)
+	},
+	"uuid":      newUUID,
+	"randomInt": randomInt,
+	// jsonPath extracts a value from a decoded JSON document such as .JSON.
+	"jsonPath": func(doc any, expr string) any {
+		v, _ := evalJSONPath(doc, expr)
+		return v
+	},
+	"toJSON": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"base64": func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	},
+	"base64Decode": func(s string) (string, error) {
+		b, err := base64.StdEncoding.DecodeString(s)
+		return string(b), err
+	},
+	// default returns def when v is empty, e.g. {{default "1" .Query.page}}.
+	"default": func(def, v any) any {
+		if v == nil || reflect.ValueOf(v).IsZero() {
+			return def
+		}
+		return v
+	},
+}
+
+// parseTemplate compiles a templated response body.
+func parseTemplate(name, body string) (*template.Template, error) {
+	return template.New(name).Funcs(templateFuncs).Option("missingkey=zero").Parse(body)
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// randomInt returns a random integer in [min, max].
+func randomInt(min, max int) (int, error) {
+	if max < min {
+		return 0, fmt.Errorf("randomInt: max %d is less than min %d", max, min)
+	}
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(max-min)+1))
+	if err != nil {
+		return 0, err
+	}
+	return min + int(n.Int64()), nil
+}
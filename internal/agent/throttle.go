@@ -0,0 +1,85 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"mi6/internal/db"
+)
+
+// ValidateThrottle checks that a throttle sets exactly one way of pacing the body.
+func ValidateThrottle(t *db.Throttle) error {
+	if t == nil {
+		return nil
+	}
+	if t.BytesPerSecond < 0 || t.ChunkSize < 0 || t.ChunkDelayMs < 0 {
+		return fmt.Errorf("throttle parameters must not be negative")
+	}
+	switch {
+	case t.BytesPerSecond > 0 && t.ChunkDelayMs > 0:
+		return fmt.Errorf("throttle takes either bytes_per_second or chunk_delay_ms, not both")
+	case t.BytesPerSecond == 0 && t.ChunkDelayMs == 0:
+		return fmt.Errorf("throttle needs bytes_per_second or chunk_delay_ms")
+	case t.ChunkDelayMs > 0 && t.ChunkSize == 0:
+		return fmt.Errorf("throttle chunk_delay_ms needs a chunk_size")
+	}
+	return nil
+}
+
+// throttledWriter dribbles a response body to the client: it writes one chunk
+// at a time, flushes it so the client really receives it, and pauses before
+// the next one. Writing stops early when the client goes away.
+type throttledWriter struct {
+	http.ResponseWriter
+	ctx   context.Context
+	chunk int
+	pause time.Duration
+}
+
+// newThrottledWriter wraps w according to t. A steady rate is approximated
+// with ten chunks a second unless a chunk size is given.
+func newThrottledWriter(w http.ResponseWriter, r *http.Request, t *db.Throttle) *throttledWriter {
+	tw := &throttledWriter{ResponseWriter: w, ctx: r.Context(), chunk: t.ChunkSize}
+	if t.BytesPerSecond > 0 {
+		if tw.chunk == 0 {
+			tw.chunk = max(t.BytesPerSecond/10, 1)
+		}
+		tw.pause = time.Duration(tw.chunk) * time.Second / time.Duration(t.BytesPerSecond)
+	} else {
+		tw.pause = time.Duration(t.ChunkDelayMs) * time.Millisecond
+	}
+	return tw
+}
+
+func (tw *throttledWriter) Write(p []byte) (int, error) {
+	rc := http.NewResponseController(tw.ResponseWriter)
+	written := 0
+	for written < len(p) {
+		if written > 0 {
+			timer := time.NewTimer(tw.pause)
+			select {
+			case <-timer.C:
+			case <-tw.ctx.Done():
+				timer.Stop()
+				return written, tw.ctx.Err()
+			}
+		}
+
+		end := min(written+tw.chunk, len(p))
+		n, err := tw.ResponseWriter.Write(p[written:end])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		rc.Flush()
+	}
+	return written, nil
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to
+// hijack the connection for a fault.
+func (tw *throttledWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
@@ -0,0 +1,128 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"mi6/internal/db"
+)
+
+func TestValidateThrottle(t *testing.T) {
+	tests := []struct {
+		name     string
+		throttle *db.Throttle
+		wantErr  string // Empty when the throttle is valid
+	}{
+		{"none", nil, ""},
+		{"steady rate", &db.Throttle{BytesPerSecond: 1024}, ""},
+		{"steady rate in set chunks", &db.Throttle{BytesPerSecond: 1024, ChunkSize: 64}, ""},
+		{"chunks", &db.Throttle{ChunkSize: 64, ChunkDelayMs: 100}, ""},
+		{"negative", &db.Throttle{BytesPerSecond: -1}, "must not be negative"},
+		{"both", &db.Throttle{BytesPerSecond: 1024, ChunkSize: 64, ChunkDelayMs: 100}, "not both"},
+		{"neither", &db.Throttle{ChunkSize: 64}, "needs bytes_per_second or chunk_delay_ms"},
+		{"chunk delay without size", &db.Throttle{ChunkDelayMs: 100}, "needs a chunk_size"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateThrottle(tt.throttle)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// chunkRecorder records the size of every write that reaches the client.
+type chunkRecorder struct {
+	*httptest.ResponseRecorder
+	chunks  []int
+	flushes int
+}
+
+func (c *chunkRecorder) Write(p []byte) (int, error) {
+	c.chunks = append(c.chunks, len(p))
+	return c.ResponseRecorder.Write(p)
+}
+
+func (c *chunkRecorder) Flush() {
+	c.flushes++
+	c.ResponseRecorder.Flush()
+}
+
+func TestThrottledWriterPacesBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		throttle    db.Throttle
+		size        int
+		wantChunks  []int
+		wantElapsed time.Duration // At least
+	}{
+		{"chunks", db.Throttle{ChunkSize: 4, ChunkDelayMs: 20}, 10, []int{4, 4, 2}, 40 * time.Millisecond},
+		{"steady rate", db.Throttle{BytesPerSecond: 1000}, 250, []int{100, 100, 50}, 200 * time.Millisecond},
+		{"steady rate in set chunks", db.Throttle{BytesPerSecond: 1000, ChunkSize: 50}, 150, []int{50, 50, 50}, 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateThrottle(&tt.throttle); err != nil {
+				t.Fatal(err)
+			}
+			rec := &chunkRecorder{ResponseRecorder: httptest.NewRecorder()}
+			tw := newThrottledWriter(rec, httptest.NewRequest("GET", "/", nil), &tt.throttle)
+
+			body := strings.Repeat("x", tt.size)
+			start := time.Now()
+			n, err := tw.Write([]byte(body))
+			elapsed := time.Since(start)
+			if err != nil || n != tt.size || rec.Body.String() != body {
+				t.Fatalf("wrote %d bytes, %v; want all %d", n, err, tt.size)
+			}
+			if !slices.Equal(rec.chunks, tt.wantChunks) || rec.flushes != len(tt.wantChunks) {
+				t.Errorf("got chunks %v with %d flushes, want %v each flushed", rec.chunks, rec.flushes, tt.wantChunks)
+			}
+			if elapsed < tt.wantElapsed {
+				t.Errorf("took %v, want at least %v", elapsed, tt.wantElapsed)
+			}
+		})
+	}
+}
+
+func TestThrottledWriterStopsWhenClientLeaves(t *testing.T) {
+	written := make(chan error, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tw := newThrottledWriter(w, r, &db.Throttle{ChunkSize: 1, ChunkDelayMs: 50})
+		_, err := tw.Write([]byte(strings.Repeat("x", 1000))) // 50s if written in full
+		written <- err
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(resp.Body, make([]byte, 1)); err != nil {
+		t.Fatalf("reading the first chunk: %v", err)
+	}
+	cancel()
+	resp.Body.Close()
+
+	select {
+	case err := <-written:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("got %v, want the write cancelled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the writer kept going after the client left")
+	}
+}
@@ -0,0 +1,168 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"mi6/internal/db"
+)
+
+// maxNearMisses caps how many almost-matching requests a failed verification reports.
+const maxNearMisses = 5
+
+// RequestMatcher selects journaled requests. Unset fields match everything.
+type RequestMatcher struct {
+	Method      string         `json:"method,omitempty"`
+	Path        string         `json:"path,omitempty"`         // Exact URL path, without the query string
+	PathPattern string         `json:"path_pattern,omitempty"` // Regular expression on the URL path
+	Conditions  []db.Condition `json:"conditions,omitempty"`
+}
+
+// CountConstraint bounds how many requests must match. With nothing set, at least one is required.
+type CountConstraint struct {
+	Exactly *int `json:"exactly,omitempty"`
+	AtLeast *int `json:"at_least,omitempty"`
+	AtMost  *int `json:"at_most,omitempty"`
+}
+
+// VerifyRequest is the body of POST /agents/{agentID}/verify.
+type VerifyRequest struct {
+	Request RequestMatcher  `json:"request"`
+	Count   CountConstraint `json:"count"`
+}
+
+// NearMiss is a received request that failed only some of the matcher's criteria.
+type NearMiss struct {
+	Request    db.RequestEntry `json:"request"`
+	Mismatches []string        `json:"mismatches"`
+}
+
+// VerifyResult reports whether the agent received the expected requests.
+type VerifyResult struct {
+	Passed     bool       `json:"passed"`
+	Count      int        `json:"count"`
+	Expected   string     `json:"expected"`
+	NearMisses []NearMiss `json:"near_misses"`
+}
+
+// Validate checks the matcher's patterns and conditions.
+func (v VerifyRequest) Validate() error {
+	if v.Request.PathPattern != "" {
+		if _, err := compileRegexp(v.Request.PathPattern); err != nil {
+			return fmt.Errorf("invalid path_pattern: %w", err)
+		}
+	}
+	for _, c := range v.Request.Conditions {
+		if err := ValidateCondition(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mismatches lists every criterion of the matcher the entry fails.
+func (m RequestMatcher) mismatches(e db.RequestEntry) []string {
+	var failed []string
+	path, _, _ := strings.Cut(e.URL, "?")
+
+	if m.Method != "" && !strings.EqualFold(m.Method, e.Method) {
+		failed = append(failed, fmt.Sprintf("method is %s, expected %s", e.Method, strings.ToUpper(m.Method)))
+	}
+	if m.Path != "" && path != m.Path {
+		failed = append(failed, fmt.Sprintf("path is %s, expected %s", path, m.Path))
+	}
+	if m.PathPattern != "" {
+		if re, err := compileRegexp(m.PathPattern); err != nil || !re.MatchString(path) {
+			failed = append(failed, fmt.Sprintf("path %s does not match %q", path, m.PathPattern))
+		}
+	}
+
+	view := viewOfEntry(e)
+	for _, c := range m.Conditions {
+		if ok, reason := checkCondition(c, view); !ok {
+			failed = append(failed, reason)
+		}
+	}
+	return failed
+}
+
+// criteria counts the checks the matcher performs.
+func (m RequestMatcher) criteria() int {
+	n := len(m.Conditions)
+	for _, set := range []bool{m.Method != "", m.Path != "", m.PathPattern != ""} {
+		if set {
+			n++
+		}
+	}
+	return n
+}
+
+// check tests a count against the constraint and describes the expectation.
+func (c CountConstraint) check(count int) (bool, string) {
+	if c.Exactly != nil {
+		return count == *c.Exactly, fmt.Sprintf("exactly %d", *c.Exactly)
+	}
+	if c.AtLeast == nil && c.AtMost == nil {
+		return count >= 1, "at least 1"
+	}
+
+	ok := true
+	var parts []string
+	if c.AtLeast != nil {
+		ok = ok && count >= *c.AtLeast
+		parts = append(parts, fmt.Sprintf("at least %d", *c.AtLeast))
+	}
+	if c.AtMost != nil {
+		ok = ok && count <= *c.AtMost
+		parts = append(parts, fmt.Sprintf("at most %d", *c.AtMost))
+	}
+	return ok, strings.Join(parts, " and ")
+}
+
+// Verify evaluates a verification against a list of received requests.
+// Near misses are only reported when the verification fails.
+func Verify(entries []db.RequestEntry, v VerifyRequest) VerifyResult {
+	var count int
+	var misses []NearMiss
+	total := v.Request.criteria()
+
+	for _, e := range entries {
+		failed := v.Request.mismatches(e)
+		switch {
+		case len(failed) == 0:
+			count++
+		case len(failed) < total:
+			misses = append(misses, NearMiss{Request: e, Mismatches: failed})
+		}
+	}
+
+	passed, expected := v.Count.check(count)
+	result := VerifyResult{Passed: passed, Count: count, Expected: expected, NearMisses: []NearMiss{}}
+	if passed {
+		return result
+	}
+
+	// Closest first; among equally close requests, the most recent first.
+	sort.SliceStable(misses, func(i, j int) bool {
+		if len(misses[i].Mismatches) != len(misses[j].Mismatches) {
+			return len(misses[i].Mismatches) < len(misses[j].Mismatches)
+		}
+		return misses[i].Request.Id > misses[j].Request.Id
+	})
+	if len(misses) > maxNearMisses {
+		misses = misses[:maxNearMisses]
+	}
+	result.NearMisses = misses
+	return result
+}
+
+// Verify checks an agent's received-request history against a verification request.
+func (r *Registry) Verify(ctx context.Context, agentID int, v VerifyRequest) (VerifyResult, error) {
+	entries, err := r.Requests(ctx, agentID, db.RequestFilter{})
+	if err != nil {
+		return VerifyResult{}, err
+	}
+	return Verify(entries, v), nil
+}
@@ -0,0 +1,113 @@
+package agent
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"mi6/internal/db"
+)
+
+func intPtr(n int) *int { return &n }
+
+func strPtr(s string) *string { return &s }
+
+func TestVerify(t *testing.T) {
+	entries := []db.RequestEntry{
+		{Id: 1, Method: "GET", URL: "/users/1?expand=true", Headers: http.Header{"Accept": {"application/json"}}},
+		{Id: 2, Method: "POST", URL: "/users", Body: `{"name":"ada","roles":["admin"]}`},
+		{Id: 3, Method: "GET", URL: "/users/2"},
+	}
+	tests := []struct {
+		name       string
+		verify     VerifyRequest
+		wantPassed bool
+		wantCount  int
+		wantMisses int
+	}{
+		{
+			name:       "any request at least once",
+			verify:     VerifyRequest{},
+			wantPassed: true, wantCount: 3,
+		},
+		{
+			name:       "method and exact path",
+			verify:     VerifyRequest{Request: RequestMatcher{Method: "post", Path: "/users"}},
+			wantPassed: true, wantCount: 1,
+		},
+		{
+			name:       "path pattern exactly twice",
+			verify:     VerifyRequest{Request: RequestMatcher{PathPattern: `^/users/\d+$`}, Count: CountConstraint{Exactly: intPtr(2)}},
+			wantPassed: true, wantCount: 2,
+		},
+		{
+			name: "query and header conditions",
+			verify: VerifyRequest{Request: RequestMatcher{Conditions: []db.Condition{
+				{Source: db.SourceQuery, Key: "expand", Predicate: db.Predicate{Equals: strPtr("true")}},
+				{Source: db.SourceHeader, Key: "Accept", Predicate: db.Predicate{Contains: "json"}},
+			}}},
+			wantPassed: true, wantCount: 1,
+		},
+		{
+			name: "JSONPath body condition",
+			verify: VerifyRequest{Request: RequestMatcher{Conditions: []db.Condition{
+				{Source: db.SourceBody, Key: "$.roles[0]", Predicate: db.Predicate{Equals: strPtr("admin")}},
+			}}},
+			wantPassed: true, wantCount: 1,
+		},
+		{
+			name:       "at most bound exceeded",
+			verify:     VerifyRequest{Request: RequestMatcher{Method: "GET"}, Count: CountConstraint{AtMost: intPtr(1)}},
+			wantPassed: false, wantCount: 2, wantMisses: 0,
+		},
+		{
+			name:       "no match reports near misses",
+			verify:     VerifyRequest{Request: RequestMatcher{Method: "DELETE", Path: "/users/1"}},
+			wantPassed: false, wantCount: 0, wantMisses: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.verify.Validate(); err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			got := Verify(entries, tt.verify)
+			if got.Passed != tt.wantPassed || got.Count != tt.wantCount || len(got.NearMisses) != tt.wantMisses {
+				t.Errorf("got passed=%v count=%d near misses=%d, want %v %d %d",
+					got.Passed, got.Count, len(got.NearMisses), tt.wantPassed, tt.wantCount, tt.wantMisses)
+			}
+		})
+	}
+}
+
+func TestVerifyRequestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		verify VerifyRequest
+	}{
+		{"bad path pattern", VerifyRequest{Request: RequestMatcher{PathPattern: "("}}},
+		{"query without key", VerifyRequest{Request: RequestMatcher{Conditions: []db.Condition{{Source: db.SourceQuery}}}}},
+		{"unknown source", VerifyRequest{Request: RequestMatcher{Conditions: []db.Condition{{Source: "cookie", Key: "a"}}}}},
+		{"bad JSONPath", VerifyRequest{Request: RequestMatcher{Conditions: []db.Condition{{Source: db.SourceBody, Key: "$.a["}}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.verify.Validate(); err == nil {
+				t.Error("expected a validation error")
+			}
+		})
+	}
+}
+
+func TestRegexpCacheIsBounded(t *testing.T) {
+	for i := 0; i < 3*maxCachedRegexps; i++ {
+		if _, err := compileRegexp(fmt.Sprintf("^/client/%d$", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	regexps.Lock()
+	defer regexps.Unlock()
+	if n := len(regexps.m); n > maxCachedRegexps {
+		t.Errorf("cache holds %d patterns, more than %d", n, maxCachedRegexps)
+	}
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"mi6/internal/config"
+)
+
+// ApplyResult reports the changes an apply made, or would make on a dry run.
+type ApplyResult struct {
+	DryRun bool `json:"dry_run"`
+	*config.Plan
+}
+
+// Apply reconciles the agents with a YAML or JSON document sent as the
+// request body. With ?dry_run=true, the changes are only reported; with
+// ?prune=true, agents the document does not declare are deleted.
+func (h *Handlers) Apply(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxImportSize))
+	if err != nil {
+		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+	doc, err := config.Parse(data, "request body")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error parsing document: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	q := r.URL.Query()
+	plan, err := config.Diff(r.Context(), h.Repo, doc, config.Options{Prune: q.Get("prune") == "true"})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error planning changes: %v", err), http.StatusBadRequest)
+		return
+	}
+	result := ApplyResult{DryRun: q.Get("dry_run") == "true", Plan: plan}
+	if !result.DryRun {
+		if err := plan.Apply(r.Context(), h.Repo); err != nil {
+			http.Error(w, fmt.Sprintf("Error applying changes: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// GetWatch reports the outcome of the last sync of the watched directory of
+// agent documents.
+func (h *Handlers) GetWatch(w http.ResponseWriter, r *http.Request) {
+	if h.Watcher == nil {
+		http.Error(w, "No directory is being watched; start MI6 with -watch", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.Watcher.Status())
+}
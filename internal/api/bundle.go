@@ -0,0 +1,82 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"mi6/internal/bundle"
+)
+
+// ExportBundle sends every agent, or those picked with ?agent= (repeatable),
+// as a bundle: a zip archive that ImportBundle, on this or another MI6, turns
+// back into the same agents.
+func (h *Handlers) ExportBundle(w http.ResponseWriter, r *http.Request) {
+	var opts bundle.ExportOptions
+	for _, s := range r.URL.Query()["agent"] {
+		id, err := strconv.Atoi(s)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid agent ID %q", s), http.StatusBadRequest)
+			return
+		}
+		opts.AgentIDs = append(opts.AgentIDs, id)
+	}
+
+	var buf bytes.Buffer
+	if _, err := bundle.Export(r.Context(), h.Repo, h.Mgr.SpecStore, &buf, opts); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, bundle.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, fmt.Sprintf("Error exporting agents: %v", err), status)
+		return
+	}
+
+	name := "mi6-" + time.Now().UTC().Format("20060102-150405") + ".zip"
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, name))
+	w.Write(buf.Bytes())
+}
+
+// ImportBundle creates the agents of a bundle sent as the request body.
+// ?conflict= picks what happens to agents whose name or port is taken: skip
+// (the default), overwrite, rename or reassign-port.
+func (h *Handlers) ImportBundle(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxImportSize))
+	if err != nil {
+		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+	opts := bundle.ImportOptions{Conflict: r.URL.Query().Get("conflict")}
+	if err := opts.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	m, err := bundle.Read(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading bundle: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	result, err := bundle.Import(r.Context(), h.Repo, h.Mgr.SpecStore, m, opts)
+	if result == nil {
+		http.Error(w, fmt.Sprintf("Error importing bundle: %v", err), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		// The agents handled before the failure stay imported: report them with it
+		w.WriteHeader(storeErrorStatus(err))
+		json.NewEncoder(w).Encode(struct {
+			*bundle.ImportResult
+			Error string `json:"error"`
+		}{result, fmt.Sprintf("Error importing bundle: %v", err)})
+		return
+	}
+	json.NewEncoder(w).Encode(result)
+}
@@ -2,19 +2,21 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"syscall"
 
+	"mi6/internal/agent"
 	"mi6/internal/db"
 	"mi6/web/template"
 )
 
 // --- Request/Response DTOs ---
 
-// NewAgentRequest structure for POST /agents
+// NewAgentRequest structure for POST /agents: the agent's settings plus its paths
 type NewAgentRequest struct {
-	Name string `json:"name"`
-	Port string `json:"port"`
+	db.Agent
 	Paths []db.AgentPath `json:"paths"`
 }
 
@@ -53,15 +55,24 @@ func (h *Handlers) CreateAgent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 1. Validate paths have AgentID 0, since it's a new agent
+	// 1. Validate the agent's settings and paths; paths have AgentID 0, since it's a new agent
+	newAgent := &req.Agent
+	if err := agent.ValidateAgent(newAgent); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	for i := range req.Paths {
 		req.Paths[i].AgentID = 0
+		if err := agent.ValidatePath(&req.Paths[i]); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 	}
 
 	// 2. Create Agent and Paths via Repository
-	agentID, err := h.Repo.CreateAgent(r.Context(), req.Name, req.Port, req.Paths)
+	agentID, err := h.Repo.CreateAgent(r.Context(), newAgent, req.Paths)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error creating agent: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Error creating agent: %v", err), storeErrorStatus(err))
 		return
 	}
 
@@ -157,3 +168,102 @@ func (h *Handlers) StopAgent(w http.ResponseWriter, r *http.Request) {
     w.WriteHeader(http.StatusOK)
     template.AgentRow(updatedAgent).Render(r.Context(), w)
 }
+
+// UpdateAgent handles PUT (full replacement) and PATCH (partial update) of an agent's settings.
+// A running agent whose port changes is moved to the new port right away; if that port is
+// in use, the agent stays where it was and the update is refused.
+func (h *Handlers) UpdateAgent(w http.ResponseWriter, r *http.Request) {
+	current, ok := r.Context().Value(keyAgent).(*db.Agent)
+	if !ok {
+		http.Error(w, http.StatusText(422), 422)
+		return
+	}
+
+	var updated db.Agent
+	if err := decodeUpdate(r, current, &updated); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	updated.Id, updated.Status = current.Id, current.Status
+
+	if updated.Name == "" || updated.Port == "" {
+		http.Error(w, "Agent name and port are required", http.StatusBadRequest)
+		return
+	}
+	if err := agent.ValidateAgent(&updated); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Repo.UpdateAgent(r.Context(), &updated); err != nil {
+		http.Error(w, fmt.Sprintf("Error updating agent: %v", err), storeErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// DeleteAgent removes an agent and its paths. A running agent is only deleted
+// when ?force=true is given, in which case it is stopped first.
+func (h *Handlers) DeleteAgent(w http.ResponseWriter, r *http.Request) {
+	agent, ok := r.Context().Value(keyAgent).(*db.Agent)
+	if !ok {
+		http.Error(w, http.StatusText(422), 422)
+		return
+	}
+
+	// With ?force=true, the repository stops the running agent before
+	// deleting it.
+	if h.Mgr.IsRunning(agent.Id) && r.URL.Query().Get("force") != "true" {
+		http.Error(w, fmt.Sprintf("agent %d is running; stop it first or pass ?force=true", agent.Id), http.StatusConflict)
+		return
+	}
+
+	if err := h.Repo.DeleteAgent(r.Context(), agent.Id); err != nil {
+		http.Error(w, fmt.Sprintf("Error deleting agent: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// storeErrorStatus is the status a failed repository write is reported with:
+// 409 Conflict when it clashes with an existing name, port or path, or when a
+// running agent cannot move to a port another process holds.
+func storeErrorStatus(err error) int {
+	if db.IsConflict(err) || errors.Is(err, syscall.EADDRINUSE) {
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// decodeUpdate decodes a PUT or PATCH body into dst. PUT replaces the resource
+// outright; PATCH replaces only the top-level fields present in the body and
+// keeps the rest of current.
+func decodeUpdate(r *http.Request, current, dst any) error {
+	if r.Method != http.MethodPatch {
+		return json.NewDecoder(r.Body).Decode(dst)
+	}
+
+	var patch map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		return err
+	}
+	stored, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	merged := map[string]json.RawMessage{}
+	if err := json.Unmarshal(stored, &merged); err != nil {
+		return err
+	}
+	for field, value := range patch {
+		merged[field] = value
+	}
+	body, err := json.Marshal(merged)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, dst)
+}
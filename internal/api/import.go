@@ -0,0 +1,154 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"mi6/internal/db"
+	"mi6/internal/importer"
+)
+
+// maxImportSize caps the size of uploaded specifications and archives.
+const maxImportSize = 32 << 20
+
+// importErrorStatus returns the status for an import error: 409 or 500 when
+// the agent could not be stored, 400 when the upload was the problem.
+func importErrorStatus(err error) int {
+	var storeErr *importer.StoreError
+	if errors.As(err, &storeErr) {
+		return storeErrorStatus(err)
+	}
+	return http.StatusBadRequest
+}
+
+// ImportOpenAPI creates an agent from an OpenAPI 3 or Swagger 2 document sent
+// as the request body, in JSON or YAML. The agent's port is given as ?port=,
+// and its name as ?name=, defaulting to the API's title.
+func (h *Handlers) ImportOpenAPI(w http.ResponseWriter, r *http.Request) {
+	spec, err := io.ReadAll(io.LimitReader(r.Body, maxImportSize))
+	if err != nil {
+		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	a := &db.Agent{Name: r.URL.Query().Get("name"), Port: r.URL.Query().Get("port")}
+	result, err := importer.OpenAPI(r.Context(), h.Repo, a, spec)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error importing specification: %v", err), importErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(result)
+}
+
+// harOptions reads the HAR import options from the query string: ?host= and
+// ?mime= (both repeatable) and ?duplicates=first|last|all.
+func harOptions(r *http.Request) importer.HAROptions {
+	q := r.URL.Query()
+	return importer.HAROptions{Hosts: q["host"], MimeTypes: q["mime"], Duplicates: q.Get("duplicates")}
+}
+
+// ImportHAR creates an agent from the entries of a HAR file sent as the
+// request body. The agent's name and port are given as ?name= and ?port=.
+func (h *Handlers) ImportHAR(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxImportSize))
+	if err != nil {
+		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	a := &db.Agent{Name: r.URL.Query().Get("name"), Port: r.URL.Query().Get("port")}
+	result, err := importer.HAR(r.Context(), h.Repo, a, data, harOptions(r))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error importing HAR file: %v", err), importErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(result)
+}
+
+// ImportHARInto adds the entries of a HAR file sent as the request body to
+// the agent. Paths the agent already mocks are skipped.
+func (h *Handlers) ImportHARInto(w http.ResponseWriter, r *http.Request) {
+	a := r.Context().Value(keyAgent).(*db.Agent)
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxImportSize))
+	if err != nil {
+		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	result, err := importer.HARInto(r.Context(), h.Repo, a.Id, data, harOptions(r))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error importing HAR file: %v", err), importErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// ImportWireMock creates an agent from WireMock stub mappings sent as the
+// request body: either a zip archive of a WireMock root directory, holding
+// mappings/ and __files/, or the mappings as one JSON document. The agent's
+// name and port are given as ?name= and ?port=. The result lists the
+// features the agent could not reproduce under "unsupported".
+func (h *Handlers) ImportWireMock(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxImportSize))
+	if err != nil {
+		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	a := &db.Agent{Name: r.URL.Query().Get("name"), Port: r.URL.Query().Get("port")}
+	var result *importer.Result
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		var archive *zip.Reader
+		archive, err = zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err == nil {
+			result, err = importer.WireMock(r.Context(), h.Repo, a, archive)
+		}
+	} else {
+		result, err = importer.WireMockStubs(r.Context(), h.Repo, a, data)
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error importing WireMock mappings: %v", err), importErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(result)
+}
+
+// ImportMockoon creates an agent from a Mockoon environment file sent as the
+// request body. The agent's name and port default to the environment's, and
+// can be overridden with ?name= and ?port=. Body files cannot be uploaded
+// along with it; use the import command for those.
+func (h *Handlers) ImportMockoon(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxImportSize))
+	if err != nil {
+		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	a := &db.Agent{Name: r.URL.Query().Get("name"), Port: r.URL.Query().Get("port")}
+	result, err := importer.Mockoon(r.Context(), h.Repo, a, data, nil)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error importing Mockoon environment: %v", err), importErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(result)
+}
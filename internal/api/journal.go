@@ -0,0 +1,105 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"mi6/internal/agent"
+	"mi6/internal/db"
+)
+
+// ListRequests returns the requests an agent has received. Supported query
+// filters: method, path, path_id, status, since (RFC 3339) and limit.
+func (h *Handlers) ListRequests(w http.ResponseWriter, r *http.Request) {
+	a := r.Context().Value(keyAgent).(*db.Agent)
+
+	filter, err := parseRequestFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entries, err := h.Mgr.Requests(r.Context(), a.Id, filter)
+	if err != nil {
+		http.Error(w, "Error listing requests", http.StatusInternalServerError)
+		return
+	}
+	if entries == nil {
+		entries = []db.RequestEntry{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(entries); err != nil {
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+	}
+}
+
+// ClearRequests empties an agent's request journal.
+func (h *Handlers) ClearRequests(w http.ResponseWriter, r *http.Request) {
+	a := r.Context().Value(keyAgent).(*db.Agent)
+
+	if err := h.Mgr.ClearRequests(r.Context(), a.Id); err != nil {
+		http.Error(w, fmt.Sprintf("Error clearing requests: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseRequestFilter builds a journal filter from the request's query string.
+func parseRequestFilter(r *http.Request) (db.RequestFilter, error) {
+	q := r.URL.Query()
+	filter := db.RequestFilter{
+		Method: q.Get("method"),
+		Path:   q.Get("path"),
+	}
+
+	ints := map[string]*int{"path_id": &filter.PathID, "status": &filter.Status, "limit": &filter.Limit}
+	for name, dst := range ints {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s %q", name, v)
+			}
+			*dst = n
+		}
+	}
+
+	if v := q.Get("since"); v != "" {
+		since, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return filter, fmt.Errorf("invalid since %q: expected RFC 3339", v)
+		}
+		filter.Since = since
+	}
+	return filter, nil
+}
+
+// VerifyRequests checks how many times the agent received requests matching a pattern.
+func (h *Handlers) VerifyRequests(w http.ResponseWriter, r *http.Request) {
+	a := r.Context().Value(keyAgent).(*db.Agent)
+
+	var req agent.VerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.Mgr.Verify(r.Context(), a.Id, req)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error verifying requests: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"mi6/internal/agent"
+	"mi6/internal/db"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const keyPath AgentContextKey = "path"
+
+// PathCtx loads the path named by {pathID} for the agent already in the context.
+func (h *Handlers) PathCtx(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agent := r.Context().Value(keyAgent).(*db.Agent)
+
+		pathID, err := strconv.Atoi(chi.URLParam(r, "pathID"))
+		if err != nil {
+			http.Error(w, "Invalid Path ID", http.StatusBadRequest)
+			return
+		}
+
+		path, err := h.Repo.GetAgentPath(r.Context(), agent.Id, pathID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				http.Error(w, http.StatusText(404), 404)
+				return
+			}
+			http.Error(w, http.StatusText(500), 500)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), keyPath, path)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (h *Handlers) ListPaths(w http.ResponseWriter, r *http.Request) {
+	a := r.Context().Value(keyAgent).(*db.Agent)
+
+	paths, err := h.Repo.GetAgentPaths(r.Context(), a.Id)
+	if err != nil {
+		http.Error(w, "Error listing paths", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(paths); err != nil {
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+	}
+}
+
+func (h *Handlers) GetPath(w http.ResponseWriter, r *http.Request) {
+	path := r.Context().Value(keyPath).(*db.AgentPath)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(path); err != nil {
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+	}
+}
+
+func (h *Handlers) AddPath(w http.ResponseWriter, r *http.Request) {
+	a := r.Context().Value(keyAgent).(*db.Agent)
+
+	var path db.AgentPath
+	if err := json.NewDecoder(r.Body).Decode(&path); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	if err := agent.ValidatePath(&path); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	pathID, err := h.Repo.AddPath(r.Context(), a.Id, path)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error adding path: %v", err), storeErrorStatus(err))
+		return
+	}
+	path.Id, path.AgentID = pathID, a.Id
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(path)
+}
+
+// UpdatePath handles PUT (full replacement) and PATCH (partial update) of a path.
+func (h *Handlers) UpdatePath(w http.ResponseWriter, r *http.Request) {
+	current := r.Context().Value(keyPath).(*db.AgentPath)
+
+	var path db.AgentPath
+	if err := decodeUpdate(r, current, &path); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	path.Id, path.AgentID = current.Id, current.AgentID
+	if err := agent.ValidatePath(&path); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Repo.UpdatePath(r.Context(), path); err != nil {
+		http.Error(w, fmt.Sprintf("Error updating path: %v", err), storeErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(path)
+}
+
+func (h *Handlers) DeletePath(w http.ResponseWriter, r *http.Request) {
+	path := r.Context().Value(keyPath).(*db.AgentPath)
+
+	if err := h.Repo.DeletePath(r.Context(), path.AgentID, path.Id); err != nil {
+		http.Error(w, fmt.Sprintf("Error deleting path: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetSequence reports how far the path's response sequence has progressed.
+func (h *Handlers) GetSequence(w http.ResponseWriter, r *http.Request) {
+	a := r.Context().Value(keyAgent).(*db.Agent)
+	path := r.Context().Value(keyPath).(*db.AgentPath)
+
+	status, err := h.Mgr.Sequence(a.Id, path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+	}
+}
+
+// ResetSequence rewinds the path's response sequence to its first entry.
+func (h *Handlers) ResetSequence(w http.ResponseWriter, r *http.Request) {
+	a := r.Context().Value(keyAgent).(*db.Agent)
+	path := r.Context().Value(keyPath).(*db.AgentPath)
+
+	if err := h.Mgr.ResetSequence(a.Id, path.Id); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	h.GetSequence(w, r)
+}
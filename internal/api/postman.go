@@ -0,0 +1,100 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+
+	"mi6/internal/db"
+	"mi6/internal/importer"
+	"mi6/internal/postman"
+)
+
+// postmanUpload is the request body of a Postman import: either a collection
+// by itself, or wrapped together with an environment.
+func postmanUpload(r *http.Request) (collection, environment []byte, err error) {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxImportSize))
+	if err != nil {
+		return nil, nil, err
+	}
+	var envelope struct {
+		Collection  json.RawMessage `json:"collection"`
+		Environment json.RawMessage `json:"environment"`
+	}
+	if json.Unmarshal(data, &envelope) == nil && len(envelope.Collection) > 0 {
+		if string(envelope.Environment) == "null" {
+			envelope.Environment = nil
+		}
+		return envelope.Collection, envelope.Environment, nil
+	}
+	return data, nil, nil
+}
+
+// ImportPostman creates an agent from a Postman collection sent as the
+// request body, or as {"collection": ..., "environment": ...} to resolve
+// variables from an environment. The agent's port is given as ?port=, and
+// its name as ?name=, defaulting to the collection's.
+func (h *Handlers) ImportPostman(w http.ResponseWriter, r *http.Request) {
+	collection, environment, err := postmanUpload(r)
+	if err != nil {
+		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	a := &db.Agent{Name: r.URL.Query().Get("name"), Port: r.URL.Query().Get("port")}
+	result, err := importer.Postman(r.Context(), h.Repo, a, collection, environment)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error importing collection: %v", err), importErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(result)
+}
+
+// ImportPostmanInto adds the requests of a Postman collection to the agent.
+// Paths the agent already mocks are skipped.
+func (h *Handlers) ImportPostmanInto(w http.ResponseWriter, r *http.Request) {
+	a := r.Context().Value(keyAgent).(*db.Agent)
+
+	collection, environment, err := postmanUpload(r)
+	if err != nil {
+		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	result, err := importer.PostmanInto(r.Context(), h.Repo, a.Id, collection, environment)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error importing collection: %v", err), importErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+var unsafeFileName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// ExportPostman downloads the agent as a Postman collection targeting it on
+// localhost.
+func (h *Handlers) ExportPostman(w http.ResponseWriter, r *http.Request) {
+	a := r.Context().Value(keyAgent).(*db.Agent)
+
+	paths, err := h.Repo.GetAgentPaths(r.Context(), a.Id)
+	if err != nil {
+		http.Error(w, "Error listing paths", http.StatusInternalServerError)
+		return
+	}
+
+	name := unsafeFileName.ReplaceAllString(a.Name, "_")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.postman_collection.json"`, name))
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(postman.Export(a, paths)); err != nil {
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+	}
+}
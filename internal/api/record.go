@@ -0,0 +1,73 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"mi6/internal/agent"
+	"mi6/internal/db"
+)
+
+// GetRecording reports whether the agent is recording and how much it has captured.
+func (h *Handlers) GetRecording(w http.ResponseWriter, r *http.Request) {
+	a := r.Context().Value(keyAgent).(*db.Agent)
+
+	status, err := h.Mgr.Recording(a.Id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+	}
+}
+
+// StartRecording switches a running agent to record mode.
+func (h *Handlers) StartRecording(w http.ResponseWriter, r *http.Request) {
+	a := r.Context().Value(keyAgent).(*db.Agent)
+
+	if err := h.Mgr.StartRecording(r.Context(), a.Id); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	h.GetRecording(w, r)
+}
+
+// StopRecording puts a running agent back to serving its mocks.
+func (h *Handlers) StopRecording(w http.ResponseWriter, r *http.Request) {
+	a := r.Context().Value(keyAgent).(*db.Agent)
+
+	if err := h.Mgr.StopRecording(r.Context(), a.Id); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	h.GetRecording(w, r)
+}
+
+// Snapshot turns the recorded exchanges into mock paths. The body, optional,
+// holds the snapshot options, e.g. {"dedupe": true}.
+func (h *Handlers) Snapshot(w http.ResponseWriter, r *http.Request) {
+	a := r.Context().Value(keyAgent).(*db.Agent)
+
+	var opts agent.SnapshotOptions
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.Mgr.Snapshot(r.Context(), a.Id, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(result)
+}
@@ -8,6 +8,7 @@ import (
 	"strconv"
 
 	"mi6/internal/agent"
+	"mi6/internal/config"
 	"mi6/internal/db"
 	"mi6/internal/web" // NEW: Import the web handlers
 
@@ -25,20 +26,24 @@ type Handlers struct {
 	Mgr  *agent.Registry
 	Repo db.AgentRepository
     Web *web.Handlers // NEW: Web Handlers dependency
+	Watcher *config.Watcher // Set when a directory of agent documents is watched
 }
 
-// NewRouter sets up the Chi router and API routes.
-func NewRouter(mgr *agent.Registry) http.Handler {
+// NewRouter sets up the Chi router and API routes. watcher is the watcher of
+// a directory of agent documents, or nil.
+func NewRouter(mgr *agent.Registry, watcher *config.Watcher) http.Handler {
 	repo := mgr.Repo
 
 	// Instantiate Web Handlers
 	webH := web.NewHandlers(repo)
+	webH.Watcher = watcher
 
 	// Handlers struct holds all dependencies
 	h := &Handlers{
 		Mgr:  mgr,
 		Repo: repo,
         Web:  webH,
+		Watcher: watcher,
 	}
 
 	r := chi.NewRouter()
@@ -54,21 +59,75 @@ func NewRouter(mgr *agent.Registry) http.Handler {
     // 2. Web UI Routes (Renders HTML pages/fragments)
     r.Get("/", h.Web.DashboardPage)
     r.Get("/ui/agents", h.Web.AgentTableFragment) // HTMX endpoint for table updates
+    r.Get("/ui/watch", h.Web.WatchFragment)
 
 	// 3. API Routes (Remain mostly JSON, but Start/Stop return HTML fragments for HTMX)
 	r.Route("/agents", func(r chi.Router) {
 		r.Get("/", h.ListAgents)
 		r.Post("/", h.CreateAgent)
+		r.Post("/import/openapi", h.ImportOpenAPI)
+		r.Post("/import/har", h.ImportHAR)
+		r.Post("/import/postman", h.ImportPostman)
+		r.Post("/import/wiremock", h.ImportWireMock)
+		r.Post("/import/mockoon", h.ImportMockoon)
 
 		r.Route("/{agentID}", func(r chi.Router) {
 			r.Use(h.AgentCtx)
 			r.Get("/", h.GetAgent)
+			r.Put("/", h.UpdateAgent)
+			r.Patch("/", h.UpdateAgent)
+			r.Delete("/", h.DeleteAgent)
             // THESE NOW RETURN HTML FRAGMENTS
 			r.Post("/start", h.StartAgent)
 			r.Post("/stop", h.StopAgent)
+
+			r.Get("/requests", h.ListRequests)
+			r.Delete("/requests", h.ClearRequests)
+			r.Post("/verify", h.VerifyRequests)
+
+			r.Get("/scenarios", h.ListScenarios)
+			r.Post("/scenarios/reset", h.ResetScenarios)
+			r.Put("/scenarios/{scenario}", h.SetScenarioState)
+
+			r.Get("/record", h.GetRecording)
+			r.Post("/record/start", h.StartRecording)
+			r.Post("/record/stop", h.StopRecording)
+			r.Post("/snapshot", h.Snapshot)
+
+			r.Get("/spec", h.GetSpec)
+			r.Put("/spec", h.PutSpec)
+			r.Put("/spec/mode", h.SetSpecMode)
+			r.Delete("/spec", h.DeleteSpec)
+
+			r.Post("/import/har", h.ImportHARInto)
+			r.Post("/import/postman", h.ImportPostmanInto)
+			r.Get("/export/postman", h.ExportPostman)
+
+			r.Route("/paths", func(r chi.Router) {
+				r.Get("/", h.ListPaths)
+				r.Post("/", h.AddPath)
+
+				r.Route("/{pathID}", func(r chi.Router) {
+					r.Use(h.PathCtx)
+					r.Get("/", h.GetPath)
+					r.Put("/", h.UpdatePath)
+					r.Patch("/", h.UpdatePath)
+					r.Delete("/", h.DeletePath)
+					r.Get("/sequence", h.GetSequence)
+					r.Post("/sequence/reset", h.ResetSequence)
+				})
+			})
 		})
 	})
 
+	// 4. Config as code: reconcile the agents with a declarative document
+	r.Post("/apply", h.Apply)
+	r.Get("/watch", h.GetWatch)
+
+	// 5. Bundles: move agents between MI6 instances
+	r.Get("/export", h.ExportBundle)
+	r.Post("/import", h.ImportBundle)
+
 	return r
 }
 
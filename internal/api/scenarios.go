@@ -0,0 +1,59 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"mi6/internal/db"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// ListScenarios returns the current state of every scenario of a running agent.
+func (h *Handlers) ListScenarios(w http.ResponseWriter, r *http.Request) {
+	a := r.Context().Value(keyAgent).(*db.Agent)
+
+	states, err := h.Mgr.Scenarios(a.Id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(states); err != nil {
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+	}
+}
+
+// ResetScenarios moves scenarios back to their starting state: all of them,
+// or only those named with ?name= (repeatable).
+func (h *Handlers) ResetScenarios(w http.ResponseWriter, r *http.Request) {
+	a := r.Context().Value(keyAgent).(*db.Agent)
+
+	if err := h.Mgr.ResetScenarios(a.Id, r.URL.Query()["name"]...); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	h.ListScenarios(w, r)
+}
+
+// SetScenarioState forces a scenario into the state given as {"state": "..."}.
+func (h *Handlers) SetScenarioState(w http.ResponseWriter, r *http.Request) {
+	a := r.Context().Value(keyAgent).(*db.Agent)
+
+	var req struct {
+		State string `json:"state"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.State == "" {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Mgr.SetScenarioState(a.Id, chi.URLParam(r, "scenario"), req.State); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	h.ListScenarios(w, r)
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"mi6/internal/db"
+)
+
+// GetSpec returns the OpenAPI document attached to the agent and its validation mode.
+func (h *Handlers) GetSpec(w http.ResponseWriter, r *http.Request) {
+	a := r.Context().Value(keyAgent).(*db.Agent)
+
+	spec, err := h.Mgr.Spec(r.Context(), a.Id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No spec attached to this agent", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error fetching spec: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(spec); err != nil {
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+	}
+}
+
+// PutSpec attaches the OpenAPI document sent as the request body, in JSON or
+// YAML, to the agent. ?mode= chooses between "enforce" (the default) and "log".
+func (h *Handlers) PutSpec(w http.ResponseWriter, r *http.Request) {
+	a := r.Context().Value(keyAgent).(*db.Agent)
+
+	document, err := io.ReadAll(io.LimitReader(r.Body, maxImportSize))
+	if err != nil {
+		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	spec := &db.AgentSpec{AgentID: a.Id, Document: string(document), Mode: r.URL.Query().Get("mode")}
+	if err := h.Mgr.AttachSpec(r.Context(), spec); err != nil {
+		http.Error(w, fmt.Sprintf("Error attaching spec: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(spec)
+}
+
+// SetSpecMode switches the validation mode of the agent's spec, given as {"mode": "log"}.
+func (h *Handlers) SetSpecMode(w http.ResponseWriter, r *http.Request) {
+	a := r.Context().Value(keyAgent).(*db.Agent)
+
+	var req struct {
+		Mode string `json:"mode"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Mode == "" {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	spec, err := h.Mgr.Spec(r.Context(), a.Id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No spec attached to this agent", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error fetching spec: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	spec.Mode = req.Mode
+	if err := h.Mgr.AttachSpec(r.Context(), spec); err != nil {
+		http.Error(w, fmt.Sprintf("Error attaching spec: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(spec)
+}
+
+// DeleteSpec detaches the agent's spec, so its requests are no longer validated.
+func (h *Handlers) DeleteSpec(w http.ResponseWriter, r *http.Request) {
+	a := r.Context().Value(keyAgent).(*db.Agent)
+
+	err := h.Mgr.DetachSpec(r.Context(), a.Id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No spec attached to this agent", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error detaching spec: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
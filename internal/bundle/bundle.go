@@ -0,0 +1,224 @@
+// Package bundle moves agents between MI6 installations as portable zip
+// archives: a JSON manifest describing the agents, their paths and attached
+// specs, plus raw files for bodies too large or too binary to sit in it.
+package bundle
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"mi6/internal/db"
+)
+
+// Format and Version identify the manifest of a bundle.
+const (
+	Format  = "mi6-bundle"
+	Version = 1
+)
+
+// ManifestName is the name of the manifest within the archive.
+const ManifestName = "manifest.json"
+
+// maxInlineBody is the size above which text bodies are stored as files.
+const maxInlineBody = 4 << 10
+
+// Manifest describes the agents of a bundle.
+type Manifest struct {
+	Format  string    `json:"format"`
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	Agents  []Agent   `json:"agents"`
+}
+
+// Agent is an agent as stored in a bundle, without its id and status.
+type Agent struct {
+	db.Agent
+	Paths []db.AgentPath `json:"paths"`
+	Spec  *Spec          `json:"spec,omitempty"`
+
+	// Files holds the bodies stored as files, keyed by the response they
+	// belong to: "paths[2]", "paths[2].variants[0]" or "paths[2].sequence[1]".
+	// The responses themselves are left empty in the manifest.
+	Files map[string]string `json:"files,omitempty"`
+}
+
+// Spec is the OpenAPI document attached to an agent, stored as a file.
+type Spec struct {
+	Mode string `json:"mode"`
+	File string `json:"file"`
+
+	Document string `json:"-"` // The file's content, once read
+}
+
+// ErrNotFound is returned by Export when an agent it was asked for does not
+// exist.
+var ErrNotFound = errors.New("not found")
+
+// ExportOptions select what is exported.
+type ExportOptions struct {
+	AgentIDs []int // The agents to export; all of them when empty
+}
+
+// Export writes the agents, with their paths and specs, to w as a bundle.
+// specs may be nil, in which case specs are left out.
+func Export(ctx context.Context, repo db.AgentRepository, specs db.SpecRepository, w io.Writer, opts ExportOptions) (*Manifest, error) {
+	agents, err := selectAgents(ctx, repo, opts.AgentIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	archive := zip.NewWriter(w)
+	manifest := &Manifest{Format: Format, Version: Version, Created: time.Now().UTC(), Agents: []Agent{}}
+	for i, a := range agents {
+		paths, err := repo.GetAgentPaths(ctx, a.Id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load paths of agent %q: %w", a.Name, err)
+		}
+		dir := fmt.Sprintf("agents/%d-%s/", i+1, fileName(a.Name))
+		entry := Agent{Agent: a, Paths: paths}
+		entry.Id, entry.Status = 0, ""
+
+		for j := range entry.Paths {
+			p := &entry.Paths[j]
+			p.Id, p.AgentID = 0, 0
+			where := fmt.Sprintf("paths[%d]", j)
+			if err := entry.externalize(archive, dir, where, &p.MockResponse); err != nil {
+				return nil, err
+			}
+			for k := range p.Variants {
+				if err := entry.externalize(archive, dir, fmt.Sprintf("%s.variants[%d]", where, k), &p.Variants[k].MockResponse); err != nil {
+					return nil, err
+				}
+			}
+			for k := range p.Sequence {
+				if err := entry.externalize(archive, dir, fmt.Sprintf("%s.sequence[%d]", where, k), &p.Sequence[k]); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		if specs != nil {
+			spec, err := specs.GetAgentSpec(ctx, a.Id)
+			if err != nil && err != sql.ErrNoRows {
+				return nil, fmt.Errorf("failed to load spec of agent %q: %w", a.Name, err)
+			}
+			if spec != nil {
+				entry.Spec = &Spec{Mode: spec.Mode, File: dir + "openapi" + specExtension(spec.Document)}
+				if err := writeFile(archive, entry.Spec.File, []byte(spec.Document)); err != nil {
+					return nil, err
+				}
+			}
+		}
+		manifest.Agents = append(manifest.Agents, entry)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFile(archive, ManifestName, data); err != nil {
+		return nil, err
+	}
+	return manifest, archive.Close()
+}
+
+func selectAgents(ctx context.Context, repo db.AgentRepository, ids []int) ([]db.Agent, error) {
+	if len(ids) == 0 {
+		agents, err := repo.ListAgents(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list agents: %w", err)
+		}
+		return agents, nil
+	}
+	agents := make([]db.Agent, 0, len(ids))
+	for _, id := range ids {
+		a, err := repo.GetAgentByID(ctx, id)
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("agent %d %w", id, ErrNotFound)
+		} else if err != nil {
+			return nil, err
+		}
+		agents = append(agents, *a)
+	}
+	return agents, nil
+}
+
+// externalize moves a large or binary body out of the manifest into a file.
+// Base64-encoded bodies are stored decoded, as the bytes they stand for.
+func (a *Agent) externalize(archive *zip.Writer, dir, where string, m *db.MockResponse) error {
+	body := []byte(m.Response)
+	if m.Encoding == db.EncodingBase64 {
+		decoded, err := base64.StdEncoding.DecodeString(m.Response)
+		if err != nil {
+			return nil // Left as it is, for the import to report
+		}
+		body = decoded
+	} else if len(body) <= maxInlineBody && utf8.Valid(body) {
+		return nil
+	}
+
+	name := dir + strings.NewReplacer("[", "-", "]", "", ".", "-").Replace(where) + bodyExtension(m)
+	if err := writeFile(archive, name, body); err != nil {
+		return err
+	}
+	if a.Files == nil {
+		a.Files = map[string]string{}
+	}
+	a.Files[where] = name
+	m.Response = ""
+	return nil
+}
+
+func writeFile(archive *zip.Writer, name string, data []byte) error {
+	f, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
+
+var unsafeName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+func fileName(name string) string {
+	return strings.Trim(unsafeName.ReplaceAllString(name, "_"), "_.")
+}
+
+// bodyExtension picks a file extension from a response's Content-Type, so
+// that bodies open in the right tool.
+func bodyExtension(m *db.MockResponse) string {
+	for k, v := range m.Headers {
+		if !strings.EqualFold(k, "Content-Type") {
+			continue
+		}
+		mediaType, _, _ := mime.ParseMediaType(v)
+		switch {
+		case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+			return ".json"
+		case mediaType == "text/plain":
+			return ".txt"
+		}
+		if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+			return exts[0]
+		}
+	}
+	return ".bin"
+}
+
+func specExtension(document string) string {
+	if strings.HasPrefix(strings.TrimSpace(document), "{") {
+		return ".json"
+	}
+	return ".yaml"
+}
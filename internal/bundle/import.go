@@ -0,0 +1,363 @@
+package bundle
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strconv"
+
+	"mi6/internal/agent"
+	"mi6/internal/db"
+	"mi6/internal/openapi"
+)
+
+// Conflict policies: what to do with a bundled agent whose name or port is
+// already taken.
+const (
+	ConflictSkip         = "skip"          // Leave it out (the default)
+	ConflictOverwrite    = "overwrite"     // Replace the agent of the same name
+	ConflictRename       = "rename"        // Import it as a copy, under a new name and, if needed, port
+	ConflictReassignPort = "reassign-port" // Give it a free port; name clashes are skipped
+)
+
+// Import outcomes.
+const (
+	Created     = "created"
+	Overwritten = "overwritten"
+	Skipped     = "skipped"
+)
+
+// ImportOptions tune how a bundle is imported.
+type ImportOptions struct {
+	Conflict string // One of the Conflict policies; ConflictSkip when empty
+}
+
+// Validate checks the conflict policy.
+func (o ImportOptions) Validate() error {
+	switch o.Conflict {
+	case "", ConflictSkip, ConflictOverwrite, ConflictRename, ConflictReassignPort:
+		return nil
+	}
+	return fmt.Errorf("unknown conflict policy %q", o.Conflict)
+}
+
+// Outcome is what became of one bundled agent.
+type Outcome struct {
+	Name   string `json:"name"`
+	Port   string `json:"port"`
+	ID     int    `json:"id,omitempty"`
+	Action string `json:"action"` // Created, Overwritten or Skipped
+
+	BundleName string `json:"bundle_name,omitempty"` // Set when the agent was renamed
+	BundlePort string `json:"bundle_port,omitempty"` // Set when the agent was given another port
+	Reason     string `json:"reason,omitempty"`      // Why the agent was skipped
+}
+
+// ImportResult lists the outcome for every agent of a bundle.
+type ImportResult struct {
+	Agents []Outcome `json:"agents"`
+}
+
+// Read opens a bundle and loads its manifest, with the bodies and specs
+// stored as files put back in place.
+func Read(r io.ReaderAt, size int64) (*Manifest, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bundle: %w", err)
+	}
+	data, err := fs.ReadFile(archive, ManifestName)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bundle: %w", err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid bundle manifest: %w", err)
+	}
+	if m.Format != Format {
+		return nil, fmt.Errorf("not an MI6 bundle (format %q)", m.Format)
+	}
+	if m.Version < 1 || m.Version > Version {
+		return nil, fmt.Errorf("unsupported bundle version %d; this MI6 reads up to version %d", m.Version, Version)
+	}
+
+	for i := range m.Agents {
+		a := &m.Agents[i]
+		for where, name := range a.Files {
+			body, err := fs.ReadFile(archive, name)
+			if err != nil {
+				return nil, fmt.Errorf("agent %q: %s: %w", a.Name, where, err)
+			}
+			response := a.response(where)
+			if response == nil {
+				return nil, fmt.Errorf("agent %q: file %s belongs to unknown response %s", a.Name, name, where)
+			}
+			if response.Encoding == db.EncodingBase64 {
+				response.Response = base64.StdEncoding.EncodeToString(body)
+			} else {
+				response.Response = string(body)
+			}
+		}
+		a.Files = nil
+
+		if a.Spec != nil {
+			doc, err := fs.ReadFile(archive, a.Spec.File)
+			if err != nil {
+				return nil, fmt.Errorf("agent %q: spec: %w", a.Name, err)
+			}
+			a.Spec.Document = string(doc)
+		}
+	}
+	return &m, nil
+}
+
+// response finds the response a Files key refers to.
+func (a *Agent) response(where string) *db.MockResponse {
+	for j := range a.Paths {
+		p := &a.Paths[j]
+		key := fmt.Sprintf("paths[%d]", j)
+		if where == key {
+			return &p.MockResponse
+		}
+		for k := range p.Variants {
+			if where == fmt.Sprintf("%s.variants[%d]", key, k) {
+				return &p.Variants[k].MockResponse
+			}
+		}
+		for k := range p.Sequence {
+			if where == fmt.Sprintf("%s.sequence[%d]", key, k) {
+				return &p.Sequence[k]
+			}
+		}
+	}
+	return nil
+}
+
+// Import creates the agents of a bundle, resolving clashes with existing
+// agents' names and ports by the conflict policy. Everything is validated,
+// and the outcome of every agent decided, before anything is written. If a
+// write fails, the result lists the outcomes of the agents handled before
+// it, along with the error. specs may be nil, in which case bundled specs
+// are ignored.
+func Import(ctx context.Context, repo db.AgentRepository, specs db.SpecRepository, m *Manifest, opts ImportOptions) (*ImportResult, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	names, ports := map[string]bool{}, map[string]string{}
+	for i := range m.Agents {
+		a := &m.Agents[i]
+		if err := validate(a); err != nil {
+			return nil, err
+		}
+		if names[a.Name] {
+			return nil, fmt.Errorf("agent %q is bundled twice", a.Name)
+		}
+		if other, ok := ports[a.Port]; ok {
+			return nil, fmt.Errorf("agent %q: port %s is also bundled for agent %q", a.Name, a.Port, other)
+		}
+		names[a.Name], ports[a.Port] = true, a.Name
+	}
+
+	result := &ImportResult{Agents: []Outcome{}}
+	existing, err := repo.ListAgents(ctx)
+	if err != nil {
+		return result, fmt.Errorf("failed to list agents: %w", err)
+	}
+	steps := plan(existing, m.Agents, opts)
+
+	for _, step := range steps {
+		outcome, a := step.outcome, step.agent
+		switch outcome.Action {
+		case Overwritten:
+			err = overwrite(ctx, repo, specs, step.current, a)
+		case Created:
+			outcome.ID, err = create(ctx, repo, specs, a)
+		}
+		if err != nil {
+			return result, fmt.Errorf("agent %q: %w", a.Name, err)
+		}
+		result.Agents = append(result.Agents, outcome)
+	}
+	return result, nil
+}
+
+// step is what Import does with one bundled agent.
+type step struct {
+	outcome Outcome
+	agent   Agent    // As it is written, renamed or moved
+	current db.Agent // The agent it overwrites
+}
+
+// plan decides the outcome of each bundled agent, in order, keeping track of
+// the names and ports the agents before it take and free.
+func plan(existing []db.Agent, bundled []Agent, opts ImportOptions) []step {
+	byName := map[string]db.Agent{}
+	portOwner := map[string]string{}
+	for _, a := range existing {
+		byName[a.Name] = a
+		portOwner[a.Port] = a.Name
+	}
+
+	steps := make([]step, 0, len(bundled))
+	for _, a := range bundled {
+		outcome := Outcome{Name: a.Name, Port: a.Port, Action: Created}
+		skip := func(format string, args ...any) {
+			outcome.Action, outcome.Reason = Skipped, fmt.Sprintf(format, args...)
+		}
+		current, nameTaken := byName[a.Name]
+		owner, portTaken := portOwner[a.Port]
+
+		var err error
+		switch opts.Conflict {
+		case "", ConflictSkip:
+			if nameTaken {
+				skip("an agent named %q exists", a.Name)
+			} else if portTaken {
+				skip("port %s is used by agent %q", a.Port, owner)
+			}
+		case ConflictOverwrite:
+			if portTaken && owner != a.Name {
+				skip("port %s is used by agent %q", a.Port, owner)
+			} else if nameTaken {
+				outcome.Action, outcome.ID = Overwritten, current.Id
+			}
+		case ConflictRename:
+			if nameTaken {
+				outcome.Name = freeName(a.Name, byName)
+			}
+			if portTaken {
+				outcome.Port, err = freePort(a.Port, portOwner)
+			}
+		case ConflictReassignPort:
+			if nameTaken {
+				skip("an agent named %q exists", a.Name)
+			} else if portTaken {
+				outcome.Port, err = freePort(a.Port, portOwner)
+			}
+		}
+		if err != nil {
+			skip("%v", err)
+		}
+		if outcome.Action == Skipped {
+			outcome.Name, outcome.Port = a.Name, a.Port
+			steps = append(steps, step{outcome: outcome})
+			continue
+		}
+		if outcome.Name != a.Name {
+			outcome.BundleName = a.Name
+		}
+		if outcome.Port != a.Port {
+			outcome.BundlePort = a.Port
+		}
+		a.Name, a.Port = outcome.Name, outcome.Port
+
+		if outcome.Action == Overwritten {
+			delete(portOwner, current.Port) // The overwritten agent moves to the bundled port
+		}
+		byName[a.Name] = a.Agent
+		portOwner[a.Port] = a.Name
+		steps = append(steps, step{outcome: outcome, agent: a, current: current})
+	}
+	return steps
+}
+
+func validate(a *Agent) error {
+	if a.Name == "" || a.Port == "" {
+		return errors.New("bundled agents need a name and a port")
+	}
+	if err := agent.ValidateAgent(&a.Agent); err != nil {
+		return fmt.Errorf("agent %q: %w", a.Name, err)
+	}
+	for i := range a.Paths {
+		if err := agent.ValidatePath(&a.Paths[i]); err != nil {
+			return fmt.Errorf("agent %q: %w", a.Name, err)
+		}
+	}
+	if a.Spec != nil {
+		if a.Spec.Mode != db.SpecEnforce && a.Spec.Mode != db.SpecLogOnly {
+			return fmt.Errorf("agent %q: unknown spec mode %q", a.Name, a.Spec.Mode)
+		}
+		if _, err := openapi.Parse([]byte(a.Spec.Document)); err != nil {
+			return fmt.Errorf("agent %q: spec: %w", a.Name, err)
+		}
+	}
+	return nil
+}
+
+func create(ctx context.Context, repo db.AgentRepository, specs db.SpecRepository, a Agent) (int, error) {
+	a.Id, a.Status = 0, ""
+	id, err := repo.CreateAgent(ctx, &a.Agent, a.Paths)
+	if err != nil {
+		return 0, err
+	}
+	if specs != nil && a.Spec != nil {
+		if err := specs.SetAgentSpec(ctx, &db.AgentSpec{AgentID: id, Document: a.Spec.Document, Mode: a.Spec.Mode}); err != nil {
+			return id, err
+		}
+	}
+	return id, nil
+}
+
+// overwrite replaces an agent's configuration, paths and spec with the
+// bundled ones. The spec goes first, so that the reloads caused by the rest
+// pick it up if the agent is running.
+func overwrite(ctx context.Context, repo db.AgentRepository, specs db.SpecRepository, current db.Agent, a Agent) error {
+	if specs != nil {
+		if a.Spec != nil {
+			if err := specs.SetAgentSpec(ctx, &db.AgentSpec{AgentID: current.Id, Document: a.Spec.Document, Mode: a.Spec.Mode}); err != nil {
+				return err
+			}
+		} else if err := specs.DeleteAgentSpec(ctx, current.Id); err != nil && err != sql.ErrNoRows {
+			return err
+		}
+	}
+
+	a.Id, a.Status = current.Id, current.Status
+	if err := repo.UpdateAgent(ctx, &a.Agent); err != nil {
+		return err
+	}
+	paths, err := repo.GetAgentPaths(ctx, current.Id)
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		if err := repo.DeletePath(ctx, current.Id, p.Id); err != nil {
+			return err
+		}
+	}
+	for _, p := range a.Paths {
+		if _, err := repo.AddPath(ctx, current.Id, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// freeName appends the first free "-N" suffix to name.
+func freeName(name string, taken map[string]db.Agent) string {
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%s-%d", name, n)
+		if _, ok := taken[candidate]; !ok {
+			return candidate
+		}
+	}
+}
+
+// freePort returns the first port above port that no agent uses.
+func freePort(port string, owners map[string]string) (string, error) {
+	n, err := strconv.Atoi(port)
+	if err != nil {
+		return "", fmt.Errorf("port %s is taken and not a number to count on from", port)
+	}
+	for n++; n <= 65535; n++ {
+		if _, taken := owners[strconv.Itoa(n)]; !taken {
+			return strconv.Itoa(n), nil
+		}
+	}
+	return "", fmt.Errorf("no free port above %s", port)
+}
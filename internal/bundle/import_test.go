@@ -0,0 +1,273 @@
+package bundle
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"mi6/internal/db"
+)
+
+func newTestRepository(t *testing.T) *db.SQLiteRepository {
+	t.Helper()
+	conn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "agents.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if err := db.RunMigrations(conn); err != nil {
+		t.Fatal(err)
+	}
+	return db.NewSQLiteRepository(conn)
+}
+
+// manifest bundles agents, each given as "name:port", with a GET /bundled path.
+func manifest(agents ...string) *Manifest {
+	m := &Manifest{Format: Format, Version: Version}
+	for _, a := range agents {
+		name, port, _ := strings.Cut(a, ":")
+		m.Agents = append(m.Agents, Agent{
+			Agent: db.Agent{Name: name, Port: port},
+			Paths: []db.AgentPath{{Method: "GET", Path: "/bundled", MockResponse: db.MockResponse{StatusCode: 200, Response: name}}},
+		})
+	}
+	return m
+}
+
+// seed creates agents, each given as "name:port", with a GET /existing path.
+func seed(t *testing.T, repo db.AgentRepository, agents ...string) {
+	t.Helper()
+	for _, a := range agents {
+		name, port, _ := strings.Cut(a, ":")
+		paths := []db.AgentPath{{Method: "GET", Path: "/existing", MockResponse: db.MockResponse{StatusCode: 200}}}
+		if _, err := repo.CreateAgent(context.Background(), &db.Agent{Name: name, Port: port}, paths); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// agents lists the agents of the repository as "name:port /path...", in name order.
+func agents(t *testing.T, repo db.AgentRepository) []string {
+	t.Helper()
+	ctx := context.Background()
+	list, err := repo.ListAgents(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []string
+	for _, a := range list {
+		paths, err := repo.GetAgentPaths(ctx, a.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := a.Name + ":" + a.Port
+		for _, p := range paths {
+			s += " " + p.Path
+		}
+		out = append(out, s)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func describe(result *ImportResult) []string {
+	var out []string
+	for _, o := range result.Agents {
+		s := fmt.Sprintf("%s %s:%s", o.Action, o.Name, o.Port)
+		if o.BundleName != "" || o.BundlePort != "" {
+			s += fmt.Sprintf(" (bundled as %s:%s)", cmp.Or(o.BundleName, o.Name), cmp.Or(o.BundlePort, o.Port))
+		}
+		if o.Reason != "" {
+			s += " (" + o.Reason + ")"
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+func TestImport(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []string
+		bundled  []string
+		conflict string
+		want     []string // Outcomes
+		agents   []string // Afterwards
+	}{
+		{
+			name:     "skip",
+			existing: []string{"x:18000"},
+			bundled:  []string{"x:18001", "y:18000", "w:18002"},
+			want: []string{
+				`skipped x:18001 (an agent named "x" exists)`,
+				`skipped y:18000 (port 18000 is used by agent "x")`,
+				"created w:18002",
+			},
+			agents: []string{"w:18002 /bundled", "x:18000 /existing"},
+		},
+		{
+			name:     "overwrite",
+			existing: []string{"x:18000", "z:18005"},
+			bundled:  []string{"x:18001", "y:18000", "z:18005"},
+			conflict: ConflictOverwrite,
+			want:     []string{"overwritten x:18001", "created y:18000", "overwritten z:18005"},
+			agents:   []string{"x:18001 /bundled", "y:18000 /bundled", "z:18005 /bundled"},
+		},
+		{
+			name:     "overwrite onto another agent's port",
+			existing: []string{"x:18000", "z:18005"},
+			bundled:  []string{"x:18005"},
+			conflict: ConflictOverwrite,
+			want:     []string{`skipped x:18005 (port 18005 is used by agent "z")`},
+			agents:   []string{"x:18000 /existing", "z:18005 /existing"},
+		},
+		{
+			name:     "rename",
+			existing: []string{"x:18000"},
+			bundled:  []string{"x:18001", "y:18000", "x-2:18003"},
+			conflict: ConflictRename,
+			want: []string{
+				"created x-2:18001 (bundled as x:18001)",
+				"created y:18002 (bundled as y:18000)",
+				"created x-2-2:18003 (bundled as x-2:18003)",
+			},
+			agents: []string{"x-2-2:18003 /bundled", "x-2:18001 /bundled", "x:18000 /existing", "y:18002 /bundled"},
+		},
+		{
+			name:     "rename onto a port that is not a number",
+			existing: []string{"x:http"},
+			bundled:  []string{"y:http"},
+			conflict: ConflictRename,
+			want:     []string{"skipped y:http (port http is taken and not a number to count on from)"},
+			agents:   []string{"x:http /existing"},
+		},
+		{
+			name:     "reassign-port",
+			existing: []string{"x:18000", "z:18001"},
+			bundled:  []string{"x:18003", "y:18000"},
+			conflict: ConflictReassignPort,
+			want: []string{
+				`skipped x:18003 (an agent named "x" exists)`,
+				"created y:18002 (bundled as y:18000)",
+			},
+			agents: []string{"x:18000 /existing", "y:18002 /bundled", "z:18001 /existing"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newTestRepository(t)
+			seed(t, repo, tt.existing...)
+
+			result, err := Import(context.Background(), repo, repo, manifest(tt.bundled...), ImportOptions{Conflict: tt.conflict})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := describe(result); strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("got outcomes:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+			if got := agents(t, repo); strings.Join(got, ", ") != strings.Join(tt.agents, ", ") {
+				t.Errorf("got agents %q, want %q", got, tt.agents)
+			}
+		})
+	}
+}
+
+func TestImportValidatesBeforeWriting(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest *Manifest
+		opts     ImportOptions
+		wantErr  string
+	}{
+		{"unknown policy", manifest("y:18001"), ImportOptions{Conflict: "merge"}, `unknown conflict policy "merge"`},
+		{"name bundled twice", manifest("y:18001", "y:18002"), ImportOptions{}, `agent "y" is bundled twice`},
+		{"port bundled twice", manifest("y:18001", "w:18001"), ImportOptions{}, `port 18001 is also bundled for agent "y"`},
+		{"missing port", manifest("y:18001", "w:"), ImportOptions{}, "need a name and a port"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newTestRepository(t)
+			result, err := Import(context.Background(), repo, repo, tt.manifest, tt.opts)
+			if result != nil || err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got %v, %v; want no result and an error mentioning %q", result, err, tt.wantErr)
+			}
+			if got := agents(t, repo); len(got) != 0 {
+				t.Errorf("got agents %q, want none written", got)
+			}
+		})
+	}
+}
+
+// failingRepository fails to create the agent named fail.
+type failingRepository struct {
+	*db.SQLiteRepository
+	fail string
+}
+
+func (r failingRepository) CreateAgent(ctx context.Context, a *db.Agent, paths []db.AgentPath) (int, error) {
+	if a.Name == r.fail {
+		return 0, errors.New("disk full")
+	}
+	return r.SQLiteRepository.CreateAgent(ctx, a, paths)
+}
+
+func TestImportReportsOutcomesBeforeFailure(t *testing.T) {
+	repo := newTestRepository(t)
+	seed(t, repo, "x:18000")
+	failing := failingRepository{SQLiteRepository: repo, fail: "y"}
+
+	result, err := Import(context.Background(), failing, failing, manifest("x:18003", "w:18001", "y:18002", "v:18004"), ImportOptions{})
+	if err == nil || !strings.Contains(err.Error(), `agent "y": disk full`) {
+		t.Fatalf("got %v, want the failing agent named", err)
+	}
+	want := []string{`skipped x:18003 (an agent named "x" exists)`, "created w:18001"}
+	if result == nil || strings.Join(describe(result), "\n") != strings.Join(want, "\n") {
+		t.Fatalf("got %+v, want the outcomes %q", result, want)
+	}
+	if got := agents(t, repo); strings.Join(got, ", ") != "w:18001 /bundled, x:18000 /existing" {
+		t.Errorf("got agents %q, want those before the failure", got)
+	}
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	source := newTestRepository(t)
+	seed(t, source, "x:18000", "y:18001")
+
+	var buf strings.Builder
+	if _, err := Export(ctx, source, source, &buf, ExportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.String()
+	m, err := Read(strings.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := newTestRepository(t)
+	if _, err := Import(ctx, target, target, m, ImportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := agents(t, target), agents(t, source); strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("got agents %q, want %q", got, want)
+	}
+}
+
+func TestExportReportsMissingAgents(t *testing.T) {
+	repo := newTestRepository(t)
+	seed(t, repo, "x:18000")
+
+	var buf strings.Builder
+	_, err := Export(context.Background(), repo, repo, &buf, ExportOptions{AgentIDs: []int{1, 7}})
+	if !errors.Is(err, ErrNotFound) || err.Error() != "agent 7 not found" {
+		t.Errorf("got %v, want agent 7 not found", err)
+	}
+}
@@ -0,0 +1,237 @@
+// Package config reconciles the agents repository with declarative documents
+// describing agents, their paths and their responses, so that mocks can be
+// kept in version control.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"mi6/internal/agent"
+	"mi6/internal/db"
+)
+
+// Version is the version of the document format. Documents may declare it as
+// "version"; those that do not are assumed to be of this one.
+const Version = 1
+
+// Document describes agents, each with all of its paths.
+type Document struct {
+	Version int        `json:"version,omitempty"`
+	Agents  []AgentDef `json:"agents"`
+}
+
+// AgentDef is an agent as declared in a document, identified by its name.
+// Its fields, and those of its paths, are named as in the API.
+type AgentDef struct {
+	db.Agent
+	Paths []db.AgentPath `json:"paths"`
+
+	Source string `json:"-"` // File the agent was declared in, for messages
+}
+
+// UnmarshalJSON accepts the port as a number as well as a string, since
+// that is how it is usually written in YAML.
+func (d *AgentDef) UnmarshalJSON(data []byte) error {
+	type plain AgentDef
+	var aux struct {
+		plain
+		Port json.RawMessage `json:"port"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&aux); err != nil {
+		return err
+	}
+	*d = AgentDef(aux.plain)
+	if len(aux.Port) > 0 && string(aux.Port) != "null" {
+		var port json.Number
+		if json.Unmarshal(aux.Port, &port) == nil {
+			d.Port = port.String()
+		} else if err := json.Unmarshal(aux.Port, &d.Port); err != nil {
+			return fmt.Errorf("port: %w", err)
+		}
+	}
+	return nil
+}
+
+// Parse reads a document in YAML or JSON. Besides a full document, a file
+// may hold a single agent, with its name at the top level.
+func Parse(data []byte, source string) (*Document, error) {
+	var raw any
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", source, err)
+	}
+	raw = normalize(raw)
+	top, ok := raw.(map[string]any)
+	if !ok {
+		if raw == nil {
+			return &Document{Version: Version}, nil // An empty file declares nothing
+		}
+		return nil, fmt.Errorf("%s: expected a mapping at the top level", source)
+	}
+	if _, hasAgents := top["agents"]; !hasAgents {
+		if _, isAgent := top["name"]; isAgent {
+			raw = map[string]any{"agents": []any{top}}
+		}
+	}
+
+	encoded, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", source, err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(encoded))
+	dec.DisallowUnknownFields()
+	var doc Document
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", source, err)
+	}
+	if doc.Version == 0 {
+		doc.Version = Version
+	}
+	if doc.Version != Version {
+		return nil, fmt.Errorf("%s: unsupported document version %d", source, doc.Version)
+	}
+	for i := range doc.Agents {
+		doc.Agents[i].Source = source
+	}
+	return &doc, nil
+}
+
+// normalize turns the maps YAML decodes into JSON-encodable ones.
+func normalize(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			v[k] = normalize(e)
+		}
+		return v
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = normalize(e)
+		}
+		return m
+	case []any:
+		for i, e := range v {
+			v[i] = normalize(e)
+		}
+		return v
+	}
+	return v
+}
+
+// IsDocument reports whether a file name has one of the extensions documents
+// are read from: .yaml, .yml or .json.
+func IsDocument(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+// Load reads and merges documents from files and directories. The documents
+// of a directory are those directly inside it, read in name order.
+func Load(paths ...string) (*Document, error) {
+	merged := &Document{Version: Version}
+	for _, p := range paths {
+		files := []string{p}
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			entries, err := os.ReadDir(p)
+			if err != nil {
+				return nil, err
+			}
+			files = files[:0]
+			for _, e := range entries {
+				if !e.IsDir() && IsDocument(e.Name()) && !strings.HasPrefix(e.Name(), ".") {
+					files = append(files, filepath.Join(p, e.Name()))
+				}
+			}
+			sort.Strings(files)
+		}
+
+		for _, f := range files {
+			data, err := os.ReadFile(f)
+			if err != nil {
+				return nil, err
+			}
+			doc, err := Parse(data, f)
+			if err != nil {
+				return nil, err
+			}
+			merged.Agents = append(merged.Agents, doc.Agents...)
+		}
+	}
+	return merged, nil
+}
+
+// Validate checks every agent and path of the document, normalizing them as
+// the API would, and that names, ports and routes are not declared twice.
+// It reports all the problems found.
+func (doc *Document) Validate() error {
+	var problems []error
+	names := map[string]string{}
+	ports := map[string]string{}
+	for i := range doc.Agents {
+		d := &doc.Agents[i]
+		where := d.Source + ": agent " + strconv.Quote(d.Name)
+		fail := func(format string, args ...any) {
+			problems = append(problems, fmt.Errorf(where+": "+format, args...))
+		}
+
+		if d.Name == "" {
+			where = fmt.Sprintf("%s: agent #%d", d.Source, i+1)
+			fail("name is required")
+		} else if other, ok := names[d.Name]; ok {
+			fail("also declared in %s", other)
+		} else {
+			names[d.Name] = d.Source
+		}
+		if d.Port == "" {
+			fail("port is required")
+		} else if other, ok := ports[d.Port]; ok {
+			fail("port %s is also used by agent %q", d.Port, other)
+		} else {
+			ports[d.Port] = d.Name
+		}
+		if d.Id != 0 || d.Status != "" {
+			fail("id and status are assigned by MI6 and cannot be declared")
+		}
+		if err := agent.ValidateAgent(&d.Agent); err != nil {
+			fail("%v", err)
+		}
+
+		routes := map[string]bool{}
+		for j := range d.Paths {
+			p := &d.Paths[j]
+			if p.Id != 0 || p.AgentID != 0 {
+				fail("path %s %s: ids are assigned by MI6 and cannot be declared", p.Method, p.Path)
+				continue
+			}
+			if err := agent.ValidatePath(p); err != nil {
+				fail("%v", err)
+				continue
+			}
+			if key := p.Method + " " + p.Path; routes[key] {
+				fail("path %s is declared twice", key)
+			} else {
+				routes[key] = true
+			}
+		}
+	}
+	return errors.Join(problems...)
+}
@@ -0,0 +1,324 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"mi6/internal/db"
+)
+
+// Change actions.
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+// Change is one difference between a document and the repository.
+type Change struct {
+	Action string   `json:"action"` // ActionCreate, ActionUpdate or ActionDelete
+	Agent  string   `json:"agent"`
+	Path   string   `json:"path,omitempty"`   // "METHOD /pattern"; empty for the agent itself
+	Fields []string `json:"fields,omitempty"` // What an update changes
+
+	apply func(ctx context.Context, repo db.AgentRepository) error // nil when applied along with another change
+}
+
+// String renders the change as a line of a diff, e.g. "~ path shop GET /cart: status_code".
+func (c Change) String() string {
+	sign := map[string]string{ActionCreate: "+", ActionUpdate: "~", ActionDelete: "-"}[c.Action]
+	s := sign + " agent " + c.Agent
+	if c.Path != "" {
+		s = sign + " path " + c.Agent + " " + c.Path
+	}
+	if len(c.Fields) > 0 {
+		s += ": " + strings.Join(c.Fields, ", ")
+	}
+	return s
+}
+
+// Options tune how a document is reconciled.
+type Options struct {
+	// Prune deletes agents the document does not declare. Without it they
+	// are left alone.
+	Prune bool
+	// Owned, when set, limits pruning to the agents it reports true for.
+	Owned func(name string) bool
+}
+
+// Plan is the set of changes that makes the repository match a document.
+type Plan struct {
+	Changes []Change `json:"changes"`
+}
+
+// Empty reports whether the repository already matches the document.
+func (p *Plan) Empty() bool { return len(p.Changes) == 0 }
+
+// String renders the plan as a diff, one change per line.
+func (p *Plan) String() string {
+	var b strings.Builder
+	for _, c := range p.Changes {
+		b.WriteString(c.String())
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// Diff validates a document and compares it with the repository. Agents are
+// matched by name, and their paths by method and pattern; paths the document
+// does not declare are deleted from the agents it does. Agents changing
+// ports are moved in an order that frees each port before it is taken, and
+// agents swapping ports are rejected.
+func Diff(ctx context.Context, repo db.AgentRepository, doc *Document, opts Options) (*Plan, error) {
+	if err := doc.Validate(); err != nil {
+		return nil, err
+	}
+	existing, err := repo.ListAgents(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list agents: %w", err)
+	}
+	byName := make(map[string]db.Agent, len(existing))
+	for _, a := range existing {
+		byName[a.Name] = a
+	}
+
+	var deletes, updates, creates, pathChanges []Change
+	var moves []portMove
+	declared := make(map[string]bool, len(doc.Agents))
+	for _, d := range doc.Agents {
+		declared[d.Name] = true
+	}
+
+	// Agents being kept still hold their ports, which the document cannot reuse.
+	ports := map[string]string{}
+	for _, a := range existing {
+		if !declared[a.Name] && !(opts.Prune && owned(opts, a.Name)) {
+			ports[a.Port] = a.Name
+		}
+	}
+
+	for _, a := range existing {
+		if declared[a.Name] || !opts.Prune || !owned(opts, a.Name) {
+			continue
+		}
+		id := a.Id
+		deletes = append(deletes, Change{Action: ActionDelete, Agent: a.Name, apply: func(ctx context.Context, repo db.AgentRepository) error {
+			return repo.DeleteAgent(ctx, id)
+		}})
+	}
+
+	for _, d := range doc.Agents {
+		if other, ok := ports[d.Port]; ok {
+			return nil, fmt.Errorf("%s: agent %q: port %s is used by agent %q, which the document does not declare", d.Source, d.Name, d.Port, other)
+		}
+
+		current, ok := byName[d.Name]
+		if !ok {
+			a, paths := d.Agent, d.Paths
+			creates = append(creates, Change{Action: ActionCreate, Agent: d.Name, apply: func(ctx context.Context, repo db.AgentRepository) error {
+				_, err := repo.CreateAgent(ctx, &a, paths)
+				return err
+			}})
+			for _, p := range d.Paths {
+				creates = append(creates, Change{Action: ActionCreate, Agent: d.Name, Path: p.Method + " " + p.Path})
+			}
+			continue
+		}
+
+		wanted := d.Agent
+		wanted.Id, wanted.Status = current.Id, current.Status
+		if fields := changedFields(current, wanted); len(fields) > 0 {
+			change := Change{Action: ActionUpdate, Agent: d.Name, Fields: fields, apply: func(ctx context.Context, repo db.AgentRepository) error {
+				return repo.UpdateAgent(ctx, &wanted)
+			}}
+			if wanted.Port != current.Port {
+				moves = append(moves, portMove{change: change, source: d.Source, from: current.Port, to: wanted.Port})
+			} else {
+				updates = append(updates, change)
+			}
+		}
+
+		changes, err := diffPaths(ctx, repo, current, d)
+		if err != nil {
+			return nil, err
+		}
+		pathChanges = append(pathChanges, changes...)
+	}
+
+	ordered, err := orderMoves(moves)
+	if err != nil {
+		return nil, err
+	}
+	updates = append(updates, ordered...)
+
+	// Deleting first frees the names and ports that the rest may reuse.
+	plan := &Plan{Changes: []Change{}}
+	for _, group := range [][]Change{deletes, updates, pathChanges, creates} {
+		plan.Changes = append(plan.Changes, group...)
+	}
+	return plan, nil
+}
+
+// portMove is the update of an agent that changes its port.
+type portMove struct {
+	change   Change
+	source   string
+	from, to string
+}
+
+// orderMoves orders the updates that change ports so that each agent moves
+// only once the agent holding its new port has moved away. Agents that would
+// take each other's ports, such as two swapping them, cannot be moved one at
+// a time and are rejected.
+func orderMoves(moves []portMove) ([]Change, error) {
+	var ordered []Change
+	for len(moves) > 0 {
+		held := make(map[string]bool, len(moves))
+		for _, m := range moves {
+			held[m.from] = true
+		}
+		var blocked []portMove
+		for _, m := range moves {
+			if held[m.to] {
+				blocked = append(blocked, m)
+			} else {
+				ordered = append(ordered, m.change)
+			}
+		}
+		if len(blocked) == len(moves) {
+			holders := make(map[string]string, len(moves))
+			for _, m := range moves {
+				holders[m.from] = m.change.Agent
+			}
+			m := blocked[0]
+			return nil, fmt.Errorf("%s: agent %q: port %s is used by agent %q, which cannot move away first; agents cannot swap ports in one change, so move one of them to a free port first",
+				m.source, m.change.Agent, m.to, holders[m.to])
+		}
+		moves = blocked
+	}
+	return ordered, nil
+}
+
+func owned(opts Options, name string) bool {
+	return opts.Owned == nil || opts.Owned(name)
+}
+
+// diffPaths compares the paths of an existing agent with its declaration.
+func diffPaths(ctx context.Context, repo db.AgentRepository, current db.Agent, d AgentDef) ([]Change, error) {
+	paths, err := repo.GetAgentPaths(ctx, current.Id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load paths of agent %q: %w", current.Name, err)
+	}
+	existing := make(map[string]db.AgentPath, len(paths))
+	for _, p := range paths {
+		existing[p.Method+" "+p.Path] = p
+	}
+
+	var deletes, updates, creates []Change
+	declared := make(map[string]bool, len(d.Paths))
+	for _, p := range d.Paths {
+		key := p.Method + " " + p.Path
+		declared[key] = true
+		p.AgentID = current.Id
+
+		old, ok := existing[key]
+		if !ok {
+			creates = append(creates, Change{Action: ActionCreate, Agent: d.Name, Path: key, apply: func(ctx context.Context, repo db.AgentRepository) error {
+				_, err := repo.AddPath(ctx, p.AgentID, p)
+				return err
+			}})
+			continue
+		}
+		p.Id = old.Id
+		if fields := changedFields(old, p); len(fields) > 0 {
+			updates = append(updates, Change{Action: ActionUpdate, Agent: d.Name, Path: key, Fields: fields, apply: func(ctx context.Context, repo db.AgentRepository) error {
+				return repo.UpdatePath(ctx, p)
+			}})
+		}
+	}
+	for _, p := range paths {
+		key := p.Method + " " + p.Path
+		if declared[key] {
+			continue
+		}
+		agentID, pathID := p.AgentID, p.Id
+		deletes = append(deletes, Change{Action: ActionDelete, Agent: d.Name, Path: key, apply: func(ctx context.Context, repo db.AgentRepository) error {
+			return repo.DeletePath(ctx, agentID, pathID)
+		}})
+	}
+	return append(append(deletes, updates...), creates...), nil
+}
+
+// changedFields lists the JSON fields whose values differ between two
+// versions of an agent or path. Missing, null and empty values are alike.
+func changedFields(old, new any) []string {
+	a, b := canonical(old), canonical(new)
+	keys := map[string]bool{}
+	for k := range a {
+		keys[k] = true
+	}
+	for k := range b {
+		keys[k] = true
+	}
+	var fields []string
+	for k := range keys {
+		if !reflect.DeepEqual(a[k], b[k]) {
+			fields = append(fields, k)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func canonical(v any) map[string]any {
+	data, _ := json.Marshal(v)
+	var m map[string]any
+	json.Unmarshal(data, &m)
+	m, _ = prune(m).(map[string]any)
+	return m
+}
+
+// prune drops null values and empty objects and arrays.
+func prune(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			if e = prune(e); e == nil {
+				delete(v, k)
+			} else {
+				v[k] = e
+			}
+		}
+		if len(v) == 0 {
+			return nil
+		}
+		return v
+	case []any:
+		if len(v) == 0 {
+			return nil
+		}
+		for i, e := range v {
+			v[i] = prune(e)
+		}
+		return v
+	}
+	return v
+}
+
+// Apply makes the changes of the plan, in order. It stops at the first
+// failure, leaving the changes before it made.
+func (p *Plan) Apply(ctx context.Context, repo db.AgentRepository) error {
+	for _, c := range p.Changes {
+		if c.apply == nil {
+			continue
+		}
+		if err := c.apply(ctx, repo); err != nil {
+			return fmt.Errorf("%s: %w", c, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package config
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"mi6/internal/db"
+)
+
+func newTestRepository(t *testing.T) db.AgentRepository {
+	t.Helper()
+	conn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "agents.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if err := db.RunMigrations(conn); err != nil {
+		t.Fatal(err)
+	}
+	return db.NewSQLiteRepository(conn)
+}
+
+func mustParse(t *testing.T, document string) *Document {
+	t.Helper()
+	doc, err := Parse([]byte(document), "test.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+// seed creates agents, each given as "name:port", with a GET /ping path.
+func seed(t *testing.T, repo db.AgentRepository, agents ...string) {
+	t.Helper()
+	for _, a := range agents {
+		name, port, _ := strings.Cut(a, ":")
+		paths := []db.AgentPath{{Method: "GET", Path: "/ping", MockResponse: db.MockResponse{StatusCode: 200, Response: "pong"}}}
+		if _, err := repo.CreateAgent(context.Background(), &db.Agent{Name: name, Port: port}, paths); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// ports lists the agents of the repository as "name:port", in name order.
+func ports(t *testing.T, repo db.AgentRepository) string {
+	t.Helper()
+	agents, err := repo.ListAgents(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []string
+	for _, a := range agents {
+		out = append(out, a.Name+":"+a.Port)
+	}
+	sort.Strings(out)
+	return strings.Join(out, " ")
+}
+
+const pingPath = `{method: GET, path: /ping, status_code: 200, response: pong}`
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		opts    Options
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "in sync",
+			doc:  `agents: [{name: shop, port: 18001, paths: [` + pingPath + `]}, {name: users, port: 18002, paths: [` + pingPath + `]}]`,
+			want: nil,
+		},
+		{
+			name: "paths and agents",
+			doc: `agents:
+  - {name: shop, port: 18001, paths: [{method: GET, path: /ping, status_code: 503, response: pong}, {path: /cart, response: "[]"}]}
+  - {name: users, port: 18002, paths: []}
+  - {name: orders, port: 18003, paths: [{path: /orders, response: "[]"}]}`,
+			want: []string{
+				"~ path shop GET /ping: status_code",
+				"+ path shop GET /cart",
+				"- path users GET /ping",
+				"+ agent orders",
+				"+ path orders GET /orders",
+			},
+		},
+		{
+			name: "undeclared agents are kept",
+			doc:  `agents: [{name: shop, port: 18001, paths: [` + pingPath + `]}]`,
+			want: nil,
+		},
+		{
+			name: "prune",
+			doc:  `agents: [{name: shop, port: 18001, paths: [` + pingPath + `]}]`,
+			opts: Options{Prune: true},
+			want: []string{"- agent users"},
+		},
+		{
+			name: "prune owned agents only",
+			doc:  `agents: [{name: shop, port: 18001, paths: [` + pingPath + `]}]`,
+			opts: Options{Prune: true, Owned: func(name string) bool { return name == "shop" }},
+			want: nil,
+		},
+		{
+			name: "port freed by a pruned agent",
+			doc:  `agents: [{name: shop, port: 18002, paths: [` + pingPath + `]}]`,
+			opts: Options{Prune: true},
+			want: []string{"- agent users", "~ agent shop: port"},
+		},
+		{
+			name:    "port of a kept agent",
+			doc:     `agents: [{name: shop, port: 18002, paths: [` + pingPath + `]}]`,
+			wantErr: `port 18002 is used by agent "users", which the document does not declare`,
+		},
+		{
+			name: "port moves in a chain",
+			doc:  `agents: [{name: shop, port: 18002, paths: [` + pingPath + `]}, {name: users, port: 18003, paths: [` + pingPath + `]}]`,
+			want: []string{"~ agent users: port", "~ agent shop: port"},
+		},
+		{
+			name:    "port swap",
+			doc:     `agents: [{name: shop, port: 18002, paths: [` + pingPath + `]}, {name: users, port: 18001, paths: [` + pingPath + `]}]`,
+			wantErr: "agents cannot swap ports in one change",
+		},
+		{
+			name:    "invalid document",
+			doc:     `agents: [{name: shop, port: 18001}, {name: users, port: 18001}]`,
+			wantErr: `port 18001 is also used by agent "shop"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newTestRepository(t)
+			seed(t, repo, "shop:18001", "users:18002")
+
+			plan, err := Diff(context.Background(), repo, mustParse(t, tt.doc), tt.opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got %v, want an error mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.TrimSpace(plan.String()); got != strings.Join(tt.want, "\n") {
+				t.Errorf("got plan:\n%s\nwant:\n%s", got, strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name  string
+		doc   string
+		opts  Options
+		ports string
+	}{
+		{
+			name:  "create, update and prune",
+			doc:   `agents: [{name: shop, port: 18001, paths: [{path: /cart, response: "[]"}]}, {name: orders, port: 18002}]`,
+			opts:  Options{Prune: true},
+			ports: "orders:18002 shop:18001",
+		},
+		{
+			name:  "port moves in a chain",
+			doc:   `agents: [{name: shop, port: 18002, paths: [` + pingPath + `]}, {name: users, port: 18003, paths: [` + pingPath + `]}]`,
+			ports: "shop:18002 users:18003",
+		},
+		{
+			name:  "port moves in a chain, declared the other way round",
+			doc:   `agents: [{name: users, port: 18003, paths: [` + pingPath + `]}, {name: shop, port: 18002, paths: [` + pingPath + `]}]`,
+			ports: "shop:18002 users:18003",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newTestRepository(t)
+			seed(t, repo, "shop:18001", "users:18002")
+			doc := mustParse(t, tt.doc)
+
+			plan, err := Diff(ctx, repo, doc, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := plan.Apply(ctx, repo); err != nil {
+				t.Fatalf("applying:\n%s: %v", plan, err)
+			}
+			if got := ports(t, repo); got != tt.ports {
+				t.Errorf("got agents %s, want %s", got, tt.ports)
+			}
+
+			again, err := Diff(ctx, repo, doc, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !again.Empty() {
+				t.Errorf("expected nothing left to apply, got:\n%s", again)
+			}
+		})
+	}
+}
+
+func TestApplyStopsAtFirstFailure(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepository(t)
+	seed(t, repo, "shop:18001")
+	plan, err := Diff(ctx, repo, mustParse(t, `agents: [{name: shop, port: 18001}, {name: users, port: 18002}, {name: orders, port: 18003}]`), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed(t, repo, "intruder:18002") // Taken between the diff and the apply
+
+	err = plan.Apply(ctx, repo)
+	if err == nil || !strings.Contains(err.Error(), "+ agent users") {
+		t.Fatalf("got %v, want the failing change named", err)
+	}
+	if got := ports(t, repo); got != "intruder:18002 shop:18001" {
+		t.Errorf("got agents %s, want the changes before the failure made and none after", got)
+	}
+}
@@ -0,0 +1,164 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"mi6/internal/db"
+)
+
+// DefaultDebounce is how long a Watcher waits for changes to settle before
+// applying them, so that an editor saving several files, or a file in
+// several writes, causes a single sync.
+const DefaultDebounce = 300 * time.Millisecond
+
+// Watcher keeps the repository in sync with a directory of documents,
+// applying them whenever they change.
+//
+// The watcher manages the agents the directory has declared since it
+// started: when one of them is no longer declared, it is deleted, but other
+// agents are left alone. A directory that fails to load or validate is not
+// applied at all, so agents keep their last good configuration until it is
+// fixed.
+type Watcher struct {
+	Dir      string
+	Repo     db.AgentRepository
+	Debounce time.Duration // DefaultDebounce when zero
+
+	mu     sync.Mutex
+	owned  map[string]bool
+	status WatchStatus
+}
+
+// WatchStatus describes the last sync of a Watcher.
+type WatchStatus struct {
+	Dir     string    `json:"dir"`
+	Synced  time.Time `json:"synced"`          // When the last sync was attempted
+	Changes int       `json:"changes"`         // Made by the last successful sync
+	Error   string    `json:"error,omitempty"` // Why the last sync failed, if it did
+	Managed []string  `json:"managed"`         // Agents the watcher manages
+}
+
+// NewWatcher creates a watcher applying the documents of dir to repo.
+func NewWatcher(dir string, repo db.AgentRepository) *Watcher {
+	return &Watcher{Dir: dir, Repo: repo, owned: map[string]bool{}, status: WatchStatus{Dir: dir, Managed: []string{}}}
+}
+
+// Status returns the outcome of the last sync.
+func (w *Watcher) Status() WatchStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	status := w.status
+	status.Managed = append([]string(nil), w.status.Managed...)
+	return status
+}
+
+func (w *Watcher) owns(name string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.owned[name]
+}
+
+// Sync applies the directory's documents once.
+func (w *Watcher) Sync(ctx context.Context) error {
+	doc, err := Load(w.Dir)
+	var plan *Plan
+	if err == nil {
+		plan, err = Diff(ctx, w.Repo, doc, Options{Prune: true, Owned: w.owns})
+	}
+	applied := false
+	if err == nil {
+		err = plan.Apply(ctx, w.Repo)
+		applied = true
+	}
+
+	w.mu.Lock()
+	if applied {
+		// After a failed apply some agents may exist either way, so the
+		// watcher keeps managing the old ones as well as the new.
+		if err == nil {
+			w.owned = map[string]bool{}
+		}
+		for _, d := range doc.Agents {
+			w.owned[d.Name] = true
+		}
+	}
+	w.status.Synced = time.Now()
+	w.status.Error = ""
+	if err != nil {
+		w.status.Error = err.Error()
+	} else {
+		w.status.Changes = len(plan.Changes)
+	}
+	w.status.Managed = w.status.Managed[:0]
+	for name := range w.owned {
+		w.status.Managed = append(w.status.Managed, name)
+	}
+	sort.Strings(w.status.Managed)
+	w.mu.Unlock()
+
+	if err != nil {
+		log.Printf("Watch: %s not applied; agents keep their current configuration: %v", w.Dir, err)
+		return err
+	}
+	if !plan.Empty() {
+		log.Printf("Watch: applied %d changes from %s:\n%s", len(plan.Changes), w.Dir, plan)
+	}
+	return nil
+}
+
+// Run syncs the directory, then again whenever a document in it is created,
+// changed, renamed or removed, until ctx is done. Failed syncs are reported
+// through the log and Status; Run only fails if the directory cannot be
+// watched.
+func (w *Watcher) Run(ctx context.Context) error {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer fw.Close()
+	if err := fw.Add(w.Dir); err != nil {
+		return fmt.Errorf("cannot watch %s: %w", w.Dir, err)
+	}
+	debounce := w.Debounce
+	if debounce == 0 {
+		debounce = DefaultDebounce
+	}
+
+	log.Printf("Watch: watching %s for agent documents", w.Dir)
+	w.Sync(ctx)
+
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-fw.Events:
+			if !ok {
+				return nil
+			}
+			if IsDocument(event.Name) && event.Op != fsnotify.Chmod {
+				timer.Reset(debounce)
+			}
+		case err, ok := <-fw.Errors:
+			if !ok {
+				return nil
+			}
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				timer.Reset(debounce) // Some events were lost: sync to be safe
+			}
+			log.Printf("Watch: %v", err)
+		case <-timer.C:
+			w.Sync(ctx)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeDocument(t *testing.T, dir, name, document string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(document), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatcherSync(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	repo := newTestRepository(t)
+	seed(t, repo, "manual:18009")
+	w := NewWatcher(dir, repo)
+
+	writeDocument(t, dir, "shop.yaml", `{name: shop, port: 18001, paths: [`+pingPath+`]}`)
+	writeDocument(t, dir, "users.yaml", `{name: users, port: 18002, paths: [`+pingPath+`]}`)
+	writeDocument(t, dir, "notes.txt", `not a document`)
+	if err := w.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := ports(t, repo); got != "manual:18009 shop:18001 users:18002" {
+		t.Fatalf("got agents %s, want the directory's next to the manual one", got)
+	}
+	if s := w.Status(); s.Error != "" || s.Changes != 4 || strings.Join(s.Managed, " ") != "shop users" {
+		t.Errorf("got status %+v, want 4 changes managing shop and users", s)
+	}
+
+	// A broken document is not applied at all
+	writeDocument(t, dir, "users.yaml", `{name: users, port: [}`)
+	os.Remove(filepath.Join(dir, "shop.yaml"))
+	if err := w.Sync(ctx); err == nil {
+		t.Fatal("expected the broken document to fail")
+	}
+	if got := ports(t, repo); got != "manual:18009 shop:18001 users:18002" {
+		t.Errorf("got agents %s, want them kept", got)
+	}
+	if s := w.Status(); s.Error == "" || strings.Join(s.Managed, " ") != "shop users" {
+		t.Errorf("got status %+v, want the error reported", s)
+	}
+
+	// Fixing it prunes the agents the directory no longer declares, but only those
+	writeDocument(t, dir, "users.yaml", `{name: users, port: 18002, paths: [`+pingPath+`]}`)
+	if err := w.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := ports(t, repo); got != "manual:18009 users:18002" {
+		t.Errorf("got agents %s, want shop deleted and manual kept", got)
+	}
+	if s := w.Status(); s.Error != "" || strings.Join(s.Managed, " ") != "users" {
+		t.Errorf("got status %+v, want the error cleared", s)
+	}
+}
+
+func TestWatcherRecoversFromPortSwap(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	repo := newTestRepository(t)
+	w := NewWatcher(dir, repo)
+
+	writeDocument(t, dir, "agents.yaml", `agents: [{name: shop, port: 18001}, {name: users, port: 18002}]`)
+	if err := w.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	writeDocument(t, dir, "agents.yaml", `agents: [{name: shop, port: 18002}, {name: users, port: 18001}]`)
+	if err := w.Sync(ctx); err == nil || !strings.Contains(err.Error(), "cannot swap ports") {
+		t.Fatalf("got %v, want the swap rejected", err)
+	}
+	if got := ports(t, repo); got != "shop:18001 users:18002" {
+		t.Errorf("got agents %s, want them untouched", got)
+	}
+
+	// Swapping through a free port, one save at a time, works
+	for _, document := range []string{
+		`agents: [{name: shop, port: 18003}, {name: users, port: 18002}]`,
+		`agents: [{name: shop, port: 18003}, {name: users, port: 18001}]`,
+		`agents: [{name: shop, port: 18002}, {name: users, port: 18001}]`,
+	} {
+		writeDocument(t, dir, "agents.yaml", document)
+		if err := w.Sync(ctx); err != nil {
+			t.Fatalf("%s: %v", document, err)
+		}
+	}
+	if got := ports(t, repo); got != "shop:18002 users:18001" {
+		t.Errorf("got agents %s, want the ports swapped", got)
+	}
+	if s := w.Status(); s.Error != "" {
+		t.Errorf("got error %q, want it cleared", s.Error)
+	}
+}
+
+func TestWatcherRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	dir := t.TempDir()
+	repo := newTestRepository(t)
+	w := NewWatcher(dir, repo)
+	w.Debounce = 10 * time.Millisecond
+
+	done := make(chan error)
+	go func() { done <- w.Run(ctx) }()
+	waitFor := func(want string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for ports(t, repo) != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("got agents %q, want %q", ports(t, repo), want)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	for w.Status().Synced.IsZero() { // The initial sync
+		time.Sleep(10 * time.Millisecond)
+	}
+	writeDocument(t, dir, "shop.yaml", `{name: shop, port: 18001}`)
+	waitFor("shop:18001")
+	writeDocument(t, dir, "shop.yaml", `{name: shop, port: 18005}`)
+	waitFor("shop:18005")
+	os.Remove(filepath.Join(dir, "shop.yaml"))
+	waitFor("")
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatcherRunFailsWithoutDirectory(t *testing.T) {
+	w := NewWatcher(filepath.Join(t.TempDir(), "missing"), newTestRepository(t))
+	if err := w.Run(context.Background()); err == nil {
+		t.Fatal("expected a missing directory to fail")
+	}
+}
@@ -0,0 +1,159 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RequestEntry records a single request received by a mock agent.
+type RequestEntry struct {
+	Id         int64       `json:"id"`
+	AgentID    int         `json:"agent_id"`
+	PathID     int         `json:"path_id"` // 0 when no mock path matched
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	Headers    http.Header `json:"headers"`
+	Body       string      `json:"body"`
+	Status     int         `json:"status"`          // 0 when a fault broke the connection, StatusClientClosedRequest when the client left first
+	Fault      string      `json:"fault,omitempty"` // Type of the fault served, if any
+	ReceivedAt time.Time   `json:"received_at"`
+
+	// Violations lists how the request broke the agent's OpenAPI spec, if it has one.
+	Violations []string `json:"violations,omitempty"`
+}
+
+// StatusClientClosedRequest is journaled for a request whose client went away
+// before anything was written, e.g. during an injected delay. It is the
+// status nginx logs in that case; no response carries it.
+const StatusClientClosedRequest = 499
+
+// RequestFilter narrows down a journal listing. Zero-valued fields match everything.
+type RequestFilter struct {
+	Method string
+	Path   string // Matches the URL path exactly, ignoring the query string
+	PathID int
+	Status int
+	Since  time.Time
+	Limit  int // Keeps only the most recent entries when positive
+}
+
+// Matches reports whether an entry satisfies the filter (Limit is not considered).
+func (f RequestFilter) Matches(e RequestEntry) bool {
+	if f.Method != "" && !strings.EqualFold(f.Method, e.Method) {
+		return false
+	}
+	if f.Path != "" {
+		path, _, _ := strings.Cut(e.URL, "?")
+		if path != f.Path {
+			return false
+		}
+	}
+	if f.PathID != 0 && f.PathID != e.PathID {
+		return false
+	}
+	if f.Status != 0 && f.Status != e.Status {
+		return false
+	}
+	if !f.Since.IsZero() && e.ReceivedAt.Before(f.Since) {
+		return false
+	}
+	return true
+}
+
+// JournalRepository persists the requests received by mock agents.
+type JournalRepository interface {
+	AppendRequest(ctx context.Context, entry *RequestEntry) error
+	ListRequests(ctx context.Context, agentID int, filter RequestFilter) ([]RequestEntry, error)
+	ClearRequests(ctx context.Context, agentID int) error
+}
+
+// AppendRequest stores a journal entry and sets its ID.
+func (r *SQLiteRepository) AppendRequest(ctx context.Context, entry *RequestEntry) error {
+	headers, err := json.Marshal(entry.Headers)
+	if err != nil {
+		return fmt.Errorf("failed to encode request headers: %w", err)
+	}
+	res, err := r.db.ExecContext(ctx,
+		"INSERT INTO request_journal(agent_id, path_id, method, url, headers, body, status, fault, received_at, violations) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		entry.AgentID, entry.PathID, entry.Method, entry.URL, string(headers), entry.Body, entry.Status, entry.Fault, entry.ReceivedAt.UTC(), jsonValue{entry.Violations})
+	if err != nil {
+		return fmt.Errorf("failed to insert journal entry: %w", err)
+	}
+	entry.Id, _ = res.LastInsertId()
+	return nil
+}
+
+// ListRequests fetches an agent's journal in the order the requests were received.
+func (r *SQLiteRepository) ListRequests(ctx context.Context, agentID int, filter RequestFilter) ([]RequestEntry, error) {
+	query := "SELECT id, agent_id, path_id, method, url, headers, body, status, fault, received_at, violations FROM request_journal WHERE agent_id = ?"
+	args := []any{agentID}
+	if filter.Method != "" {
+		query += " AND method = ?"
+		args = append(args, strings.ToUpper(filter.Method))
+	}
+	if filter.Path != "" {
+		query += " AND (url = ? OR url LIKE ? ESCAPE '\\')"
+		args = append(args, filter.Path, escapeLike(filter.Path)+"?%")
+	}
+	if filter.PathID != 0 {
+		query += " AND path_id = ?"
+		args = append(args, filter.PathID)
+	}
+	if filter.Status != 0 {
+		query += " AND status = ?"
+		args = append(args, filter.Status)
+	}
+	if !filter.Since.IsZero() {
+		query += " AND received_at >= ?"
+		args = append(args, filter.Since.UTC())
+	}
+	query += " ORDER BY id DESC"
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", filter.Limit)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []RequestEntry
+	for rows.Next() {
+		var e RequestEntry
+		var headers string
+		if err := rows.Scan(&e.Id, &e.AgentID, &e.PathID, &e.Method, &e.URL, &headers, &e.Body, &e.Status, &e.Fault, &e.ReceivedAt, jsonValue{&e.Violations}); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(headers), &e.Headers); err != nil {
+			return nil, fmt.Errorf("failed to decode headers of journal entry %d: %w", e.Id, err)
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Rows were read newest first so that LIMIT keeps the most recent ones.
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, nil
+}
+
+// ClearRequests removes every journal entry recorded for an agent.
+func (r *SQLiteRepository) ClearRequests(ctx context.Context, agentID int) error {
+	if _, err := r.db.ExecContext(ctx, "DELETE FROM request_journal WHERE agent_id = ?", agentID); err != nil {
+		return fmt.Errorf("failed to clear journal: %w", err)
+	}
+	return nil
+}
+
+// escapeLike escapes the LIKE wildcards in s.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,26 @@
+package db
+
+// Condition sources: which part of a request a Condition inspects.
+const (
+	SourceQuery  = "query"
+	SourceHeader = "header"
+	SourceBody   = "body"
+)
+
+// Predicate is a test applied to a single request value. Every populated
+// field must hold for the predicate to pass.
+type Predicate struct {
+	Equals   *string `json:"equals,omitempty"`
+	Contains string  `json:"contains,omitempty"`
+	Matches  string  `json:"matches,omitempty"` // Regular expression
+	Absent   bool    `json:"absent,omitempty"`  // Passes only when the value is missing
+}
+
+// Condition applies a predicate to one part of a request.
+type Condition struct {
+	Source string `json:"source"` // SourceQuery, SourceHeader or SourceBody
+	// Key is the query parameter or header name. For the body it is an optional
+	// JSONPath (e.g. "$.order.status") selecting a field of a JSON body.
+	Key string `json:"key,omitempty"`
+	Predicate
+}
@@ -0,0 +1,370 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3" // For the scratch database of adoptLegacySchema
+)
+
+// migrationFiles holds the schema migrations, named
+// "<version>_<name>.up.sql" and "<version>_<name>.down.sql". Versions start
+// at 1 and follow each other without gaps; a migration, once released, is
+// never edited; a new one is added instead.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// createMigrationsTable creates the table recording the migrations applied.
+const createMigrationsTable = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+	version INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	applied_at TIMESTAMP NOT NULL
+);`
+
+// Migration is one step of the schema's history.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string // SQL applying the step
+	Down    string // SQL undoing it
+}
+
+// Migrations lists the schema migrations, oldest first.
+func Migrations() ([]Migration, error) {
+	names, err := fs.Glob(migrationFiles, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*Migration{}
+	for _, name := range names {
+		base := path.Base(name)
+		stem, direction, ok := strings.Cut(strings.TrimSuffix(base, ".sql"), ".")
+		prefix, label, _ := strings.Cut(stem, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version < 1 || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("badly named migration %s", base)
+		}
+		data, err := migrationFiles.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: label}
+			byVersion[version] = m
+		} else if m.Name != label {
+			return nil, fmt.Errorf("migration %d is named both %q and %q", version, m.Name, label)
+		}
+		if direction == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for v := 1; v <= len(byVersion); v++ {
+		m := byVersion[v]
+		if m == nil {
+			return nil, fmt.Errorf("migration %d is missing", v)
+		}
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", v, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	return migrations, nil
+}
+
+// RunMigrations brings the SQLite schema up to date, applying each pending
+// migration in its own transaction. Databases created before migrations
+// were versioned are adopted first.
+func RunMigrations(db *sql.DB) error {
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+	return MigrateTo(db, len(migrations))
+}
+
+// MigrateTo applies or rolls back migrations until the schema is at version.
+// Version 0 is an empty database.
+func MigrateTo(db *sql.DB, version int) error {
+	ctx := context.Background()
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+	if version < 0 || version > len(migrations) {
+		return fmt.Errorf("no schema version %d; the latest is %d", version, len(migrations))
+	}
+	if err := prepare(ctx, db); err != nil {
+		return err
+	}
+
+	current, err := SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if current > len(migrations) {
+		return fmt.Errorf("database schema is at version %d, newer than this MI6 knows (%d)", current, len(migrations))
+	}
+	for ; current < version; current++ {
+		m := migrations[current]
+		if err := step(ctx, db, m.Up, "INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)", m.Version, m.Name, time.Now().UTC()); err != nil {
+			return fmt.Errorf("failed to apply migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+	}
+	for ; current > version; current-- {
+		m := migrations[current-1]
+		if err := step(ctx, db, m.Down, "DELETE FROM schema_migrations WHERE version = ?", m.Version); err != nil {
+			return fmt.Errorf("failed to roll back migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
+
+// Rollback undoes the latest steps migrations.
+func Rollback(db *sql.DB, steps int) error {
+	if err := prepare(context.Background(), db); err != nil {
+		return err
+	}
+	current, err := SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	return MigrateTo(db, max(current-steps, 0))
+}
+
+// SchemaVersion returns the version of the latest migration applied.
+func SchemaVersion(db *sql.DB) (int, error) {
+	var version int
+	err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+// prepare adopts a database created before migrations were versioned, and
+// makes sure the schema_migrations table exists.
+func prepare(ctx context.Context, db *sql.DB) error {
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+	if err := adoptLegacySchema(ctx, db, migrations); err != nil {
+		return fmt.Errorf("failed to adopt existing database: %w", err)
+	}
+	if _, err := db.ExecContext(ctx, createMigrationsTable); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+// step runs a migration's SQL and records it, all or nothing.
+func step(ctx context.Context, db *sql.DB, script, record string, args ...any) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// adoptLegacySchema brings a database created before migrations were
+// versioned to the latest schema, and records every migration as applied.
+// Such databases only ever had missing tables created, so their tables may
+// date from any point in the schema's history. Each table lacking columns is
+// rebuilt to its latest definition, keeping its rows; columns it lacked take
+// their defaults.
+func adoptLegacySchema(ctx context.Context, db *sql.DB, migrations []Migration) error {
+	var legacy, versioned bool
+	err := db.QueryRowContext(ctx, `
+	SELECT
+		EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'agents'),
+		EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations')`).Scan(&legacy, &versioned)
+	if err != nil {
+		return err
+	}
+	if !legacy || versioned {
+		return nil // A new database, or one whose migrations are recorded
+	}
+
+	target, err := latestSchema(ctx, migrations)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, t := range target {
+		columns, err := tableColumns(ctx, tx, t.name)
+		if err != nil {
+			return err
+		}
+		switch {
+		case len(columns) == 0:
+			if _, err := tx.ExecContext(ctx, t.sql); err != nil {
+				return fmt.Errorf("failed to create %s table: %w", t.name, err)
+			}
+		case !containsAll(columns, t.columns):
+			if err := rebuildTable(ctx, tx, t, columns); err != nil {
+				return fmt.Errorf("failed to rebuild %s table: %w", t.name, err)
+			}
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, createMigrationsTable); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	for _, m := range migrations {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)", m.Version, m.Name, now); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// table is a table's definition in the latest schema.
+type table struct {
+	name    string
+	sql     string
+	columns []string
+}
+
+// latestSchema applies every migration to a scratch in-memory database and
+// reads back the resulting tables.
+func latestSchema(ctx context.Context, migrations []Migration) ([]table, error) {
+	scratch, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		return nil, err
+	}
+	defer scratch.Close()
+	scratch.SetMaxOpenConns(1) // Every connection would get its own database
+
+	for _, m := range migrations {
+		if _, err := scratch.ExecContext(ctx, m.Up); err != nil {
+			return nil, fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+	}
+
+	rows, err := scratch.QueryContext(ctx, "SELECT name, sql FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY rowid")
+	if err != nil {
+		return nil, err
+	}
+	var tables []table
+	for rows.Next() {
+		var t table
+		if err := rows.Scan(&t.name, &t.sql); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		tables = append(tables, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range tables {
+		if tables[i].columns, err = tableColumns(ctx, scratch, tables[i].name); err != nil {
+			return nil, err
+		}
+	}
+	return tables, nil
+}
+
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// tableColumns lists a table's columns; none when the table does not exist.
+func tableColumns(ctx context.Context, q querier, name string) ([]string, error) {
+	rows, err := q.QueryContext(ctx, "SELECT name FROM pragma_table_info(?)", name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var columns []string
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+	}
+	return columns, rows.Err()
+}
+
+// rebuildTable replaces a table with one created from its latest definition,
+// copying over the columns both have. Its AUTOINCREMENT counter is kept, so
+// that the ids of deleted rows are not handed out again.
+func rebuildTable(ctx context.Context, tx *sql.Tx, t table, columns []string) error {
+	var seq int64
+	err := tx.QueryRowContext(ctx, "SELECT seq FROM sqlite_sequence WHERE name = ?", t.name).Scan(&seq)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	var common []string
+	for _, c := range t.columns {
+		if slices.Contains(columns, c) {
+			common = append(common, `"`+c+`"`)
+		}
+	}
+	scratch := t.name + "_rebuilt"
+	definition := `CREATE TABLE "` + scratch + `" ` + t.sql[strings.Index(t.sql, "("):]
+	list := strings.Join(common, ", ")
+
+	for _, stmt := range []string{
+		definition,
+		fmt.Sprintf(`INSERT INTO "%s" (%s) SELECT %s FROM "%s"`, scratch, list, list, t.name),
+		fmt.Sprintf(`DROP TABLE "%s"`, t.name),
+		fmt.Sprintf(`ALTER TABLE "%s" RENAME TO "%s"`, scratch, t.name),
+	} {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	res, err := tx.ExecContext(ctx, "UPDATE sqlite_sequence SET seq = MAX(seq, ?) WHERE name = ?", seq, t.name)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 && seq > 0 {
+		_, err = tx.ExecContext(ctx, "INSERT INTO sqlite_sequence (name, seq) VALUES (?, ?)", t.name, seq)
+	}
+	return err
+}
+
+func containsAll(have, want []string) bool {
+	for _, c := range want {
+		if !slices.Contains(have, c) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,362 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// openTestDB opens an empty database file that is removed after the test.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	conn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "agents.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func mustExec(t *testing.T, conn *sql.DB, query string, args ...any) {
+	t.Helper()
+	if _, err := conn.Exec(query, args...); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+}
+
+// baselineSchema is what RunMigrations created before paths had a method.
+const baselineSchema = `
+CREATE TABLE IF NOT EXISTS agents (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE,
+	port TEXT NOT NULL UNIQUE,
+	status TEXT NOT NULL DEFAULT 'stopped'
+);
+CREATE TABLE IF NOT EXISTS agent_paths (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	agent_id INTEGER NOT NULL,
+	path TEXT NOT NULL,
+	response TEXT NOT NULL,
+	UNIQUE (agent_id, path),
+	FOREIGN KEY (agent_id) REFERENCES agents(id) ON DELETE CASCADE
+);`
+
+func TestRunMigrationsUpgradesBaselineDatabase(t *testing.T) {
+	ctx := context.Background()
+	conn := openTestDB(t)
+	mustExec(t, conn, baselineSchema)
+	mustExec(t, conn, "INSERT INTO agents (name, port) VALUES ('users', '18000')")
+	mustExec(t, conn, "INSERT INTO agent_paths (agent_id, path, response) VALUES (1, '/users', '[]')")
+
+	if err := RunMigrations(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := NewSQLiteRepository(conn)
+	agents, err := repo.ListAgents(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(agents) != 1 || agents[0].Name != "users" || agents[0].Port != "18000" {
+		t.Fatalf("got agents %+v, want the baseline agent", agents)
+	}
+	paths, err := repo.GetAgentPaths(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 1 || paths[0].Method != "GET" || paths[0].Response != "[]" || paths[0].StatusCode != 200 {
+		t.Fatalf("got paths %+v, want the baseline path answering GET with 200", paths)
+	}
+
+	// The unique constraint now includes the method
+	if _, err := repo.AddPath(ctx, 1, AgentPath{Method: "POST", Path: "/users"}); err != nil {
+		t.Fatalf("adding POST next to GET: %v", err)
+	}
+	if _, err := repo.AddPath(ctx, 1, AgentPath{Method: "GET", Path: "/users"}); err == nil {
+		t.Fatal("expected a second GET /users to be rejected")
+	}
+}
+
+// schema returns the definition of every table and index, by name.
+func schema(t *testing.T, conn *sql.DB) map[string]string {
+	t.Helper()
+	rows, err := conn.Query("SELECT name, COALESCE(sql, '') FROM sqlite_master WHERE name NOT LIKE 'sqlite_%' AND name != 'schema_migrations'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	out := map[string]string{}
+	for rows.Next() {
+		var name, definition string
+		if err := rows.Scan(&name, &definition); err != nil {
+			t.Fatal(err)
+		}
+		// Renaming a table quotes its name in its definition
+		out[name] = strings.Replace(definition, `"`+name+`"`, name, 1)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// columns returns the columns of every table, by table name.
+func columns(t *testing.T, conn *sql.DB) map[string][]string {
+	t.Helper()
+	out := map[string][]string{}
+	for name, definition := range schema(t, conn) {
+		if !strings.HasPrefix(definition, "CREATE TABLE") {
+			continue
+		}
+		cols, err := tableColumns(context.Background(), conn, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out[name] = cols
+	}
+	return out
+}
+
+func schemaVersion(t *testing.T, conn *sql.DB) int {
+	t.Helper()
+	version, err := SchemaVersion(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return version
+}
+
+// seedAgents adds agents 1 and 2, each with a path, using only the columns
+// of the first migration, then deletes agent 2, so that the next agent
+// created is number 3 unless the AUTOINCREMENT counter was lost.
+func seedAgents(t *testing.T, conn *sql.DB) {
+	t.Helper()
+	mustExec(t, conn, "INSERT INTO agents (name, port) VALUES ('users', '18000'), ('gone', '18001')")
+	mustExec(t, conn, "INSERT INTO agent_paths (agent_id, path, response) VALUES (1, '/users', '[]'), (2, '/gone', '')")
+	mustExec(t, conn, "DELETE FROM agent_paths WHERE agent_id = 2")
+	mustExec(t, conn, "DELETE FROM agents WHERE id = 2")
+}
+
+// checkAgents checks that the rows of seedAgents survived, and that ids are
+// not reused.
+func checkAgents(t *testing.T, conn *sql.DB) {
+	t.Helper()
+	ctx := context.Background()
+	repo := NewSQLiteRepository(conn)
+	agents, err := repo.ListAgents(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(agents) != 1 || agents[0].Id != 1 || agents[0].Name != "users" {
+		t.Fatalf("got agents %+v, want users alone", agents)
+	}
+	paths, err := repo.GetAgentPaths(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 1 || paths[0].Path != "/users" || paths[0].Method != "GET" || paths[0].Response != "[]" {
+		t.Fatalf("got paths %+v, want GET /users", paths)
+	}
+	id, err := repo.CreateAgent(ctx, &Agent{Name: "new", Port: "18002"}, []AgentPath{{Method: "GET", Path: "/new"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 3 {
+		t.Errorf("got agent id %d, want 3: the id of the deleted agent was handed out again", id)
+	}
+	paths, err = repo.GetAgentPaths(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 1 || paths[0].Id != 3 {
+		t.Errorf("got paths %+v, want path id 3: the id of the deleted path was handed out again", paths)
+	}
+}
+
+func TestRunMigrationsCreatesFreshDatabase(t *testing.T) {
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := openTestDB(t)
+	if err := RunMigrations(conn); err != nil {
+		t.Fatal(err)
+	}
+	if got := schemaVersion(t, conn); got != len(migrations) {
+		t.Fatalf("got schema version %d, want %d", got, len(migrations))
+	}
+
+	latest, err := latestSchema(context.Background(), migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := columns(t, conn)
+	if len(got) != len(latest) {
+		t.Errorf("got tables %v, want %d", got, len(latest))
+	}
+	for _, table := range latest {
+		if !slices.Equal(got[table.name], table.columns) {
+			t.Errorf("%s: got columns %v, want %v", table.name, got[table.name], table.columns)
+		}
+	}
+
+	// Running again changes nothing
+	before := schema(t, conn)
+	if err := RunMigrations(conn); err != nil {
+		t.Fatal(err)
+	}
+	if after := schema(t, conn); !maps.Equal(before, after) {
+		t.Errorf("running the migrations again changed the schema")
+	}
+}
+
+// TestRunMigrationsAdoptsLegacyDatabases covers databases left by the
+// releases before migrations were versioned, whose tables may date from any
+// point in the schema's history.
+func TestRunMigrationsAdoptsLegacyDatabases(t *testing.T) {
+	ctx := context.Background()
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fresh := openTestDB(t)
+	if err := RunMigrations(fresh); err != nil {
+		t.Fatal(err)
+	}
+	want := columns(t, fresh)
+
+	for n := 1; n <= len(migrations); n++ {
+		t.Run(fmt.Sprintf("%04d_%s", n, migrations[n-1].Name), func(t *testing.T) {
+			conn := openTestDB(t)
+			for _, m := range migrations[:n] {
+				if _, err := conn.ExecContext(ctx, m.Up); err != nil {
+					t.Fatalf("migration %d: %v", m.Version, err)
+				}
+			}
+			seedAgents(t, conn)
+
+			if err := RunMigrations(conn); err != nil {
+				t.Fatal(err)
+			}
+			if got := schemaVersion(t, conn); got != len(migrations) {
+				t.Fatalf("got schema version %d, want %d", got, len(migrations))
+			}
+			if got := columns(t, conn); !maps.EqualFunc(got, want, slices.Equal) {
+				t.Errorf("got columns %v, want %v", got, want)
+			}
+			checkAgents(t, conn)
+		})
+	}
+}
+
+// TestRunMigrationsResumesPartialMigration covers databases whose schema is
+// versioned but behind, such as those of an older release.
+func TestRunMigrationsResumesPartialMigration(t *testing.T) {
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n := 1; n < len(migrations); n++ {
+		t.Run(fmt.Sprintf("from %d", n), func(t *testing.T) {
+			conn := openTestDB(t)
+			if err := MigrateTo(conn, n); err != nil {
+				t.Fatal(err)
+			}
+			if got := schemaVersion(t, conn); got != n {
+				t.Fatalf("got schema version %d, want %d", got, n)
+			}
+			seedAgents(t, conn)
+
+			if err := RunMigrations(conn); err != nil {
+				t.Fatal(err)
+			}
+			if got := schemaVersion(t, conn); got != len(migrations) {
+				t.Fatalf("got schema version %d, want %d", got, len(migrations))
+			}
+			checkAgents(t, conn)
+		})
+	}
+}
+
+func TestMigrationsRoundTrip(t *testing.T) {
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := openTestDB(t)
+	if err := RunMigrations(conn); err != nil {
+		t.Fatal(err)
+	}
+	seedAgents(t, conn)
+
+	// Each migration, undone and redone, leaves the schema as it was
+	for v := len(migrations); v >= 1; v-- {
+		m := migrations[v-1]
+		before := schema(t, conn)
+		if err := Rollback(conn, 1); err != nil {
+			t.Fatalf("rolling back %04d_%s: %v", m.Version, m.Name, err)
+		}
+		if got := schemaVersion(t, conn); got != v-1 {
+			t.Fatalf("rolled back %04d_%s: got schema version %d", m.Version, m.Name, got)
+		}
+		if err := MigrateTo(conn, v); err != nil {
+			t.Fatalf("reapplying %04d_%s: %v", m.Version, m.Name, err)
+		}
+		if after := schema(t, conn); !maps.Equal(before, after) {
+			t.Errorf("%04d_%s: the schema differs after rolling back and reapplying it", m.Version, m.Name)
+		}
+		if err := Rollback(conn, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := schema(t, conn); len(got) != 0 {
+		t.Errorf("got %v at version 0, want no tables", got)
+	}
+
+	// Down to the first migration and back up again keeps the rows
+	conn = openTestDB(t)
+	if err := RunMigrations(conn); err != nil {
+		t.Fatal(err)
+	}
+	seedAgents(t, conn)
+	if err := MigrateTo(conn, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := RunMigrations(conn); err != nil {
+		t.Fatal(err)
+	}
+	checkAgents(t, conn)
+
+	if err := Rollback(conn, len(migrations)+1); err != nil {
+		t.Fatalf("rolling back past the first migration: %v", err)
+	}
+	if got := schemaVersion(t, conn); got != 0 {
+		t.Errorf("got schema version %d, want 0", got)
+	}
+}
+
+func TestMigrateToRejectsUnknownVersions(t *testing.T) {
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := openTestDB(t)
+	for _, version := range []int{-1, len(migrations) + 1} {
+		if err := MigrateTo(conn, version); err == nil {
+			t.Errorf("expected version %d to be rejected", version)
+		}
+	}
+
+	if err := RunMigrations(conn); err != nil {
+		t.Fatal(err)
+	}
+	mustExec(t, conn, "INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, 'future', CURRENT_TIMESTAMP)", len(migrations)+1)
+	if err := RunMigrations(conn); err == nil || !strings.Contains(err.Error(), "newer than this MI6 knows") {
+		t.Errorf("got %v, want a newer schema refused", err)
+	}
+}
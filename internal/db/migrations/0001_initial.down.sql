@@ -0,0 +1,2 @@
+DROP TABLE agent_paths;
+DROP TABLE agents;
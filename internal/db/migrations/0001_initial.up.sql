@@ -0,0 +1,15 @@
+CREATE TABLE agents (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE,
+    port TEXT NOT NULL UNIQUE,
+    status TEXT NOT NULL DEFAULT 'stopped'
+);
+
+CREATE TABLE agent_paths (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    agent_id INTEGER NOT NULL,
+    path TEXT NOT NULL,
+    response TEXT NOT NULL,
+    UNIQUE (agent_id, path),
+    FOREIGN KEY (agent_id) REFERENCES agents(id) ON DELETE CASCADE
+);
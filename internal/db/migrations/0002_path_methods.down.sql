@@ -0,0 +1,17 @@
+-- Of the paths mocked for several methods, only the first one is kept.
+CREATE TABLE agent_paths_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    agent_id INTEGER NOT NULL,
+    path TEXT NOT NULL,
+    response TEXT NOT NULL,
+    UNIQUE (agent_id, path),
+    FOREIGN KEY (agent_id) REFERENCES agents(id) ON DELETE CASCADE
+);
+INSERT OR IGNORE INTO agent_paths_old (id, agent_id, path, response)
+    SELECT id, agent_id, path, response FROM agent_paths ORDER BY id;
+-- Keep the AUTOINCREMENT counter, so that ids of deleted paths are not reused.
+DELETE FROM sqlite_sequence WHERE name = 'agent_paths_old';
+INSERT INTO sqlite_sequence (name, seq)
+    SELECT 'agent_paths_old', seq FROM sqlite_sequence WHERE name = 'agent_paths';
+DROP TABLE agent_paths;
+ALTER TABLE agent_paths_old RENAME TO agent_paths;
@@ -0,0 +1,18 @@
+-- The unique constraint gains the method, which takes rebuilding the table.
+CREATE TABLE agent_paths_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    agent_id INTEGER NOT NULL,
+    path TEXT NOT NULL,
+    method TEXT NOT NULL DEFAULT 'GET',
+    response TEXT NOT NULL,
+    UNIQUE (agent_id, path, method),
+    FOREIGN KEY (agent_id) REFERENCES agents(id) ON DELETE CASCADE
+);
+INSERT INTO agent_paths_new (id, agent_id, path, response)
+    SELECT id, agent_id, path, response FROM agent_paths;
+-- Keep the AUTOINCREMENT counter, so that ids of deleted paths are not reused.
+DELETE FROM sqlite_sequence WHERE name = 'agent_paths_new';
+INSERT INTO sqlite_sequence (name, seq)
+    SELECT 'agent_paths_new', seq FROM sqlite_sequence WHERE name = 'agent_paths';
+DROP TABLE agent_paths;
+ALTER TABLE agent_paths_new RENAME TO agent_paths;
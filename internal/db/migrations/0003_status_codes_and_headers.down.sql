@@ -0,0 +1,2 @@
+ALTER TABLE agent_paths DROP COLUMN headers;
+ALTER TABLE agent_paths DROP COLUMN status_code;
@@ -0,0 +1,2 @@
+ALTER TABLE agent_paths ADD COLUMN status_code INTEGER NOT NULL DEFAULT 200;
+ALTER TABLE agent_paths ADD COLUMN headers TEXT NOT NULL DEFAULT '{}';
@@ -0,0 +1,12 @@
+CREATE TABLE request_journal (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    agent_id INTEGER NOT NULL,
+    path_id INTEGER NOT NULL DEFAULT 0,
+    method TEXT NOT NULL,
+    url TEXT NOT NULL,
+    headers TEXT NOT NULL DEFAULT '{}',
+    body TEXT NOT NULL DEFAULT '',
+    status INTEGER NOT NULL,
+    received_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (agent_id) REFERENCES agents(id) ON DELETE CASCADE
+);
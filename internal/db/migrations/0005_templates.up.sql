@@ -0,0 +1 @@
+ALTER TABLE agent_paths ADD COLUMN templated INTEGER NOT NULL DEFAULT 0;
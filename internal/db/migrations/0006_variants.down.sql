@@ -0,0 +1 @@
+ALTER TABLE agent_paths DROP COLUMN variants;
@@ -0,0 +1 @@
+ALTER TABLE agent_paths ADD COLUMN variants TEXT NOT NULL DEFAULT '[]';
@@ -0,0 +1,3 @@
+ALTER TABLE agent_paths DROP COLUMN new_state;
+ALTER TABLE agent_paths DROP COLUMN required_state;
+ALTER TABLE agent_paths DROP COLUMN scenario;
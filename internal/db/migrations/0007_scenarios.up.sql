@@ -0,0 +1,3 @@
+ALTER TABLE agent_paths ADD COLUMN scenario TEXT NOT NULL DEFAULT '';
+ALTER TABLE agent_paths ADD COLUMN required_state TEXT NOT NULL DEFAULT '';
+ALTER TABLE agent_paths ADD COLUMN new_state TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+ALTER TABLE agent_paths DROP COLUMN sequence_mode;
+ALTER TABLE agent_paths DROP COLUMN sequence;
@@ -0,0 +1,2 @@
+ALTER TABLE agent_paths ADD COLUMN sequence TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE agent_paths ADD COLUMN sequence_mode TEXT NOT NULL DEFAULT '';
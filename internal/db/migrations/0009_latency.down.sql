@@ -0,0 +1,2 @@
+ALTER TABLE agent_paths DROP COLUMN delay;
+ALTER TABLE agents DROP COLUMN delay;
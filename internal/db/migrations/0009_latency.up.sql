@@ -0,0 +1,2 @@
+ALTER TABLE agents ADD COLUMN delay TEXT NOT NULL DEFAULT 'null';
+ALTER TABLE agent_paths ADD COLUMN delay TEXT NOT NULL DEFAULT 'null';
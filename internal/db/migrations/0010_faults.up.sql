@@ -0,0 +1 @@
+ALTER TABLE agent_paths ADD COLUMN fault TEXT NOT NULL DEFAULT 'null';
@@ -0,0 +1,2 @@
+ALTER TABLE agent_paths DROP COLUMN throttle;
+ALTER TABLE agents DROP COLUMN throttle;
@@ -0,0 +1,3 @@
+ALTER TABLE agents DROP COLUMN proxy_headers;
+ALTER TABLE agents DROP COLUMN strip_prefix;
+ALTER TABLE agents DROP COLUMN upstream_url;
@@ -0,0 +1,3 @@
+ALTER TABLE agents ADD COLUMN upstream_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE agents ADD COLUMN strip_prefix TEXT NOT NULL DEFAULT '';
+ALTER TABLE agents ADD COLUMN proxy_headers TEXT NOT NULL DEFAULT 'null';
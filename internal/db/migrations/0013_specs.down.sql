@@ -0,0 +1,2 @@
+ALTER TABLE request_journal DROP COLUMN violations;
+DROP TABLE agent_specs;
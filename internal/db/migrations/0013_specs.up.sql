@@ -0,0 +1,7 @@
+CREATE TABLE agent_specs (
+    agent_id INTEGER PRIMARY KEY,
+    document TEXT NOT NULL,
+    mode TEXT NOT NULL DEFAULT 'enforce',
+    FOREIGN KEY (agent_id) REFERENCES agents(id) ON DELETE CASCADE
+);
+ALTER TABLE request_journal ADD COLUMN violations TEXT NOT NULL DEFAULT 'null';
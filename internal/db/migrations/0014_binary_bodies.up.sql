@@ -0,0 +1 @@
+ALTER TABLE agent_paths ADD COLUMN encoding TEXT NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+ALTER TABLE agent_paths ADD COLUMN path_group TEXT NOT NULL DEFAULT '';
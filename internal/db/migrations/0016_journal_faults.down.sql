@@ -0,0 +1 @@
+ALTER TABLE request_journal DROP COLUMN fault;
@@ -0,0 +1 @@
+ALTER TABLE request_journal ADD COLUMN fault TEXT NOT NULL DEFAULT '';
@@ -2,8 +2,8 @@ package db
 
 import (
 	"context"
-	"database/sql"
-	"fmt"
+	"net/http"
+	"strings"
 )
 
 // Agent represents a mock server configuration stored in the DB.
@@ -11,53 +11,151 @@ type Agent struct {
 	Id     int    `json:"id"`
 	Name   string `json:"name"`
 	Port   string `json:"port"`
-	Status string `json:"status"` // e.g., "stopped", "active"
+	Status string `json:"status"`          // e.g., "stopped", "active"
+	Delay  *Delay `json:"delay,omitempty"` // Default for paths without a delay of their own
+
+	// Throttle is the default for paths without a throttle of their own.
+	Throttle *Throttle `json:"throttle,omitempty"`
+
+	// UpstreamURL, when set, receives every request no mocked path answers.
+	UpstreamURL  string            `json:"upstream_url,omitempty"`
+	StripPrefix  string            `json:"strip_prefix,omitempty"`  // Removed from the request path before forwarding
+	ProxyHeaders map[string]string `json:"proxy_headers,omitempty"` // Set on forwarded requests; an empty value removes the header
+}
+
+// Delay distributions.
+const (
+	DelayFixed     = "fixed"
+	DelayUniform   = "uniform"
+	DelayNormal    = "normal"
+	DelayLogNormal = "lognormal"
+)
+
+// Delay describes how long a mock waits before answering. Only the fields of
+// the chosen distribution are used; all durations are in milliseconds.
+type Delay struct {
+	Distribution string  `json:"distribution"`        // Defaults to "fixed"
+	FixedMs      int     `json:"fixed_ms,omitempty"`  // fixed
+	MinMs        int     `json:"min_ms,omitempty"`    // uniform
+	MaxMs        int     `json:"max_ms,omitempty"`    // uniform
+	MeanMs       int     `json:"mean_ms,omitempty"`   // normal
+	StddevMs     int     `json:"stddev_ms,omitempty"` // normal
+	MedianMs     int     `json:"median_ms,omitempty"` // lognormal
+	Sigma        float64 `json:"sigma,omitempty"`     // lognormal; larger values give a longer tail
+}
+
+// MethodAny matches a path regardless of the request's HTTP method.
+const MethodAny = "ANY"
+
+// MockResponse is a response a mock path can answer with.
+type MockResponse struct {
+	Response   string            `json:"response"`
+	StatusCode int               `json:"status_code"`        // Defaults to 200 when unset
+	Headers    map[string]string `json:"headers"`            // e.g., {"Content-Type": "application/json"}
+	Templated  bool              `json:"templated"`          // Response is a Go text/template evaluated per request
+	Encoding   string            `json:"encoding,omitempty"` // EncodingBase64 for binary bodies
+	Fault      *Fault            `json:"fault,omitempty"`
+}
+
+// EncodingBase64 marks a response whose body is stored base64-encoded and
+// decoded before it is served.
+const EncodingBase64 = "base64"
+
+// Fault types.
+const (
+	FaultEmptyResponse   = "empty_response"         // Close the connection without answering
+	FaultRandomData      = "random_data_then_close" // Send garbage, then close the connection
+	FaultConnectionReset = "connection_reset"       // Reset the TCP connection
+	FaultMalformedChunk  = "malformed_chunk"        // Send a truncated chunked body, then close the connection
+)
+
+// Fault replaces a response with a network-level failure.
+type Fault struct {
+	Type        string   `json:"type"`
+	Probability *float64 `json:"probability,omitempty"` // Share of requests that fail, from 0 to 1; unset means all of them
+}
+
+// ScenarioStarted is the state every scenario is in when its agent starts or is reset.
+const ScenarioStarted = "Started"
+
+// ScenarioStep ties a response to a named scenario's state machine.
+type ScenarioStep struct {
+	Scenario      string `json:"scenario,omitempty"`
+	RequiredState string `json:"required_state,omitempty"` // Only served while the scenario is in this state
+	NewState      string `json:"new_state,omitempty"`      // State the scenario moves to once served
 }
 
 // AgentPath defines a mock path and its response.
 type AgentPath struct {
-	Id       int
-	AgentID  int
-	Path     string `json:"path"`
-	Response string `json:"response"`
+	Id      int    `json:"id"`
+	AgentID int    `json:"agent_id"`
+	Method  string `json:"method"` // e.g., "GET", "POST", or MethodAny
+	Path    string `json:"path"`
+	Group   string `json:"group,omitempty"` // Folder the path is filed under, e.g. "Users/Admin"
+	MockResponse
+	ScenarioStep // Applies to the path's own response; variants inherit the scenario name
+
+	// Variants are tried in priority order; the path's own response is the
+	// fallback when none of them match.
+	Variants []ResponseVariant `json:"variants"`
+
+	// Sequence, when set, replaces the path's own response: its entries are
+	// served in turn on successive calls, and SequenceMode decides what
+	// happens once they have all been served.
+	Sequence     []MockResponse `json:"sequence"`
+	SequenceMode string         `json:"sequence_mode"`
+
+	// Delay overrides the agent's default delay for this path.
+	Delay *Delay `json:"delay,omitempty"`
+
+	// Throttle overrides the agent's default throttle for this path.
+	Throttle *Throttle `json:"throttle,omitempty"`
+}
+
+// Throttle slows down how a response body is written: either at a steady
+// BytesPerSecond, or in ChunkSize pieces separated by ChunkDelayMs pauses.
+type Throttle struct {
+	BytesPerSecond int `json:"bytes_per_second,omitempty"`
+	ChunkSize      int `json:"chunk_size,omitempty"` // Bytes written at a time; derived from BytesPerSecond when unset
+	ChunkDelayMs   int `json:"chunk_delay_ms,omitempty"`
+}
+
+// Sequence modes.
+const (
+	SequenceCycle = "cycle" // Start over from the first response (the default)
+	SequenceStick = "stick" // Keep serving the last response
+	SequenceFail  = "fail"  // Answer with an error once the sequence is exhausted
+)
+
+// ResponseVariant is an alternative response, served when all of its conditions match.
+type ResponseVariant struct {
+	Name       string      `json:"name,omitempty"`
+	Priority   int         `json:"priority"` // Lower values are evaluated first
+	Conditions []Condition `json:"conditions"`
+	MockResponse
+	ScenarioStep
+}
+
+// NormalizeMethod upper-cases an HTTP method, defaulting to GET when empty.
+func NormalizeMethod(method string) string {
+	method = strings.ToUpper(strings.TrimSpace(method))
+	if method == "" {
+		return http.MethodGet
+	}
+	return method
 }
 
 // AgentRepository defines the interface for data access operations.
 type AgentRepository interface {
 	GetAgentByID(ctx context.Context, id int) (*Agent, error)
 	ListAgents(ctx context.Context) ([]Agent, error)
-	CreateAgent(ctx context.Context, name, port string, paths []AgentPath) (int, error)
+	CreateAgent(ctx context.Context, agent *Agent, paths []AgentPath) (int, error)
+	UpdateAgent(ctx context.Context, agent *Agent) error
+	DeleteAgent(ctx context.Context, id int) error
 	UpdateAgentStatus(ctx context.Context, id int, status string) error
 	GetAgentPaths(ctx context.Context, agentID int) ([]AgentPath, error)
-}
-
-// --- Migrations ---
-
-// RunMigrations initializes the SQLite schema.
-func RunMigrations(db *sql.DB) error {
-	const createAgentTable = `
-	CREATE TABLE IF NOT EXISTS agents (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT NOT NULL UNIQUE,
-		port TEXT NOT NULL UNIQUE,
-		status TEXT NOT NULL DEFAULT 'stopped'
-	);`
-
-	const createAgentPathTable = `
-	CREATE TABLE IF NOT EXISTS agent_paths (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		agent_id INTEGER NOT NULL,
-		path TEXT NOT NULL,
-		response TEXT NOT NULL,
-		UNIQUE (agent_id, path),
-		FOREIGN KEY (agent_id) REFERENCES agents(id) ON DELETE CASCADE
-	);`
-
-	if _, err := db.Exec(createAgentTable); err != nil {
-		return fmt.Errorf("failed to create agents table: %w", err)
-	}
-	if _, err := db.Exec(createAgentPathTable); err != nil {
-		return fmt.Errorf("failed to create agent_paths table: %w", err)
-	}
-	return nil
+	GetAgentPath(ctx context.Context, agentID, pathID int) (*AgentPath, error)
+	AddPath(ctx context.Context, agentID int, path AgentPath) (int, error)
+	UpdatePath(ctx context.Context, path AgentPath) error
+	DeletePath(ctx context.Context, agentID, pathID int) error
 }
@@ -0,0 +1,59 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// Spec validation modes.
+const (
+	SpecEnforce = "enforce" // Reject requests that violate the spec with a 400
+	SpecLogOnly = "log"     // Serve them anyway, recording the violations in the journal
+)
+
+// AgentSpec is an OpenAPI document attached to an agent to validate the requests it receives.
+type AgentSpec struct {
+	AgentID  int    `json:"agent_id"`
+	Document string `json:"document"` // JSON or YAML, as uploaded
+	Mode     string `json:"mode"`
+}
+
+// SpecRepository stores the OpenAPI documents attached to agents.
+type SpecRepository interface {
+	GetAgentSpec(ctx context.Context, agentID int) (*AgentSpec, error) // sql.ErrNoRows if none is attached
+	SetAgentSpec(ctx context.Context, spec *AgentSpec) error
+	DeleteAgentSpec(ctx context.Context, agentID int) error
+}
+
+// GetAgentSpec fetches the spec attached to an agent.
+func (r *SQLiteRepository) GetAgentSpec(ctx context.Context, agentID int) (*AgentSpec, error) {
+	spec := AgentSpec{AgentID: agentID}
+	row := r.db.QueryRowContext(ctx, "SELECT document, mode FROM agent_specs WHERE agent_id = ?", agentID)
+	if err := row.Scan(&spec.Document, &spec.Mode); err != nil {
+		return nil, err // sql.ErrNoRows if not found
+	}
+	return &spec, nil
+}
+
+// SetAgentSpec attaches a spec to an agent, replacing any previous one.
+func (r *SQLiteRepository) SetAgentSpec(ctx context.Context, spec *AgentSpec) error {
+	if _, err := r.GetAgentByID(ctx, spec.AgentID); err != nil {
+		return err
+	}
+	_, err := r.db.ExecContext(ctx,
+		"INSERT INTO agent_specs(agent_id, document, mode) VALUES (?, ?, ?) ON CONFLICT(agent_id) DO UPDATE SET document = excluded.document, mode = excluded.mode",
+		spec.AgentID, spec.Document, spec.Mode)
+	if err != nil {
+		return fmt.Errorf("failed to store agent spec: %w", err)
+	}
+	return nil
+}
+
+// DeleteAgentSpec detaches an agent's spec.
+func (r *SQLiteRepository) DeleteAgentSpec(ctx context.Context, agentID int) error {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM agent_specs WHERE agent_id = ?", agentID)
+	if err != nil {
+		return fmt.Errorf("failed to delete agent spec: %w", err)
+	}
+	return expectRow(res)
+}
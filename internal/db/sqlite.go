@@ -3,7 +3,13 @@ package db
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
 )
 
 // SQLiteRepository implements the AgentRepository interface using SQLite.
@@ -16,44 +22,55 @@ func NewSQLiteRepository(db *sql.DB) *SQLiteRepository {
 	return &SQLiteRepository{db: db}
 }
 
-// GetAgentByID fetches a single agent by ID.
-func (r *SQLiteRepository) GetAgentByID(ctx context.Context, id int) (*Agent, error) {
+// agentColumns lists the agents table columns in the order scanAgent reads them.
+const agentColumns = "id, name, port, status, delay, throttle, upstream_url, strip_prefix, proxy_headers"
+
+// scanAgent reads a single agents row selected with agentColumns.
+func scanAgent(row interface{ Scan(...any) error }) (*Agent, error) {
 	var agent Agent
-	row := r.db.QueryRowContext(ctx, "SELECT id, name, port, status FROM agents WHERE id = ?", id)
-	if err := row.Scan(&agent.Id, &agent.Name, &agent.Port, &agent.Status); err != nil {
-		return nil, err // sql.ErrNoRows if not found
+	if err := row.Scan(&agent.Id, &agent.Name, &agent.Port, &agent.Status, jsonValue{&agent.Delay}, jsonValue{&agent.Throttle},
+		&agent.UpstreamURL, &agent.StripPrefix, jsonValue{&agent.ProxyHeaders}); err != nil {
+		return nil, err
 	}
 	return &agent, nil
 }
 
+// GetAgentByID fetches a single agent by ID.
+func (r *SQLiteRepository) GetAgentByID(ctx context.Context, id int) (*Agent, error) {
+	row := r.db.QueryRowContext(ctx, "SELECT "+agentColumns+" FROM agents WHERE id = ?", id)
+	return scanAgent(row) // sql.ErrNoRows if not found
+}
+
 // ListAgents fetches all agents.
 func (r *SQLiteRepository) ListAgents(ctx context.Context) ([]Agent, error) {
 	var agents []Agent
-	rows, err := r.db.QueryContext(ctx, "SELECT id, name, port, status FROM agents")
+	rows, err := r.db.QueryContext(ctx, "SELECT "+agentColumns+" FROM agents")
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var agent Agent
-		if err := rows.Scan(&agent.Id, &agent.Name, &agent.Port, &agent.Status); err != nil {
+		agent, err := scanAgent(rows)
+		if err != nil {
 			return nil, err
 		}
-		agents = append(agents, agent)
+		agents = append(agents, *agent)
 	}
 	return agents, nil
 }
 
 // CreateAgent handles both the agent and its associated paths in a transaction.
-func (r *SQLiteRepository) CreateAgent(ctx context.Context, name, port string, paths []AgentPath) (int, error) {
+func (r *SQLiteRepository) CreateAgent(ctx context.Context, agent *Agent, paths []AgentPath) (int, error) {
 	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		return 0, err
 	}
 
 	// 1. Insert Agent
-	res, err := tx.Exec("INSERT INTO agents(name, port, status) VALUES (?, ?, ?)", name, port, "stopped")
+	res, err := tx.Exec("INSERT INTO agents(name, port, status, delay, throttle, upstream_url, strip_prefix, proxy_headers) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		agent.Name, agent.Port, "stopped", jsonValue{agent.Delay}, jsonValue{agent.Throttle},
+		agent.UpstreamURL, agent.StripPrefix, jsonValue{agent.ProxyHeaders})
 	if err != nil {
 		tx.Rollback()
 		return 0, fmt.Errorf("failed to insert agent: %w", err)
@@ -62,10 +79,9 @@ func (r *SQLiteRepository) CreateAgent(ctx context.Context, name, port string, p
 
 	// 2. Insert Agent Paths
 	for _, p := range paths {
-		_, err := tx.Exec("INSERT INTO agent_paths(agent_id, path, response) VALUES (?, ?, ?)", agentID, p.Path, p.Response)
-		if err != nil {
+		if _, err := insertPath(ctx, tx, int(agentID), p); err != nil {
 			tx.Rollback()
-			return 0, fmt.Errorf("failed to insert agent path: %w", err)
+			return 0, err
 		}
 	}
 
@@ -76,6 +92,55 @@ func (r *SQLiteRepository) CreateAgent(ctx context.Context, name, port string, p
 	return int(agentID), nil
 }
 
+// UpdateAgent updates the settings of an existing agent; its status is left alone.
+func (r *SQLiteRepository) UpdateAgent(ctx context.Context, agent *Agent) error {
+	res, err := r.db.ExecContext(ctx, `UPDATE agents SET name = ?, port = ?, delay = ?, throttle = ?,
+		upstream_url = ?, strip_prefix = ?, proxy_headers = ? WHERE id = ?`,
+		agent.Name, agent.Port, jsonValue{agent.Delay}, jsonValue{agent.Throttle},
+		agent.UpstreamURL, agent.StripPrefix, jsonValue{agent.ProxyHeaders}, agent.Id)
+	if err != nil {
+		return fmt.Errorf("failed to update agent: %w", err)
+	}
+	return expectRow(res)
+}
+
+// DeleteAgent removes an agent together with all of its paths.
+func (r *SQLiteRepository) DeleteAgent(ctx context.Context, id int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	// Foreign keys are not enforced by default in SQLite, so dependent rows are
+	// removed explicitly rather than relying on ON DELETE CASCADE.
+	if _, err := tx.ExecContext(ctx, "DELETE FROM agent_paths WHERE agent_id = ?", id); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete agent paths: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM request_journal WHERE agent_id = ?", id); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete agent journal: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM agent_specs WHERE agent_id = ?", id); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete agent spec: %w", err)
+	}
+	res, err := tx.ExecContext(ctx, "DELETE FROM agents WHERE id = ?", id)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete agent: %w", err)
+	}
+	if err := expectRow(res); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("transaction commit failed: %w", err)
+	}
+	return nil
+}
+
 // UpdateAgentStatus updates the status of a specific agent.
 func (r *SQLiteRepository) UpdateAgentStatus(ctx context.Context, id int, status string) error {
 	stmt, err := r.db.Prepare("UPDATE agents SET status = ? WHERE id = ?")
@@ -93,18 +158,146 @@ func (r *SQLiteRepository) UpdateAgentStatus(ctx context.Context, id int, status
 // GetAgentPaths fetches all paths associated with a given agent ID.
 func (r *SQLiteRepository) GetAgentPaths(ctx context.Context, agentID int) ([]AgentPath, error) {
 	var paths []AgentPath
-	rows, err := r.db.QueryContext(ctx, "SELECT id, path, response FROM agent_paths WHERE agent_id = ?", agentID)
+	rows, err := r.db.QueryContext(ctx, "SELECT "+pathColumns+" FROM agent_paths WHERE agent_id = ?", agentID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var p AgentPath
-		if err := rows.Scan(&p.Id, &p.Path, &p.Response); err != nil {
+		p, err := scanPath(rows)
+		if err != nil {
 			return nil, err
 		}
-		paths = append(paths, p)
+		paths = append(paths, *p)
 	}
 	return paths, nil
 }
+
+// GetAgentPath fetches a single path belonging to the given agent.
+func (r *SQLiteRepository) GetAgentPath(ctx context.Context, agentID, pathID int) (*AgentPath, error) {
+	row := r.db.QueryRowContext(ctx, "SELECT "+pathColumns+" FROM agent_paths WHERE agent_id = ? AND id = ?", agentID, pathID)
+	return scanPath(row) // sql.ErrNoRows if not found
+}
+
+// AddPath inserts a new path for an existing agent and returns its ID.
+func (r *SQLiteRepository) AddPath(ctx context.Context, agentID int, path AgentPath) (int, error) {
+	if _, err := r.GetAgentByID(ctx, agentID); err != nil {
+		return 0, err
+	}
+	return insertPath(ctx, r.db, agentID, path)
+}
+
+// UpdatePath replaces the definition of an existing path, identified by its Id and AgentID.
+func (r *SQLiteRepository) UpdatePath(ctx context.Context, path AgentPath) error {
+	args := append(pathValues(path), path.Id, path.AgentID)
+	res, err := r.db.ExecContext(ctx,
+		"UPDATE agent_paths SET "+strings.Join(pathFields, " = ?, ")+" = ? WHERE id = ? AND agent_id = ?", args...)
+	if err != nil {
+		return fmt.Errorf("failed to update agent path: %w", err)
+	}
+	return expectRow(res)
+}
+
+// DeletePath removes a single path from an agent.
+func (r *SQLiteRepository) DeletePath(ctx context.Context, agentID, pathID int) error {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM agent_paths WHERE agent_id = ? AND id = ?", agentID, pathID)
+	if err != nil {
+		return fmt.Errorf("failed to delete agent path: %w", err)
+	}
+	return expectRow(res)
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// insertPath writes a single agent_paths row and returns its ID.
+func insertPath(ctx context.Context, db execer, agentID int, p AgentPath) (int, error) {
+	args := append([]any{agentID}, pathValues(p)...)
+	res, err := db.ExecContext(ctx,
+		"INSERT INTO agent_paths(agent_id, "+strings.Join(pathFields, ", ")+") VALUES (?"+strings.Repeat(", ?", len(pathFields))+")", args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert agent path: %w", err)
+	}
+	id, _ := res.LastInsertId()
+	return int(id), nil
+}
+
+// expectRow reports sql.ErrNoRows when a statement matched nothing.
+func expectRow(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// IsConflict reports whether err is a UNIQUE constraint violation, such as a
+// second agent on the same port or a second path with the same method.
+func IsConflict(err error) bool {
+	var e sqlite3.Error
+	return errors.As(err, &e) && (e.ExtendedCode == sqlite3.ErrConstraintUnique || e.ExtendedCode == sqlite3.ErrConstraintPrimaryKey)
+}
+
+// pathFields lists the agent_paths columns stored from an AgentPath, in the
+// order pathValues returns them and scanPath reads them.
+var pathFields = []string{"method", "path", "path_group", "response", "status_code", "headers", "templated", "encoding", "variants",
+	"scenario", "required_state", "new_state", "sequence", "sequence_mode", "delay", "fault", "throttle"}
+
+// pathColumns selects a complete agent_paths row for scanPath.
+var pathColumns = "id, agent_id, " + strings.Join(pathFields, ", ")
+
+// pathValues returns the column values for a path, in pathFields order.
+func pathValues(p AgentPath) []any {
+	return []any{NormalizeMethod(p.Method), p.Path, p.Group, p.Response, statusOrDefault(p.StatusCode), jsonValue{p.Headers}, p.Templated, p.Encoding, jsonValue{p.Variants},
+		p.Scenario, p.RequiredState, p.NewState, jsonValue{p.Sequence}, p.SequenceMode, jsonValue{p.Delay}, jsonValue{p.Fault}, jsonValue{p.Throttle}}
+}
+
+// scanPath reads a single agent_paths row selected with pathColumns.
+func scanPath(row interface{ Scan(...any) error }) (*AgentPath, error) {
+	var p AgentPath
+	if err := row.Scan(&p.Id, &p.AgentID, &p.Method, &p.Path, &p.Group, &p.Response, &p.StatusCode, jsonValue{&p.Headers}, &p.Templated, &p.Encoding, jsonValue{&p.Variants},
+		&p.Scenario, &p.RequiredState, &p.NewState, jsonValue{&p.Sequence}, &p.SequenceMode, jsonValue{&p.Delay}, jsonValue{&p.Fault}, jsonValue{&p.Throttle}); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// jsonValue stores a Go value in a TEXT column as JSON, and decodes it back
+// when scanned into a pointer.
+type jsonValue struct {
+	v any
+}
+
+func (j jsonValue) Value() (driver.Value, error) {
+	b, err := json.Marshal(j.v)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (j jsonValue) Scan(src any) error {
+	switch src := src.(type) {
+	case string:
+		return json.Unmarshal([]byte(src), j.v)
+	case []byte:
+		return json.Unmarshal(src, j.v)
+	case nil:
+		return nil
+	}
+	return fmt.Errorf("cannot decode %T as JSON", src)
+}
+
+// statusOrDefault substitutes 200 OK for an unset status code.
+func statusOrDefault(code int) int {
+	if code == 0 {
+		return 200
+	}
+	return code
+}
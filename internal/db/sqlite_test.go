@@ -0,0 +1,37 @@
+package db
+
+import (
+	"context"
+	"testing"
+)
+
+func TestIsConflict(t *testing.T) {
+	ctx := context.Background()
+	conn := openTestDB(t)
+	if err := RunMigrations(conn); err != nil {
+		t.Fatal(err)
+	}
+	repo := NewSQLiteRepository(conn)
+
+	id, err := repo.CreateAgent(ctx, &Agent{Name: "users", Port: "18000"}, []AgentPath{{Method: "GET", Path: "/users"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := repo.CreateAgent(ctx, &Agent{Name: "orders", Port: "18001"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, sameName := repo.CreateAgent(ctx, &Agent{Name: "users", Port: "18002"}, nil)
+	_, samePath := repo.AddPath(ctx, id, AgentPath{Method: "GET", Path: "/users"})
+	samePort := repo.UpdateAgent(ctx, &Agent{Id: other, Name: "orders", Port: "18000"})
+	for name, err := range map[string]error{"name": sameName, "path": samePath, "port": samePort} {
+		if !IsConflict(err) {
+			t.Errorf("duplicate %s: got %v, want a conflict", name, err)
+		}
+	}
+
+	if IsConflict(repo.UpdateAgent(ctx, &Agent{Id: 99, Name: "missing", Port: "18003"})) {
+		t.Error("a missing agent is not a conflict")
+	}
+}
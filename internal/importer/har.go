@@ -0,0 +1,280 @@
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/url"
+	"sort"
+	"strings"
+
+	"mi6/internal/db"
+)
+
+// How HAR entries repeating a request are resolved.
+const (
+	DuplicatesFirst = "first" // Keep the first response (the default)
+	DuplicatesLast  = "last"  // Keep the last response
+	DuplicatesAll   = "all"   // Serve all of them in turn, as a response sequence
+)
+
+// HAROptions selects which entries of a HAR file are imported, and how.
+type HAROptions struct {
+	Hosts      []string // Only import requests to these hosts; all hosts when empty
+	MimeTypes  []string // Only import responses of these types, e.g. "application/json" or "image/*"
+	Duplicates string
+}
+
+// Validate checks the duplicate policy.
+func (o HAROptions) Validate() error {
+	switch o.Duplicates {
+	case "", DuplicatesFirst, DuplicatesLast, DuplicatesAll:
+		return nil
+	}
+	return fmt.Errorf("unknown duplicates policy %q", o.Duplicates)
+}
+
+// har is the part of the HAR 1.2 format the importer reads.
+type har struct {
+	Log struct {
+		Entries []harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+type harEntry struct {
+	Request struct {
+		Method      string     `json:"method"`
+		URL         string     `json:"url"`
+		QueryString []harField `json:"queryString"`
+	} `json:"request"`
+	Response struct {
+		Status  int        `json:"status"`
+		Headers []harField `json:"headers"`
+		Content struct {
+			MimeType string `json:"mimeType"`
+			Text     string `json:"text"`
+			Encoding string `json:"encoding"`
+		} `json:"content"`
+	} `json:"response"`
+}
+
+type harField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HARPaths turns the entries of a HAR 1.2 file into mock paths, one per method
+// and URL path. Requests that differ only by query string become variants
+// matching their query parameters. With DuplicatesAll, a request answered
+// more than once serves its responses in turn: as the path's sequence, or for
+// a query variant, through a scenario stepping from one response to the next.
+func HARPaths(data []byte, opts HAROptions) ([]db.AgentPath, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	var file har
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid HAR file: %w", err)
+	}
+
+	type request struct {
+		query     url.Values
+		responses []db.MockResponse
+	}
+	type route struct {
+		method, path string
+		requests     []*request // In the order first seen
+		byQuery      map[string]*request
+	}
+	var routes []*route
+	byKey := map[string]*route{}
+
+	for _, e := range file.Log.Entries {
+		u, err := url.Parse(e.Request.URL)
+		if err != nil || e.Response.Status == 0 || !opts.wants(u, e.Response.Content.MimeType) {
+			continue // Unparseable, blocked or failed requests have nothing to replay
+		}
+		method := strings.ToUpper(e.Request.Method)
+		path := routePath(u)
+		if path == "" {
+			path = "/"
+		}
+
+		key := method + " " + path
+		rt, ok := byKey[key]
+		if !ok {
+			rt = &route{method: method, path: path, byQuery: map[string]*request{}}
+			byKey[key] = rt
+			routes = append(routes, rt)
+		}
+		query := queryOf(e, u)
+		req, ok := rt.byQuery[query.Encode()]
+		if !ok {
+			req = &request{query: query}
+			rt.byQuery[query.Encode()] = req
+			rt.requests = append(rt.requests, req)
+		}
+		req.responses = append(req.responses, harResponse(e))
+	}
+
+	paths := make([]db.AgentPath, 0, len(routes))
+	for _, rt := range routes {
+		p := db.AgentPath{Method: rt.method, Path: rt.path}
+
+		// The request without a query string answers by default, or else the first one seen.
+		fallback := rt.requests[0]
+		if plain, ok := rt.byQuery[""]; ok {
+			fallback = plain
+		}
+		p.MockResponse = pick(fallback.responses, opts.Duplicates)
+		if opts.Duplicates == DuplicatesAll && len(fallback.responses) > 1 {
+			p.Sequence, p.SequenceMode = fallback.responses, db.SequenceStick
+		}
+
+		for _, req := range rt.requests {
+			if req == fallback || len(req.query) == 0 {
+				continue
+			}
+			name := "?" + req.query.Encode()
+			if opts.Duplicates != DuplicatesAll || len(req.responses) == 1 {
+				p.Variants = append(p.Variants, db.ResponseVariant{
+					Name:         name,
+					Conditions:   queryConditions(req.query),
+					MockResponse: pick(req.responses, opts.Duplicates),
+				})
+				continue
+			}
+			p.Variants = append(p.Variants, variantSequence(rt.method+" "+rt.path+name, name, queryConditions(req.query), req.responses)...)
+		}
+		paths = append(paths, p)
+	}
+	return paths, nil
+}
+
+// wants reports whether the options select an entry.
+func (o HAROptions) wants(u *url.URL, mimeType string) bool {
+	if len(o.Hosts) > 0 && !containsFold(o.Hosts, u.Host) && !containsFold(o.Hosts, u.Hostname()) {
+		return false
+	}
+	if len(o.MimeTypes) == 0 {
+		return true
+	}
+	mediaType, _, _ := mime.ParseMediaType(mimeType)
+	major, _, _ := strings.Cut(mediaType, "/")
+	return containsFold(o.MimeTypes, mediaType) || containsFold(o.MimeTypes, major+"/*")
+}
+
+func containsFold(list []string, s string) bool {
+	for _, e := range list {
+		if strings.EqualFold(e, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// queryOf reads the request's query parameters, preferring the HAR's parsed
+// list over the URL.
+func queryOf(e harEntry, u *url.URL) url.Values {
+	if len(e.Request.QueryString) == 0 {
+		return u.Query()
+	}
+	query := url.Values{}
+	for _, f := range e.Request.QueryString {
+		query.Add(f.Name, f.Value)
+	}
+	return query
+}
+
+// queryConditions matches each of the query's parameters by its first value.
+func queryConditions(query url.Values) []db.Condition {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	conditions := make([]db.Condition, 0, len(names))
+	for _, name := range names {
+		value := query.Get(name)
+		conditions = append(conditions, db.Condition{
+			Source: db.SourceQuery, Key: name, Predicate: db.Predicate{Equals: &value},
+		})
+	}
+	return conditions
+}
+
+func harResponse(e harEntry) db.MockResponse {
+	m := db.MockResponse{StatusCode: e.Response.Status, Headers: map[string]string{}}
+	hasContentType := false
+	for _, h := range e.Response.Headers {
+		if strings.HasPrefix(h.Name, ":") || skippedResponseHeaders[strings.ToLower(h.Name)] {
+			continue // HTTP/2 pseudo-headers included
+		}
+		m.Headers[h.Name] = h.Value
+		hasContentType = hasContentType || strings.EqualFold(h.Name, "Content-Type")
+	}
+	if !hasContentType && e.Response.Content.MimeType != "" {
+		m.Headers["Content-Type"] = e.Response.Content.MimeType
+	}
+
+	m.Response = e.Response.Content.Text
+	if e.Response.Content.Encoding == db.EncodingBase64 {
+		m.Encoding = db.EncodingBase64
+	}
+	return m
+}
+
+// pick resolves repeated responses to the same request. With DuplicatesAll,
+// the first one stands in wherever a single response is needed.
+func pick(responses []db.MockResponse, policy string) db.MockResponse {
+	if policy == DuplicatesLast {
+		return responses[len(responses)-1]
+	}
+	return responses[0]
+}
+
+// variantSequence serves responses in turn to requests matching conditions,
+// sticking to the last one, like a sequence in SequenceStick mode. Each
+// response is a variant gated by the state of the named scenario, which moves
+// on to the next response once it has been served.
+func variantSequence(scenario, name string, conditions []db.Condition, responses []db.MockResponse) []db.ResponseVariant {
+	state := func(i int) string {
+		if i == 0 {
+			return db.ScenarioStarted
+		}
+		return fmt.Sprintf("response %d", i+1)
+	}
+	variants := make([]db.ResponseVariant, len(responses))
+	for i, m := range responses {
+		variants[i] = db.ResponseVariant{
+			Name:         fmt.Sprintf("%s #%d", name, i+1),
+			Conditions:   conditions,
+			MockResponse: m,
+			ScenarioStep: db.ScenarioStep{Scenario: scenario, RequiredState: state(i)},
+		}
+		if i < len(responses)-1 {
+			variants[i].NewState = state(i + 1)
+		}
+	}
+	return variants
+}
+
+// HAR creates an agent from the entries of a HAR file.
+func HAR(ctx context.Context, repo db.AgentRepository, a *db.Agent, data []byte, opts HAROptions) (*Result, error) {
+	paths, err := HARPaths(data, opts)
+	if err != nil {
+		return nil, err
+	}
+	return CreateAgent(ctx, repo, a, paths)
+}
+
+// HARInto adds the entries of a HAR file to an existing agent.
+func HARInto(ctx context.Context, repo db.AgentRepository, agentID int, data []byte, opts HAROptions) (*Result, error) {
+	paths, err := HARPaths(data, opts)
+	if err != nil {
+		return nil, err
+	}
+	return AddPaths(ctx, repo, agentID, paths)
+}
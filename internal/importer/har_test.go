@@ -0,0 +1,254 @@
+package importer
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"mi6/internal/agent"
+	"mi6/internal/db"
+)
+
+// harEntryJSON builds a HAR entry answering url with status and body.
+func harEntryJSON(method, url string, status int, mimeType, body string) string {
+	return fmt.Sprintf(`{"request": {"method": %q, "url": %q},
+	"response": {"status": %d, "headers": [{"name": "Content-Length", "value": "1"}, {"name": "X-Trace", "value": "t"}],
+	"content": {"mimeType": %q, "text": %q}}}`, method, url, status, mimeType, body)
+}
+
+func harJSON(entries ...string) []byte {
+	return []byte(`{"log": {"entries": [` + strings.Join(entries, ",") + `]}}`)
+}
+
+// newTestRepository returns a repository backed by a fresh SQLite database.
+func newTestRepository(t *testing.T) db.AgentRepository {
+	t.Helper()
+	conn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "agents.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if err := db.RunMigrations(conn); err != nil {
+		t.Fatal(err)
+	}
+	return db.NewSQLiteRepository(conn)
+}
+
+// freePort returns a port nothing listens on.
+func freePort(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return fmt.Sprint(ln.Addr().(*net.TCPAddr).Port)
+}
+
+// serve starts an imported agent, stopping it when the test ends.
+func serve(t *testing.T, repo db.AgentRepository, result *Result) {
+	t.Helper()
+	registry := agent.NewRegistry(repo)
+	t.Cleanup(registry.ShutdownAll)
+	if err := registry.StartAgentServer(context.Background(), result.AgentID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// get requests a raw, already escaped, path from the agent on port, retrying
+// until it answers, and returns the status and body.
+func get(t *testing.T, port, rawPath string) (int, string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		resp, err := http.Get("http://localhost:" + port + rawPath)
+		if err == nil {
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			return resp.StatusCode, string(body)
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("nothing answers on port %s: %v", port, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHARPaths(t *testing.T) {
+	file := harJSON(
+		harEntryJSON("get", "https://api.example.com/users?page=2", 200, "application/json", `["b"]`),
+		harEntryJSON("GET", "https://api.example.com/users", 200, "application/json", `["a"]`),
+		harEntryJSON("GET", "https://cdn.example.com/logo.svg", 200, "image/svg+xml", "<svg/>"),
+		harEntryJSON("GET", "https://api.example.com/blocked", 0, "", ""),
+		harEntryJSON("GET", "https://api.example.com/users", 500, "application/json", `"down"`),
+	)
+
+	tests := []struct {
+		name string
+		opts HAROptions
+		want []string // "METHOD path status body [variants]"
+	}{
+		{
+			name: "defaults",
+			want: []string{`GET /users 200 ["a"] [?page=2]`, `GET /logo.svg 200 <svg/> []`},
+		},
+		{
+			name: "last duplicate",
+			opts: HAROptions{Duplicates: DuplicatesLast},
+			want: []string{`GET /users 500 "down" [?page=2]`, `GET /logo.svg 200 <svg/> []`},
+		},
+		{
+			name: "host filter",
+			opts: HAROptions{Hosts: []string{"CDN.example.com"}},
+			want: []string{`GET /logo.svg 200 <svg/> []`},
+		},
+		{
+			name: "mime filter",
+			opts: HAROptions{MimeTypes: []string{"application/json"}},
+			want: []string{`GET /users 200 ["a"] [?page=2]`},
+		},
+		{
+			name: "mime wildcard",
+			opts: HAROptions{MimeTypes: []string{"image/*"}},
+			want: []string{`GET /logo.svg 200 <svg/> []`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paths, err := HARPaths(file, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, p := range paths {
+				var variants []string
+				for _, v := range p.Variants {
+					variants = append(variants, v.Name)
+				}
+				got = append(got, fmt.Sprintf("%s %s %d %s %v", p.Method, p.Path, p.StatusCode, p.Response, variants))
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestHARPathsHeaders(t *testing.T) {
+	paths, err := HARPaths(harJSON(harEntryJSON("GET", "https://api.example.com/users", 200, "application/json", "[]")), HAROptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := paths[0].Headers
+	if _, ok := headers["Content-Length"]; ok || headers["X-Trace"] != "t" || headers["Content-Type"] != "application/json" {
+		t.Errorf("got headers %v, want X-Trace kept, Content-Length dropped and Content-Type from the MIME type", headers)
+	}
+}
+
+func TestHARPathsAllDuplicates(t *testing.T) {
+	file := harJSON(
+		harEntryJSON("GET", "https://api.example.com/jobs", 202, "text/plain", "pending"),
+		harEntryJSON("GET", "https://api.example.com/jobs?id=1", 202, "text/plain", "queued"),
+		harEntryJSON("GET", "https://api.example.com/jobs", 200, "text/plain", "done"),
+		harEntryJSON("GET", "https://api.example.com/jobs?id=1", 200, "text/plain", "running"),
+		harEntryJSON("GET", "https://api.example.com/jobs?id=1", 200, "text/plain", "finished"),
+	)
+	paths, err := HARPaths(file, HAROptions{Duplicates: DuplicatesAll})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := paths[0]
+	if len(p.Sequence) != 2 || p.Sequence[1].Response != "done" || p.SequenceMode != db.SequenceStick {
+		t.Errorf("got sequence %+v in mode %q, want both plain responses sticking", p.Sequence, p.SequenceMode)
+	}
+
+	want := []struct{ response, required, next string }{
+		{"queued", db.ScenarioStarted, "response 2"},
+		{"running", "response 2", "response 3"},
+		{"finished", "response 3", ""},
+	}
+	if len(p.Variants) != len(want) {
+		t.Fatalf("got %d variants, want %d", len(p.Variants), len(want))
+	}
+	for i, w := range want {
+		v := p.Variants[i]
+		if v.Response != w.response || v.Scenario != "GET /jobs?id=1" || v.RequiredState != w.required || v.NewState != w.next {
+			t.Errorf("variant %d: got %q in scenario %q, %q -> %q; want %q, %q -> %q",
+				i, v.Response, v.Scenario, v.RequiredState, v.NewState, w.response, w.required, w.next)
+		}
+		if len(v.Conditions) != 1 || v.Conditions[0].Key != "id" {
+			t.Errorf("variant %d: got conditions %+v, want id to be matched", i, v.Conditions)
+		}
+	}
+}
+
+func TestHARSkipsInvalidPaths(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepository(t)
+	file := harJSON(
+		harEntryJSON("GET", "https://api.example.com/a/*/b", 200, "text/plain", "star"),
+		harEntryJSON("GET", "https://api.example.com/users", 200, "application/json", "[]"),
+	)
+
+	result, err := HAR(ctx, repo, &db.Agent{Name: "frontend", Port: "18084"}, file, HAROptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Paths) != 1 || result.Paths[0].Path != "/users" {
+		t.Errorf("imported %+v, want only /users", result.Paths)
+	}
+	if len(result.Skipped) != 1 || !strings.HasPrefix(result.Skipped[0], "GET /a/*/b (") {
+		t.Errorf("got skipped %q, want the wildcard path", result.Skipped)
+	}
+
+	into, err := HARInto(ctx, repo, result.AgentID, file, HAROptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(into.Paths) != 0 || len(into.Skipped) != 2 {
+		t.Errorf("re-import added %+v and skipped %q, want both skipped", into.Paths, into.Skipped)
+	}
+}
+
+func TestHARServesEscapedPaths(t *testing.T) {
+	repo := newTestRepository(t)
+	port := freePort(t)
+	file := harJSON(
+		harEntryJSON("GET", "https://api.example.com/files/a%20b", 200, "text/plain", "space"),
+		harEntryJSON("GET", "https://api.example.com/caf%C3%A9", 200, "text/plain", "accent"),
+		harEntryJSON("GET", "https://api.example.com/docs/a%2Fb", 200, "text/plain", "slash"),
+	)
+
+	result, err := HAR(context.Background(), repo, &db.Agent{Name: "escaped", Port: port}, file, HAROptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Paths) != 3 || len(result.Skipped) != 0 {
+		t.Fatalf("imported %+v and skipped %q, want all three paths", result.Paths, result.Skipped)
+	}
+	serve(t, repo, result)
+
+	for rawPath, want := range map[string]string{"/files/a%20b": "space", "/caf%C3%A9": "accent", "/docs/a%2Fb": "slash"} {
+		if status, body := get(t, port, rawPath); status != http.StatusOK || body != want {
+			t.Errorf("GET %s: got %d %q, want 200 %q", rawPath, status, body, want)
+		}
+	}
+}
+
+func TestHAROptionsValidate(t *testing.T) {
+	if _, err := HARPaths(harJSON(), HAROptions{Duplicates: "some"}); err == nil {
+		t.Error("expected an unknown duplicates policy to be rejected")
+	}
+	if _, err := HARPaths([]byte("not json"), HAROptions{}); err == nil {
+		t.Error("expected a parse error")
+	}
+}
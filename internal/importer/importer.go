@@ -0,0 +1,132 @@
+// Package importer creates agents from specifications and recorded traffic.
+package importer
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"mi6/internal/agent"
+	"mi6/internal/db"
+)
+
+// Result describes an agent created by an import.
+type Result struct {
+	AgentID int            `json:"id"`
+	Name    string         `json:"name"`
+	Port    string         `json:"port"`
+	Paths   []db.AgentPath `json:"paths"`
+	Skipped []string       `json:"skipped,omitempty"` // Requests not imported, as "METHOD /path (reason)"
+	// Unsupported lists what the source described but MI6 cannot reproduce,
+	// for imports from other mocking tools.
+	Unsupported []string `json:"unsupported,omitempty"`
+}
+
+// StoreError is returned when the repository fails to store an import, as
+// opposed to the input being invalid.
+type StoreError struct {
+	Err error
+}
+
+func (e *StoreError) Error() string { return e.Err.Error() }
+
+func (e *StoreError) Unwrap() error { return e.Err }
+
+// CreateAgent validates an imported agent and its paths, then stores them.
+// Paths repeating the method and pattern of an earlier one are skipped,
+// since an agent can only answer each of them one way, and so are invalid
+// paths, such as URLs no route pattern can express. Both are listed in the
+// result's Skipped.
+func CreateAgent(ctx context.Context, repo db.AgentRepository, a *db.Agent, paths []db.AgentPath) (*Result, error) {
+	if a.Name == "" || a.Port == "" {
+		return nil, fmt.Errorf("agent name and port are required")
+	}
+	if err := agent.ValidateAgent(a); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(paths))
+	kept := make([]db.AgentPath, 0, len(paths))
+	var skipped []string
+	for _, p := range paths {
+		if err := agent.ValidatePath(&p); err != nil {
+			skipped = append(skipped, invalidPath(p, err))
+			continue
+		}
+		key := p.Method + " " + p.Path
+		if seen[key] {
+			skipped = append(skipped, key+" (declared more than once; the first is kept)")
+			continue
+		}
+		seen[key] = true
+		kept = append(kept, p)
+	}
+
+	id, err := repo.CreateAgent(ctx, a, kept)
+	if err != nil {
+		return nil, &StoreError{fmt.Errorf("failed to create agent: %w", err)}
+	}
+	return &Result{AgentID: id, Name: a.Name, Port: a.Port, Paths: kept, Skipped: skipped}, nil
+}
+
+// routePath returns the path of u the way agents route on it: decoded,
+// unless it was escaped in a way that decoding would lose, as with %2F.
+func routePath(u *url.URL) string {
+	if u.RawPath != "" {
+		return u.RawPath
+	}
+	return u.Path
+}
+
+// skippedResponseHeaders describe how a recorded response was delivered,
+// which a mock does not reproduce: recorded bodies are already decoded, for
+// instance, and the server sets its own length and date.
+var skippedResponseHeaders = map[string]bool{
+	"connection": true, "content-encoding": true, "content-length": true,
+	"date": true, "keep-alive": true, "transfer-encoding": true,
+}
+
+// invalidPath describes a path skipped because it failed validation.
+func invalidPath(p db.AgentPath, err error) string {
+	return fmt.Sprintf("%s %s (%v)", db.NormalizeMethod(p.Method), p.Path, err)
+}
+
+// AddPaths adds imported paths to an existing agent. Paths the agent already
+// mocks, by method and pattern, are skipped rather than overwritten, and so
+// are invalid ones.
+func AddPaths(ctx context.Context, repo db.AgentRepository, agentID int, paths []db.AgentPath) (*Result, error) {
+	a, err := repo.GetAgentByID(ctx, agentID)
+	if err != nil {
+		return nil, &StoreError{err}
+	}
+	existing, err := repo.GetAgentPaths(ctx, agentID)
+	if err != nil {
+		return nil, &StoreError{fmt.Errorf("failed to load agent paths: %w", err)}
+	}
+	seen := make(map[string]bool, len(existing)+len(paths))
+	for _, p := range existing {
+		seen[p.Method+" "+p.Path] = true
+	}
+
+	result := &Result{AgentID: a.Id, Name: a.Name, Port: a.Port, Paths: []db.AgentPath{}}
+	for _, p := range paths {
+		if err := agent.ValidatePath(&p); err != nil {
+			result.Skipped = append(result.Skipped, invalidPath(p, err))
+			continue
+		}
+		key := p.Method + " " + p.Path
+		if seen[key] {
+			result.Skipped = append(result.Skipped, key+" (already mocked)")
+			continue
+		}
+		seen[key] = true
+
+		id, err := repo.AddPath(ctx, agentID, p)
+		if err != nil {
+			return nil, &StoreError{fmt.Errorf("failed to add path %s: %w", key, err)}
+		}
+		p.Id, p.AgentID = id, agentID
+		result.Paths = append(result.Paths, p)
+	}
+	return result, nil
+}
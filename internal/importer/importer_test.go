@@ -0,0 +1,70 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"mi6/internal/db"
+)
+
+func TestCreateAgentErrors(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepository(t)
+	paths := []db.AgentPath{{Method: "GET", Path: "/users"}}
+	if _, err := CreateAgent(ctx, repo, &db.Agent{Name: "users", Port: "18090"}, paths); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		agent     db.Agent
+		wantStore bool // Whether the repository, rather than the input, is at fault
+	}{
+		{"missing port", db.Agent{Name: "orders"}, false},
+		{"invalid upstream", db.Agent{Name: "orders", Port: "18091", UpstreamURL: "ftp://example.com"}, false},
+		{"name taken", db.Agent{Name: "users", Port: "18091"}, true},
+		{"port taken", db.Agent{Name: "orders", Port: "18090"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := CreateAgent(ctx, repo, &tt.agent, paths)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			var storeErr *StoreError
+			if errors.As(err, &storeErr) != tt.wantStore {
+				t.Errorf("got %v, StoreError %v; want %v", err, !tt.wantStore, tt.wantStore)
+			}
+			if tt.wantStore && !db.IsConflict(err) {
+				t.Errorf("got %v, want the UNIQUE violation kept in the chain", err)
+			}
+		})
+	}
+}
+
+func TestCreateAgentSkipsRepeatedPaths(t *testing.T) {
+	paths := []db.AgentPath{
+		{Method: "GET", Path: "/users", MockResponse: db.MockResponse{Response: "first"}},
+		{Method: "POST", Path: "/users"},
+		{Method: "get", Path: "/users", MockResponse: db.MockResponse{Response: "second"}},
+	}
+	result, err := CreateAgent(context.Background(), newTestRepository(t), &db.Agent{Name: "users", Port: "18090"}, paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Paths) != 2 || result.Paths[0].Response != "first" {
+		t.Errorf("got paths %+v, want the first GET and the POST", result.Paths)
+	}
+	if len(result.Skipped) != 1 || result.Skipped[0] != "GET /users (declared more than once; the first is kept)" {
+		t.Errorf("got skipped %q, want the second GET reported", result.Skipped)
+	}
+}
+
+func TestAddPathsReportsMissingAgent(t *testing.T) {
+	_, err := AddPaths(context.Background(), newTestRepository(t), 42, []db.AgentPath{{Method: "GET", Path: "/users"}})
+	var storeErr *StoreError
+	if !errors.As(err, &storeErr) {
+		t.Fatalf("got %v, want a StoreError", err)
+	}
+}
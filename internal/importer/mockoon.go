@@ -0,0 +1,346 @@
+package importer
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"mi6/internal/agent"
+	"mi6/internal/db"
+)
+
+// mockoonEnvironment is the part of a Mockoon environment file the importer reads.
+type mockoonEnvironment struct {
+	Name              string          `json:"name"`
+	Port              int             `json:"port"`
+	EndpointPrefix    string          `json:"endpointPrefix"`
+	Latency           int             `json:"latency"`
+	Headers           []mockoonHeader `json:"headers"`
+	ProxyMode         bool            `json:"proxyMode"`
+	ProxyHost         string          `json:"proxyHost"`
+	ProxyRemovePrefix bool            `json:"proxyRemovePrefix"`
+	ProxyReqHeaders   []mockoonHeader `json:"proxyReqHeaders"`
+	TLSOptions        struct {
+		Enabled bool `json:"enabled"`
+	} `json:"tlsOptions"`
+	Routes []mockoonRoute `json:"routes"`
+}
+
+type mockoonRoute struct {
+	Type         string            `json:"type"` // http, crud or ws
+	Method       string            `json:"method"`
+	Endpoint     string            `json:"endpoint"`
+	Responses    []mockoonResponse `json:"responses"`
+	ResponseMode string            `json:"responseMode"`
+}
+
+type mockoonResponse struct {
+	Label             string          `json:"label"`
+	StatusCode        int             `json:"statusCode"`
+	Headers           []mockoonHeader `json:"headers"`
+	Body              string          `json:"body"`
+	BodyType          string          `json:"bodyType"` // INLINE, FILE or DATABUCKET
+	FilePath          string          `json:"filePath"`
+	Latency           int             `json:"latency"`
+	Rules             []mockoonRule   `json:"rules"`
+	RulesOperator     string          `json:"rulesOperator"` // OR (the default) or AND
+	Default           bool            `json:"default"`
+	DisableTemplating bool            `json:"disableTemplating"`
+}
+
+type mockoonHeader struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type mockoonRule struct {
+	Target   string `json:"target"`
+	Modifier string `json:"modifier"`
+	Value    string `json:"value"`
+	Invert   bool   `json:"invert"`
+	Operator string `json:"operator"`
+}
+
+// mockoonSources maps the request parts Mockoon rules inspect onto condition sources.
+var mockoonSources = map[string]string{
+	"query":  db.SourceQuery,
+	"header": db.SourceHeader,
+	"body":   db.SourceBody,
+}
+
+// MockoonPaths translates the HTTP routes of a Mockoon environment file into
+// an agent and its paths. The agent takes the environment's name and port,
+// and its proxy settings as the upstream. Each route's default response
+// answers unmatched requests, the others become variants tried in order.
+// Body files are read from files, relative to it, when given.
+//
+// Whatever MI6 cannot reproduce is listed in the returned report instead.
+func MockoonPaths(data []byte, files fs.FS) (*db.Agent, []db.AgentPath, []string, error) {
+	var env mockoonEnvironment
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid Mockoon environment: %w", err)
+	}
+	if env.Routes == nil {
+		return nil, nil, nil, fmt.Errorf("invalid Mockoon environment: no routes")
+	}
+
+	var report []string
+	a := &db.Agent{Name: env.Name}
+	if env.Port != 0 {
+		a.Port = strconv.Itoa(env.Port)
+	}
+	prefix := "/" + strings.Trim(env.EndpointPrefix, "/")
+	if env.ProxyMode && env.ProxyHost != "" {
+		a.UpstreamURL = env.ProxyHost
+		if env.ProxyRemovePrefix && prefix != "/" {
+			a.StripPrefix = prefix
+		}
+		for _, h := range env.ProxyReqHeaders {
+			if a.ProxyHeaders == nil {
+				a.ProxyHeaders = map[string]string{}
+			}
+			a.ProxyHeaders[h.Key] = h.Value
+		}
+	}
+	if env.TLSOptions.Enabled {
+		report = append(report, "TLS is not supported; the agent serves plain HTTP")
+	}
+
+	var paths []db.AgentPath
+	seen := map[string]bool{}
+	for _, rt := range env.Routes {
+		method := strings.ToUpper(rt.Method)
+		if method == "ALL" || method == "" {
+			method = db.MethodAny
+		}
+		route := fmt.Sprintf("%s /%s", method, strings.TrimPrefix(rt.Endpoint, "/"))
+		note := func(format string, args ...any) {
+			report = append(report, route+": "+fmt.Sprintf(format, args...))
+		}
+
+		if rt.Type != "" && rt.Type != "http" {
+			note("%s routes are not supported; route skipped", rt.Type)
+			continue
+		}
+		if len(rt.Responses) == 0 {
+			note("no responses; route skipped")
+			continue
+		}
+		routePath, ok := mockoonPath(prefix, rt.Endpoint)
+		if !ok {
+			note("the endpoint cannot be expressed as a route pattern; route skipped")
+			continue
+		}
+		if seen[method+" "+routePath] {
+			note("duplicate route; skipped")
+			continue
+		}
+		seen[method+" "+routePath] = true
+
+		p := db.AgentPath{Method: method, Path: routePath}
+		fallback := 0
+		for i, r := range rt.Responses {
+			if r.Default {
+				fallback = i
+				break
+			}
+		}
+		p.MockResponse = mockoonResponseOf(env, rt.Responses[fallback], files, note)
+		if latency := env.Latency + rt.Responses[fallback].Latency; latency > 0 {
+			p.Delay = &db.Delay{Distribution: db.DelayFixed, FixedMs: latency}
+		}
+
+		switch rt.ResponseMode {
+		case "SEQUENTIAL":
+			for _, r := range rt.Responses {
+				p.Sequence = append(p.Sequence, mockoonResponseOf(env, r, files, note))
+			}
+			p.SequenceMode = db.SequenceCycle
+			paths = append(paths, p)
+			continue // Rules are not evaluated in sequential mode
+		case "DISABLE_RULES":
+			paths = append(paths, p)
+			continue
+		case "":
+		default:
+			note("response mode %s is not supported; rules are evaluated in order instead", rt.ResponseMode)
+		}
+
+		for i, r := range rt.Responses {
+			if i == fallback || len(r.Rules) == 0 {
+				continue
+			}
+			label := r.Label
+			if label == "" {
+				label = fmt.Sprintf("response #%d", i+1)
+			}
+			variantNote := func(format string, args ...any) { note(label+": "+format, args...) }
+
+			var sets [][]db.Condition // Alternatives, any of which selects the response
+			ok := true
+			for _, rule := range r.Rules {
+				c, problem := mockoonCondition(rule)
+				if c == nil {
+					variantNote("%s; response skipped", problem)
+					ok = false
+					break
+				}
+				if r.RulesOperator == "AND" && len(sets) > 0 {
+					sets[0] = append(sets[0], *c)
+				} else {
+					sets = append(sets, []db.Condition{*c})
+				}
+			}
+			if !ok {
+				continue
+			}
+			if r.Latency != rt.Responses[fallback].Latency {
+				variantNote("its own latency is not supported; the route's applies")
+			}
+
+			response := mockoonResponseOf(env, r, files, variantNote)
+			for _, conditions := range sets {
+				p.Variants = append(p.Variants, db.ResponseVariant{
+					Name:         label,
+					Priority:     len(p.Variants),
+					Conditions:   conditions,
+					MockResponse: response,
+				})
+			}
+		}
+		paths = append(paths, p)
+	}
+	return a, paths, report, nil
+}
+
+var mockoonParam = regexp.MustCompile(`^:([A-Za-z0-9_]+)$`)
+
+// mockoonPath turns an Express-style endpoint, such as users/:id, into a
+// route pattern under the environment's prefix.
+func mockoonPath(prefix, endpoint string) (string, bool) {
+	segments := strings.Split(strings.Trim(endpoint, "/"), "/")
+	for i, s := range segments {
+		switch {
+		case mockoonParam.MatchString(s):
+			segments[i] = mockoonParam.ReplaceAllString(s, "{$1}")
+		case s == "*" && i == len(segments)-1:
+		case strings.ContainsAny(s, ":*?+()"):
+			return "", false // Optional parameters and Express's regexp syntax
+		}
+	}
+	return path.Join(prefix, strings.Join(segments, "/")), true
+}
+
+// mockoonCondition translates a response rule, or explains why it cannot be.
+func mockoonCondition(rule mockoonRule) (*db.Condition, string) {
+	source, ok := mockoonSources[rule.Target]
+	if !ok {
+		return nil, fmt.Sprintf("rules on %s are not supported", rule.Target)
+	}
+	if rule.Invert {
+		return nil, "inverted rules are not supported"
+	}
+	c := db.Condition{Source: source, Key: rule.Modifier}
+	if source == db.SourceBody && c.Key != "" && !strings.HasPrefix(c.Key, "$") {
+		c.Key = "$." + c.Key // Mockoon's object paths are dotted, as JSONPath's are
+	}
+
+	value := rule.Value
+	switch rule.Operator {
+	case "", "equals":
+		c.Equals = &value
+	case "regex":
+		c.Matches = value
+	case "regex_i":
+		c.Matches = "(?i)" + value
+	case "null":
+		c.Absent = true
+	default:
+		return nil, fmt.Sprintf("the %s operator is not supported", rule.Operator)
+	}
+	if err := agent.ValidateCondition(c); err != nil {
+		return nil, err.Error()
+	}
+	return &c, ""
+}
+
+func mockoonResponseOf(env mockoonEnvironment, r mockoonResponse, files fs.FS, note func(format string, args ...any)) db.MockResponse {
+	m := db.MockResponse{StatusCode: r.StatusCode, Headers: map[string]string{}}
+	for _, h := range env.Headers {
+		m.Headers[h.Key] = h.Value
+	}
+	for _, h := range r.Headers {
+		m.Headers[h.Key] = h.Value
+	}
+	if m.StatusCode == 0 {
+		m.StatusCode = http.StatusOK
+	}
+
+	switch r.BodyType {
+	case "", "INLINE":
+		m.Response = r.Body
+	case "FILE":
+		data, err := readMockoonFile(files, r.FilePath)
+		if err != nil {
+			note("body file %s: %v", r.FilePath, err)
+			break
+		}
+		m.Response = string(data)
+		if !utf8.Valid(data) {
+			m.Response, m.Encoding = base64.StdEncoding.EncodeToString(data), db.EncodingBase64
+		}
+	default:
+		note("%s bodies are not supported", strings.ToLower(r.BodyType))
+	}
+	if !r.DisableTemplating && strings.Contains(m.Response, "{{") {
+		note("templates are served as is; rewrite them as Go templates and set templated")
+	}
+	return m
+}
+
+// readMockoonFile reads a body file. Mockoon stores absolute or
+// environment-relative paths, so the file is looked up under files by its
+// path, then by ever shorter trailing parts of it, down to its name alone.
+func readMockoonFile(files fs.FS, name string) ([]byte, error) {
+	if files == nil {
+		return nil, fmt.Errorf("no directory to read it from")
+	}
+	if strings.Contains(name, "{{") {
+		return nil, fmt.Errorf("templated file paths are not supported")
+	}
+	parts := strings.Split(path.Clean(strings.ReplaceAll(name, `\`, "/")), "/")
+	for i := range parts {
+		candidate := path.Join(parts[i:]...)
+		if !fs.ValidPath(candidate) {
+			continue
+		}
+		if data, err := fs.ReadFile(files, candidate); err == nil {
+			return data, nil
+		}
+	}
+	return nil, fmt.Errorf("not found")
+}
+
+// Mockoon creates an agent from a Mockoon environment file. The agent's name
+// and port default to the environment's. See MockoonPaths.
+func Mockoon(ctx context.Context, repo db.AgentRepository, a *db.Agent, data []byte, files fs.FS) (*Result, error) {
+	env, paths, report, err := MockoonPaths(data, files)
+	if err != nil {
+		return nil, err
+	}
+	if a.Name != "" {
+		env.Name = a.Name
+	}
+	if a.Port != "" {
+		env.Port = a.Port
+	}
+	return createReported(ctx, repo, env, paths, report)
+}
@@ -0,0 +1,204 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"mi6/internal/db"
+)
+
+func TestMockoonPath(t *testing.T) {
+	tests := []struct {
+		prefix, endpoint string
+		want             string
+		wantOK           bool
+	}{
+		{"/", "users", "/users", true},
+		{"/api", "/users/:id/orders", "/api/users/{id}/orders", true},
+		{"/", "files/*", "/files/*", true},
+		{"/", "", "/", true},
+		{"/", "users/:id?", "", false},
+		{"/", "*/users", "", false},
+		{"/", "ab+c", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prefix+" "+tt.endpoint, func(t *testing.T) {
+			got, ok := mockoonPath(tt.prefix, tt.endpoint)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("got %q, %v; want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestMockoonCondition(t *testing.T) {
+	tests := []struct {
+		name        string
+		rule        mockoonRule
+		want        string
+		wantProblem string
+	}{
+		{"equals by default", mockoonRule{Target: "query", Modifier: "page", Value: "2"}, "query page equals 2", ""},
+		{"header regex", mockoonRule{Target: "header", Modifier: "Accept", Value: "json$", Operator: "regex"}, "header Accept matches json$", ""},
+		{"case insensitive regex", mockoonRule{Target: "query", Modifier: "q", Value: "^a", Operator: "regex_i"}, "query q matches (?i)^a", ""},
+		{"dotted body path", mockoonRule{Target: "body", Modifier: "order.id", Value: "1", Operator: "equals"}, "body $.order.id equals 1", ""},
+		{"JSONPath body path", mockoonRule{Target: "body", Modifier: "$.tags[0]", Value: "new"}, "body $.tags[0] equals new", ""},
+		{"null", mockoonRule{Target: "header", Modifier: "X-Debug", Operator: "null"}, "header X-Debug absent", ""},
+		{"unsupported target", mockoonRule{Target: "cookie", Modifier: "session", Value: "x"}, "", "rules on cookie are not supported"},
+		{"inverted", mockoonRule{Target: "query", Modifier: "q", Value: "x", Invert: true}, "", "inverted rules are not supported"},
+		{"unsupported operator", mockoonRule{Target: "query", Modifier: "q", Value: "x", Operator: "array_includes"}, "", "the array_includes operator is not supported"},
+		{"invalid regexp", mockoonRule{Target: "query", Modifier: "q", Value: "(", Operator: "regex"}, "", "("},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, problem := mockoonCondition(tt.rule)
+			if tt.wantProblem != "" {
+				if c != nil || !strings.Contains(problem, tt.wantProblem) {
+					t.Errorf("got %+v, %q; want no condition and a problem mentioning %q", c, problem, tt.wantProblem)
+				}
+				return
+			}
+			if c == nil {
+				t.Fatalf("got problem %q, want %q", problem, tt.want)
+			}
+			if got := describe([]db.Condition{*c}); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadMockoonFile(t *testing.T) {
+	files := fstest.MapFS{
+		"bodies/user.json": {Data: []byte(`{"id": 1}`)},
+		"logo.png":         {Data: []byte{0x89, 'P', 'N', 'G'}},
+	}
+	tests := []struct {
+		name    string
+		want    string
+		wantErr string
+	}{
+		{"bodies/user.json", `{"id": 1}`, ""},
+		{"/home/ada/mocks/bodies/user.json", `{"id": 1}`, ""},
+		{`C:\mocks\logo.png`, "\x89PNG", ""},
+		{"bodies/missing.json", "", "not found"},
+		{"bodies/{{urlParam 'id'}}.json", "", "templated file paths are not supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := readMockoonFile(files, tt.name)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("got %v, want an error mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || string(data) != tt.want {
+				t.Errorf("got %q, %v; want %q", data, err, tt.want)
+			}
+		})
+	}
+	if _, err := readMockoonFile(nil, "user.json"); err == nil {
+		t.Error("expected an error without a directory to read from")
+	}
+}
+
+const shopEnvironment = `{
+	"name": "shop", "port": 3001, "endpointPrefix": "api", "latency": 10,
+	"headers": [{"key": "Content-Type", "value": "application/json"}],
+	"tlsOptions": {"enabled": true},
+	"routes": [
+		{"type": "http", "method": "get", "endpoint": "orders/:id", "responses": [
+			{"label": "paid", "statusCode": 200, "body": "{\"status\": \"paid\"}", "rulesOperator": "AND",
+			 "rules": [{"target": "query", "modifier": "expand", "value": "true"},
+			           {"target": "header", "modifier": "Accept", "value": "json", "operator": "regex"}]},
+			{"statusCode": 404, "body": "{}", "default": true},
+			{"label": "either", "statusCode": 410,
+			 "rules": [{"target": "query", "modifier": "archived", "value": "1"},
+			           {"target": "query", "modifier": "deleted", "value": "1"}]},
+			{"label": "inverted", "rules": [{"target": "query", "modifier": "x", "value": "1", "invert": true}]},
+			{"label": "slow", "latency": 500, "rules": [{"target": "query", "modifier": "slow", "value": "1"}]}
+		]},
+		{"method": "post", "endpoint": "orders", "responseMode": "SEQUENTIAL", "responses": [
+			{"statusCode": 201, "bodyType": "FILE", "filePath": "/tmp/mocks/created.json"},
+			{"statusCode": 429, "body": "{{faker 'lorem.word'}}"}
+		]},
+		{"method": "get", "endpoint": "orders/:id", "responses": [{"statusCode": 200}]},
+		{"type": "ws", "endpoint": "events", "responses": [{}]},
+		{"method": "get", "endpoint": "empty", "responses": []},
+		{"method": "get", "endpoint": "users/:id?", "responses": [{}]},
+		{"method": "all", "endpoint": "search", "responseMode": "RANDOM", "responses": [{"body": "[]"}]}
+	]
+}`
+
+func TestMockoonPaths(t *testing.T) {
+	files := fstest.MapFS{"created.json": {Data: []byte(`{"id": 7}`)}}
+	a, paths, report, err := MockoonPaths([]byte(shopEnvironment), files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Name != "shop" || a.Port != "3001" {
+		t.Errorf("got agent %+v, want shop on 3001", a)
+	}
+	byRoute := map[string]db.AgentPath{}
+	for _, p := range paths {
+		byRoute[p.Method+" "+p.Path] = p
+	}
+	if len(paths) != 3 {
+		t.Fatalf("got %d paths, want 3: %+v", len(paths), paths)
+	}
+
+	order := byRoute["GET /api/orders/{id}"]
+	if order.StatusCode != 404 || order.Headers["Content-Type"] != "application/json" {
+		t.Errorf("got fallback %d with headers %v, want the default 404 with the environment's headers", order.StatusCode, order.Headers)
+	}
+	if order.Delay == nil || order.Delay.FixedMs != 10 {
+		t.Errorf("got delay %+v, want the environment's 10ms", order.Delay)
+	}
+	var variants []string
+	for _, v := range order.Variants {
+		variants = append(variants, v.Name+"["+describe(v.Conditions)+"]")
+	}
+	want := []string{
+		"paid[query expand equals true; header Accept matches json]",
+		"either[query archived equals 1]",
+		"either[query deleted equals 1]",
+		"slow[query slow equals 1]",
+	}
+	if strings.Join(variants, " ") != strings.Join(want, " ") {
+		t.Errorf("got variants %q, want %q", variants, want)
+	}
+
+	created := byRoute["POST /api/orders"]
+	if created.SequenceMode != db.SequenceCycle || len(created.Sequence) != 2 || created.Sequence[0].Response != `{"id": 7}` {
+		t.Errorf("got sequence %+v (%s), want the file body then the 429, cycling", created.Sequence, created.SequenceMode)
+	}
+	if _, ok := byRoute[db.MethodAny+" /api/search"]; !ok {
+		t.Errorf("expected ALL /search to be imported for any method, got %v", byRoute)
+	}
+
+	for _, line := range []string{
+		"TLS is not supported",
+		"GET /orders/:id: inverted: inverted rules are not supported; response skipped",
+		"GET /orders/:id: slow: its own latency is not supported",
+		"POST /orders: templates are served as is",
+		"GET /orders/:id: duplicate route; skipped",
+		"ANY /events: ws routes are not supported; route skipped",
+		"GET /empty: no responses; route skipped",
+		"GET /users/:id?: the endpoint cannot be expressed as a route pattern; route skipped",
+		"response mode RANDOM is not supported",
+	} {
+		if !strings.Contains(strings.Join(report, "\n"), line) {
+			t.Errorf("report lacks %q:\n%s", line, strings.Join(report, "\n"))
+		}
+	}
+}
+
+func TestMockoonRejectsOtherFormats(t *testing.T) {
+	for _, data := range []string{`not json`, `{"name": "no routes"}`} {
+		if _, _, _, err := MockoonPaths([]byte(data), nil); err == nil {
+			t.Errorf("expected %s to be rejected", data)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package importer
+
+import (
+	"context"
+
+	"mi6/internal/db"
+	"mi6/internal/openapi"
+)
+
+// OpenAPI creates an agent with one path per operation of an OpenAPI 3 or
+// Swagger 2 specification. The agent is named after the API's title unless
+// a.Name is set.
+func OpenAPI(ctx context.Context, repo db.AgentRepository, a *db.Agent, spec []byte) (*Result, error) {
+	s, err := openapi.Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+	paths, err := s.Paths()
+	if err != nil {
+		return nil, err
+	}
+	if a.Name == "" {
+		a.Name = s.Title
+	}
+	return CreateAgent(ctx, repo, a, paths)
+}
@@ -0,0 +1,186 @@
+package importer
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"mi6/internal/db"
+	"mi6/internal/postman"
+)
+
+// PostmanPaths turns the requests of a collection into mock paths, filed in
+// groups named after their folders. A request's first saved example is its
+// response; later examples saved for a different query string become
+// variants matching it. Variables are resolved from the collection,
+// overridden by the environment, if any.
+//
+// Requests without a saved example have nothing to mock: they are returned
+// as unmocked, as "METHOD /path".
+func PostmanPaths(c *postman.Collection, env *postman.Environment) (paths []db.AgentPath, unmocked []string) {
+	vars := c.Variables(env)
+	c.Walk(func(folder string, item postman.Item) {
+		method := strings.ToUpper(item.Request.Method)
+		if method == "" {
+			method = http.MethodGet
+		}
+		path := postmanPath(item.Request.URL, vars)
+		if len(item.Response) == 0 {
+			unmocked = append(unmocked, method+" "+path)
+			return
+		}
+
+		p := db.AgentPath{Method: method, Path: path, Group: folder}
+		fallback := exampleQuery(item.Response[0], item.Request, vars)
+		p.MockResponse = postmanResponse(item.Response[0], vars)
+
+		seen := map[string]bool{fallback.Encode(): true}
+		for _, example := range item.Response[1:] {
+			query := exampleQuery(example, item.Request, vars)
+			if len(query) == 0 || seen[query.Encode()] {
+				continue // Only the first example of each query can be served
+			}
+			seen[query.Encode()] = true
+			p.Variants = append(p.Variants, db.ResponseVariant{
+				Name:         example.Name,
+				Conditions:   queryConditions(query),
+				MockResponse: postmanResponse(example, vars),
+			})
+		}
+		paths = append(paths, p)
+	})
+	return paths, unmocked
+}
+
+var (
+	pathVariable = regexp.MustCompile(`^:([A-Za-z0-9_]+)$`)
+	unresolved   = regexp.MustCompile(`\{\{\s*([^{}]+?)\s*\}\}`)
+)
+
+// postmanPath reduces a request URL to a route pattern: the scheme, host and
+// query string are dropped, and path variables, whether :name or unresolved
+// {{name}}, become {name} parameters.
+func postmanPath(u postman.URL, vars postman.Variables) string {
+	raw := vars.Resolve(u.Raw)
+	if raw == "" {
+		raw = "/" + vars.Resolve(strings.Join(u.Path, "/"))
+	}
+	raw, _, _ = strings.Cut(raw, "#")
+	raw, _, _ = strings.Cut(raw, "?")
+	if _, rest, ok := strings.Cut(raw, "://"); ok {
+		raw = rest
+	}
+	if !strings.HasPrefix(raw, "/") {
+		// A host, given literally or by an unresolved {{variable}}.
+		_, rest, _ := strings.Cut(raw, "/")
+		raw = "/" + rest
+	}
+
+	segments := strings.Split(raw, "/")
+	for i, s := range segments {
+		s = pathVariable.ReplaceAllString(s, "{$1}")
+		segments[i] = unresolved.ReplaceAllString(s, "{$1}")
+	}
+	return strings.Join(segments, "/")
+}
+
+// exampleQuery is the enabled query of the request an example was saved for.
+func exampleQuery(example postman.Response, request *postman.Request, vars postman.Variables) url.Values {
+	if example.OriginalRequest != nil {
+		request = example.OriginalRequest
+	}
+	query := url.Values{}
+	if len(request.URL.Query) == 0 {
+		if _, raw, ok := strings.Cut(vars.Resolve(request.URL.Raw), "?"); ok {
+			raw, _, _ = strings.Cut(raw, "#")
+			query, _ = url.ParseQuery(raw)
+		}
+		return query
+	}
+	for _, q := range request.URL.Query {
+		if !q.Disabled {
+			query.Add(vars.Resolve(q.Key), vars.Resolve(q.Value))
+		}
+	}
+	return query
+}
+
+func postmanResponse(example postman.Response, vars postman.Variables) db.MockResponse {
+	m := db.MockResponse{StatusCode: example.Code, Headers: map[string]string{}}
+	if m.StatusCode == 0 {
+		m.StatusCode = http.StatusOK
+	}
+	hasContentType := false
+	for _, h := range example.Header {
+		if h.Disabled || skippedResponseHeaders[strings.ToLower(h.Key)] {
+			continue
+		}
+		m.Headers[h.Key] = vars.Resolve(h.Value)
+		hasContentType = hasContentType || strings.EqualFold(h.Key, "Content-Type")
+	}
+	if !hasContentType && example.PreviewLanguage == "json" {
+		m.Headers["Content-Type"] = "application/json"
+	}
+	m.Response = vars.Resolve(example.Body)
+	return m
+}
+
+// Postman creates an agent from a collection and an optional environment,
+// named after the collection unless a name is given. Requests without a
+// saved example are reported as skipped.
+func Postman(ctx context.Context, repo db.AgentRepository, a *db.Agent, collection, environment []byte) (*Result, error) {
+	c, env, err := parsePostman(collection, environment)
+	if err != nil {
+		return nil, err
+	}
+	if a.Name == "" {
+		a.Name = c.Info.Name
+	}
+	paths, unmocked := PostmanPaths(c, env)
+	result, err := CreateAgent(ctx, repo, a, paths)
+	if err != nil {
+		return nil, err
+	}
+	result.Skipped = append(result.Skipped, noExample(unmocked)...)
+	return result, nil
+}
+
+// PostmanInto adds the requests of a collection to an existing agent.
+func PostmanInto(ctx context.Context, repo db.AgentRepository, agentID int, collection, environment []byte) (*Result, error) {
+	c, env, err := parsePostman(collection, environment)
+	if err != nil {
+		return nil, err
+	}
+	paths, unmocked := PostmanPaths(c, env)
+	result, err := AddPaths(ctx, repo, agentID, paths)
+	if err != nil {
+		return nil, err
+	}
+	result.Skipped = append(result.Skipped, noExample(unmocked)...)
+	return result, nil
+}
+
+func parsePostman(collection, environment []byte) (*postman.Collection, *postman.Environment, error) {
+	c, err := postman.Parse(collection)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(environment) == 0 {
+		return c, nil, nil
+	}
+	env, err := postman.ParseEnvironment(environment)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, env, nil
+}
+
+func noExample(requests []string) []string {
+	skipped := make([]string, len(requests))
+	for i, r := range requests {
+		skipped[i] = r + " (no saved example)"
+	}
+	return skipped
+}
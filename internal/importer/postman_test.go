@@ -0,0 +1,171 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"mi6/internal/db"
+	"mi6/internal/postman"
+)
+
+func TestPostmanPath(t *testing.T) {
+	vars := postman.Variables{"baseUrl": "https://api.example.com/v1", "version": "2"}
+	tests := []struct {
+		url  postman.URL
+		want string
+	}{
+		{postman.URL{Raw: "{{baseUrl}}/users/:id?verbose=1"}, "/v1/users/{id}"},
+		{postman.URL{Raw: "https://shop.example.com/orders#top"}, "/orders"},
+		{postman.URL{Raw: "{{host}}/items/{{itemId}}"}, "/items/{itemId}"},
+		{postman.URL{Raw: "/api/v{{version}}/health"}, "/api/v2/health"},
+		{postman.URL{Path: []string{"files", ":name"}}, "/files/{name}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url.Raw, func(t *testing.T) {
+			if got := postmanPath(tt.url, vars); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+const shopCollection = `{
+  "info": {"name": "Shop", "schema": "https://schema.getpostman.com/json/collection/v2.1.0/collection.json"},
+  "variable": [{"key": "baseUrl", "value": "https://shop.example.com"}, {"key": "greeting", "value": "hello"}],
+  "item": [
+    {"name": "Orders", "item": [
+      {"name": "Admin", "item": [
+        {
+          "name": "Search orders",
+          "request": {"method": "get", "url": {"raw": "{{baseUrl}}/orders?status=open", "query": [{"key": "status", "value": "open"}]}},
+          "response": [
+            {"name": "Open", "code": 200, "header": [{"key": "Content-Length", "value": "9"}, {"key": "X-Greeting", "value": "{{greeting}}"}],
+             "body": "[\"open\"]", "_postman_previewlanguage": "json"},
+            {"name": "Closed", "originalRequest": {"method": "GET", "url": {"raw": "{{baseUrl}}/orders?status=closed", "query": [{"key": "status", "value": "closed"}]}},
+             "code": 200, "body": "[\"closed\"]"},
+            {"name": "Closed again", "originalRequest": {"method": "GET", "url": "{{baseUrl}}/orders?status=closed"}, "code": 500, "body": "dup"},
+            {"name": "Unfiltered", "originalRequest": {"method": "GET", "url": "{{baseUrl}}/orders"}, "code": 200, "body": "[]"}
+          ]
+        }
+      ]}
+    ]},
+    {"name": "Create order", "request": {"method": "POST", "url": "{{baseUrl}}/orders"}},
+    {"name": "Health", "request": "{{baseUrl}}/health", "response": [{"name": "Up", "body": "ok"}]}
+  ]
+}`
+
+func TestPostmanPaths(t *testing.T) {
+	c, err := postman.Parse([]byte(shopCollection))
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := postman.ParseEnvironment([]byte(`{"name": "staging", "values": [{"key": "greeting", "value": "hi"}, {"key": "baseUrl", "value": "https://x", "enabled": false}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths, unmocked := PostmanPaths(c, env)
+	var got []string
+	for _, p := range paths {
+		var variants []string
+		for _, v := range p.Variants {
+			variants = append(variants, fmt.Sprintf("%s%v=%d", v.Name, conditionsOf(v.Conditions), v.StatusCode))
+		}
+		got = append(got, fmt.Sprintf("%s %s [%s] %d %s %v", p.Method, p.Path, p.Group, p.StatusCode, p.Response, variants))
+	}
+	want := []string{
+		`GET /orders [Orders/Admin] 200 ["open"] [Closed[status=closed]=200]`,
+		`GET /health [] 200 ok []`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if len(unmocked) != 1 || unmocked[0] != "POST /orders" {
+		t.Errorf("got unmocked %q, want POST /orders", unmocked)
+	}
+
+	headers := paths[0].Headers
+	if _, ok := headers["Content-Length"]; ok || headers["X-Greeting"] != "hi" || headers["Content-Type"] != "application/json" {
+		t.Errorf("got headers %v, want the environment's greeting and a JSON content type", headers)
+	}
+}
+
+// conditionsOf summarizes equality conditions as key=value pairs.
+func conditionsOf(conditions []db.Condition) []string {
+	var out []string
+	for _, c := range conditions {
+		value := ""
+		if c.Equals != nil {
+			value = *c.Equals
+		}
+		out = append(out, c.Key+"="+value)
+	}
+	return out
+}
+
+func TestPostmanImportReportsRequestsWithoutExamples(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepository(t)
+
+	result, err := Postman(ctx, repo, &db.Agent{Port: "18085"}, []byte(shopCollection), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Name != "Shop" || len(result.Paths) != 2 {
+		t.Errorf("got agent %q with %d paths, want Shop with 2", result.Name, len(result.Paths))
+	}
+	if len(result.Skipped) != 1 || result.Skipped[0] != "POST /orders (no saved example)" {
+		t.Errorf("got skipped %q", result.Skipped)
+	}
+
+	into, err := PostmanInto(ctx, repo, result.AgentID, []byte(shopCollection), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(into.Paths) != 0 || len(into.Skipped) != 3 {
+		t.Errorf("re-import added %d paths and skipped %q, want everything skipped", len(into.Paths), into.Skipped)
+	}
+}
+
+func TestPostmanRejectsOtherFormats(t *testing.T) {
+	for name, data := range map[string]string{
+		"not JSON":  "collection",
+		"version 1": `{"info": {"name": "Old", "schema": "https://schema.getpostman.com/json/collection/v1.0.0/collection.json"}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Postman(context.Background(), nil, &db.Agent{Port: "1"}, []byte(data), nil); err == nil {
+				t.Error("expected the collection to be rejected")
+			}
+		})
+	}
+}
+
+func TestPostmanExportRoundTrip(t *testing.T) {
+	status := "failed"
+	paths := []db.AgentPath{
+		{
+			Method: "GET", Path: "/jobs/{id:[0-9]+}", Group: "Jobs",
+			MockResponse: db.MockResponse{Response: `{"state": "ok"}`, StatusCode: 200, Headers: map[string]string{"Content-Type": "application/json"}},
+			Variants: []db.ResponseVariant{{
+				Name:         "failed",
+				Conditions:   []db.Condition{{Source: db.SourceQuery, Key: "status", Predicate: db.Predicate{Equals: &status}}},
+				MockResponse: db.MockResponse{Response: "boom", StatusCode: 500},
+			}},
+		},
+	}
+	c := postman.Export(&db.Agent{Name: "Jobs", Port: "18000"}, paths)
+
+	imported, unmocked := PostmanPaths(c, nil)
+	if len(imported) != 1 || len(unmocked) != 0 {
+		t.Fatalf("got %d paths and %d unmocked, want 1 and 0", len(imported), len(unmocked))
+	}
+	p := imported[0]
+	if p.Path != "/jobs/{id}" || p.Group != "Jobs" || p.Response != paths[0].Response || p.Headers["Content-Type"] != "application/json" {
+		t.Errorf("got %+v, want the exported path back", p)
+	}
+	if len(p.Variants) != 1 || p.Variants[0].StatusCode != 500 || conditionsOf(p.Variants[0].Conditions)[0] != "status=failed" {
+		t.Errorf("got variants %+v, want the failed variant back", p.Variants)
+	}
+}
@@ -0,0 +1,671 @@
+package importer
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"mi6/internal/agent"
+	"mi6/internal/db"
+)
+
+// wireMockStub is the part of a WireMock stub mapping the importer reads.
+type wireMockStub struct {
+	Name     string `json:"name"`
+	Priority int    `json:"priority"`
+	Request  struct {
+		Method               string                     `json:"method"`
+		URL                  string                     `json:"url"`
+		URLPath              string                     `json:"urlPath"`
+		URLPattern           string                     `json:"urlPattern"`
+		URLPathPattern       string                     `json:"urlPathPattern"`
+		URLPathTemplate      string                     `json:"urlPathTemplate"`
+		QueryParameters      map[string]wireMockMatcher `json:"queryParameters"`
+		Headers              map[string]wireMockMatcher `json:"headers"`
+		PathParameters       map[string]wireMockMatcher `json:"pathParameters"`
+		Cookies              map[string]wireMockMatcher `json:"cookies"`
+		BodyPatterns         []wireMockMatcher          `json:"bodyPatterns"`
+		BasicAuthCredentials *struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+		} `json:"basicAuthCredentials"`
+	} `json:"request"`
+	Response struct {
+		Status                 int                        `json:"status"`
+		Headers                map[string]json.RawMessage `json:"headers"`
+		Body                   string                     `json:"body"`
+		JSONBody               json.RawMessage            `json:"jsonBody"`
+		Base64Body             string                     `json:"base64Body"`
+		BodyFileName           string                     `json:"bodyFileName"`
+		FixedDelayMilliseconds int                        `json:"fixedDelayMilliseconds"`
+		DelayDistribution      *struct {
+			Type   string  `json:"type"`
+			Median float64 `json:"median"`
+			Sigma  float64 `json:"sigma"`
+			Lower  int     `json:"lower"`
+			Upper  int     `json:"upper"`
+		} `json:"delayDistribution"`
+		ChunkedDribbleDelay *struct {
+			NumberOfChunks int `json:"numberOfChunks"`
+			TotalDuration  int `json:"totalDuration"`
+		} `json:"chunkedDribbleDelay"`
+		Fault        string   `json:"fault"`
+		Transformers []string `json:"transformers"`
+		ProxyBaseURL string   `json:"proxyBaseUrl"`
+	} `json:"response"`
+	ScenarioName          string `json:"scenarioName"`
+	RequiredScenarioState string `json:"requiredScenarioState"`
+	NewScenarioState      string `json:"newScenarioState"`
+
+	source string // The file, and index within it, the stub was read from
+}
+
+// wireMockMatcher is a WireMock value matcher, e.g. {"equalTo": "x"}.
+type wireMockMatcher map[string]json.RawMessage
+
+// wireMockDefaultPriority is the priority WireMock gives stubs without one.
+const wireMockDefaultPriority = 5
+
+// wireMockFaults maps WireMock's faults onto MI6's.
+var wireMockFaults = map[string]string{
+	"EMPTY_RESPONSE":           db.FaultEmptyResponse,
+	"RANDOM_DATA_THEN_CLOSE":   db.FaultRandomData,
+	"CONNECTION_RESET_BY_PEER": db.FaultConnectionReset,
+	"MALFORMED_RESPONSE_CHUNK": db.FaultMalformedChunk,
+}
+
+// WireMockPaths translates the stub mappings of a WireMock root directory:
+// the JSON files under mappings/, with the body files they name in __files/.
+// A root holding a single directory, as archives often do, is descended into.
+//
+// Stubs for the same method and URL path become one path whose variants are
+// tried in WireMock's priority order. Whatever MI6 cannot reproduce is listed
+// in the returned report instead; stubs that cannot be matched at all are
+// left out.
+func WireMockPaths(fsys fs.FS) ([]db.AgentPath, []string, error) {
+	fsys, err := wireMockRoot(fsys)
+	if err != nil {
+		return nil, nil, err
+	}
+	mappings := "mappings"
+	if info, err := fs.Stat(fsys, mappings); err != nil || !info.IsDir() {
+		mappings = "." // Mapping files given without the surrounding root
+	}
+
+	var stubs []wireMockStub
+	err = fs.WalkDir(fsys, mappings, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if name != mappings && strings.HasPrefix(d.Name(), "__") {
+				return fs.SkipDir // __files, or archive metadata such as __MACOSX
+			}
+			return nil
+		}
+		if !strings.EqualFold(path.Ext(name), ".json") {
+			return nil
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		found, err := parseWireMockStubs(data, name)
+		if err != nil {
+			return err
+		}
+		stubs = append(stubs, found...)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(stubs) == 0 {
+		return nil, nil, errors.New("no WireMock stub mappings found")
+	}
+
+	files, err := fs.Sub(fsys, "__files")
+	if err != nil {
+		return nil, nil, err
+	}
+	paths, report := wireMockPaths(stubs, files)
+	return paths, report, nil
+}
+
+// WireMockStubPaths translates stub mappings given as a single JSON document:
+// one mapping, or {"mappings": [...]} as exported by WireMock's admin API.
+// There are no body files to read.
+func WireMockStubPaths(data []byte) ([]db.AgentPath, []string, error) {
+	stubs, err := parseWireMockStubs(data, "mappings")
+	if err != nil {
+		return nil, nil, err
+	}
+	paths, report := wireMockPaths(stubs, nil)
+	return paths, report, nil
+}
+
+// wireMockRoot descends into the only directory of an archive's root.
+func wireMockRoot(fsys fs.FS) (fs.FS, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	var dirs []fs.DirEntry
+	for _, e := range entries {
+		if e.Name() == "__MACOSX" {
+			continue
+		}
+		if !e.IsDir() || e.Name() == "mappings" || e.Name() == "__files" {
+			return fsys, nil
+		}
+		dirs = append(dirs, e)
+	}
+	if len(dirs) != 1 {
+		return fsys, nil
+	}
+	return fs.Sub(fsys, dirs[0].Name())
+}
+
+func parseWireMockStubs(data []byte, source string) ([]wireMockStub, error) {
+	var doc struct {
+		Mappings []wireMockStub `json:"mappings"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid WireMock mapping %s: %w", source, err)
+	}
+	if doc.Mappings == nil {
+		var stub wireMockStub
+		if err := json.Unmarshal(data, &stub); err != nil {
+			return nil, fmt.Errorf("invalid WireMock mapping %s: %w", source, err)
+		}
+		stub.source = source
+		return []wireMockStub{stub}, nil
+	}
+	for i := range doc.Mappings {
+		doc.Mappings[i].source = fmt.Sprintf("%s #%d", source, i+1)
+	}
+	return doc.Mappings, nil
+}
+
+// wireMockRoute collects the stubs served on one method and path.
+type wireMockRoute struct {
+	method, path string
+	stubs        []wireMockStub
+	variants     []db.ResponseVariant // In the order of stubs
+	delays       []*db.Delay
+	throttles    []*db.Throttle
+}
+
+func wireMockPaths(stubs []wireMockStub, files fs.FS) ([]db.AgentPath, []string) {
+	var report []string
+	note := func(s wireMockStub, format string, args ...any) {
+		label := s.source
+		if s.Name != "" {
+			label += " (" + s.Name + ")"
+		}
+		report = append(report, label+": "+fmt.Sprintf(format, args...))
+	}
+
+	var routes []*wireMockRoute
+	byKey := map[string]*wireMockRoute{}
+	for _, s := range stubs {
+		method := strings.ToUpper(s.Request.Method)
+		if method == "" {
+			method = db.MethodAny
+		}
+		routePath, conditions, ok := wireMockURL(s, func(format string, args ...any) { note(s, format, args...) })
+		if !ok {
+			continue
+		}
+		if s.Response.ProxyBaseURL != "" {
+			note(s, "proxying to %s is not supported; set the agent's upstream_url instead", s.Response.ProxyBaseURL)
+			continue
+		}
+
+		skip := false
+		match := func(source, key string, m wireMockMatcher) {
+			translated, problems, ok := wireMockCondition(source, key, m)
+			for _, p := range problems {
+				note(s, "%s", p)
+			}
+			skip = skip || !ok
+			conditions = append(conditions, translated...)
+		}
+		for _, name := range sortedKeys(s.Request.QueryParameters) {
+			match(db.SourceQuery, name, s.Request.QueryParameters[name])
+		}
+		for _, name := range sortedKeys(s.Request.Headers) {
+			match(db.SourceHeader, name, s.Request.Headers[name])
+		}
+		for _, m := range s.Request.BodyPatterns {
+			match(db.SourceBody, "", m)
+		}
+		if creds := s.Request.BasicAuthCredentials; creds != nil {
+			value := "Basic " + base64.StdEncoding.EncodeToString([]byte(creds.Username+":"+creds.Password))
+			conditions = append(conditions, db.Condition{Source: db.SourceHeader, Key: "Authorization", Predicate: db.Predicate{Equals: &value}})
+		}
+		if len(s.Request.Cookies) > 0 {
+			note(s, "cookie matchers are not supported")
+			skip = true
+		}
+		if len(s.Request.PathParameters) > 0 {
+			note(s, "path parameter matchers are not supported")
+			skip = true
+		}
+		if skip {
+			note(s, "stub skipped")
+			continue
+		}
+
+		key := method + " " + routePath
+		rt, ok := byKey[key]
+		if !ok {
+			rt = &wireMockRoute{method: method, path: routePath}
+			byKey[key] = rt
+			routes = append(routes, rt)
+		}
+		if s.Priority == 0 {
+			s.Priority = wireMockDefaultPriority
+		}
+		rt.stubs = append(rt.stubs, s)
+		rt.variants = append(rt.variants, db.ResponseVariant{
+			Name:         s.Name,
+			Priority:     s.Priority,
+			Conditions:   conditions,
+			MockResponse: wireMockResponse(s, files, func(format string, args ...any) { note(s, format, args...) }),
+			ScenarioStep: db.ScenarioStep{Scenario: s.ScenarioName, RequiredState: s.RequiredScenarioState, NewState: s.NewScenarioState},
+		})
+		rt.delays = append(rt.delays, wireMockDelay(s))
+		rt.throttles = append(rt.throttles, wireMockThrottle(s, rt.variants[len(rt.variants)-1].MockResponse))
+	}
+
+	paths := make([]db.AgentPath, 0, len(routes))
+	for _, rt := range routes {
+		paths = append(paths, rt.agentPath(func(s wireMockStub, format string, args ...any) { note(s, format, args...) }))
+	}
+	return paths, report
+}
+
+// agentPath turns a route's stubs into variants. The last stub in priority
+// order becomes the path's own response if it would match any request, as
+// WireMock would only reach it when nothing else matched; otherwise
+// unmatched requests get WireMock's 404.
+func (rt *wireMockRoute) agentPath(note func(s wireMockStub, format string, args ...any)) db.AgentPath {
+	p := db.AgentPath{Method: rt.method, Path: rt.path}
+
+	order := make([]int, len(rt.variants))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return rt.variants[order[i]].Priority < rt.variants[order[j]].Priority })
+
+	// Delays and throttling apply to a whole path in MI6: the first stub
+	// setting one speaks for all of them.
+	for _, i := range order {
+		if d := rt.delays[i]; d != nil {
+			if p.Delay == nil {
+				p.Delay = d
+			} else if *d != *p.Delay {
+				note(rt.stubs[i], "the delay of another stub on %s %s applies instead of this one's", rt.method, rt.path)
+			}
+		}
+		if t := rt.throttles[i]; t != nil {
+			if p.Throttle == nil {
+				p.Throttle = t
+			} else if *t != *p.Throttle {
+				note(rt.stubs[i], "the chunked dribble delay of another stub on %s %s applies instead of this one's", rt.method, rt.path)
+			}
+		}
+	}
+
+	last := rt.variants[order[len(order)-1]]
+	if len(last.Conditions) == 0 && last.RequiredState == "" {
+		p.MockResponse, p.ScenarioStep = last.MockResponse, last.ScenarioStep
+		order = order[:len(order)-1]
+	} else {
+		p.MockResponse = db.MockResponse{StatusCode: http.StatusNotFound, Headers: map[string]string{}}
+	}
+	for _, i := range order {
+		p.Variants = append(p.Variants, rt.variants[i])
+	}
+	return p
+}
+
+// wireMockURL translates a stub's URL matcher into a route pattern, plus the
+// query conditions of an exact url.
+func wireMockURL(s wireMockStub, note func(format string, args ...any)) (string, []db.Condition, bool) {
+	r := s.Request
+	switch {
+	case r.URLPathTemplate != "":
+		return r.URLPathTemplate, nil, true // Already in the {name} form routes use
+	case r.URLPath != "":
+		return r.URLPath, nil, true
+	case r.URL != "":
+		u, err := url.Parse(r.URL)
+		if err != nil {
+			note("invalid url %q; stub skipped", r.URL)
+			return "", nil, false
+		}
+		var conditions []db.Condition
+		if u.RawQuery != "" {
+			conditions = queryConditions(u.Query())
+		}
+		return routePath(u), conditions, true
+	case r.URLPathPattern != "":
+		return wireMockPattern(r.URLPathPattern, note)
+	case r.URLPattern != "":
+		if strings.Contains(r.URLPattern, `\?`) || strings.Contains(r.URLPattern, "[?]") {
+			note("urlPattern %q matches the query string, which is not supported; stub skipped", r.URLPattern)
+			return "", nil, false
+		}
+		return wireMockPattern(r.URLPattern, note)
+	}
+	return "/*", nil, true // Any URL
+}
+
+// wireMockPattern turns a path regular expression into a route pattern, one
+// segment at a time: literal segments stay, the others become {pN:regexp}
+// parameters, and a trailing catch-all becomes *.
+func wireMockPattern(pattern string, note func(format string, args ...any)) (string, []db.Condition, bool) {
+	expr := strings.TrimSuffix(strings.TrimPrefix(pattern, "^"), "$")
+	if !strings.HasPrefix(expr, "/") {
+		note("urlPathPattern %q does not start with a literal '/'; stub skipped", pattern)
+		return "", nil, false
+	}
+
+	segments := strings.Split(expr[1:], "/")
+	params := 0
+	for i, segment := range segments {
+		if i == len(segments)-1 && (segment == ".*" || segment == ".+") {
+			segments[i] = "*"
+			break
+		}
+		re, err := regexp.Compile("^" + segment + "$")
+		if err != nil {
+			note("urlPathPattern %q cannot be split into path segments: %v; stub skipped", pattern, err)
+			return "", nil, false
+		}
+		if literal, complete := re.LiteralPrefix(); complete {
+			segments[i] = literal
+			continue
+		}
+		if strings.ContainsAny(segment, "{}") {
+			note("urlPathPattern %q uses braces, which route patterns cannot hold; stub skipped", pattern)
+			return "", nil, false
+		}
+		params++
+		segments[i] = fmt.Sprintf("{p%d:%s}", params, segment)
+	}
+	return "/" + strings.Join(segments, "/"), nil, true
+}
+
+// wireMockCondition translates a value matcher into conditions. It reports
+// the parts of the matcher that were left out, or, when it cannot be
+// reproduced at all, why not.
+func wireMockCondition(source, key string, m wireMockMatcher) (conditions []db.Condition, problems []string, ok bool) {
+	where := source
+	if key != "" {
+		where += " " + key
+	}
+
+	c := db.Condition{Source: source, Key: key}
+	caseInsensitive := false
+	json.Unmarshal(m["caseInsensitive"], &caseInsensitive)
+
+	for _, op := range sortedKeys(m) {
+		raw := m[op]
+		var value string
+		switch op {
+		case "caseInsensitive", "ignoreArrayOrder", "ignoreExtraElements":
+			continue // Modifiers, handled along with their matcher
+		case "equalTo":
+			json.Unmarshal(raw, &value)
+			if caseInsensitive {
+				c.Matches = "(?i)^" + regexp.QuoteMeta(value) + "$"
+			} else {
+				c.Equals = &value
+			}
+		case "contains":
+			json.Unmarshal(raw, &value)
+			c.Contains = value
+		case "matches":
+			json.Unmarshal(raw, &value)
+			c.Matches = "^(?:" + value + ")$" // WireMock matches the whole value
+		case "absent":
+			json.Unmarshal(raw, &c.Absent)
+		case "equalToJson":
+			fields, err := jsonFieldConditions(raw)
+			if err != nil {
+				return nil, []string{fmt.Sprintf("%s equalToJson: %v", where, err)}, false
+			}
+			conditions = append(conditions, fields...)
+			var ignoreExtra bool
+			json.Unmarshal(m["ignoreExtraElements"], &ignoreExtra)
+			if !ignoreExtra {
+				problems = append(problems, fmt.Sprintf("%s equalToJson is matched field by field; extra fields are not rejected", where))
+			}
+		case "matchesJsonPath":
+			var expr struct {
+				Expression string `json:"expression"`
+			}
+			if json.Unmarshal(raw, &value) == nil {
+				c.Key = value
+			} else if json.Unmarshal(raw, &expr) == nil {
+				var sub wireMockMatcher
+				json.Unmarshal(raw, &sub)
+				delete(sub, "expression")
+				nested, nestedProblems, ok := wireMockCondition(source, expr.Expression, sub)
+				if !ok {
+					return nil, nestedProblems, false
+				}
+				problems = append(problems, nestedProblems...)
+				conditions = append(conditions, nested...)
+			}
+		default:
+			return nil, []string{fmt.Sprintf("%s matcher %q is not supported", where, op)}, false
+		}
+	}
+
+	if c.Equals != nil || c.Contains != "" || c.Matches != "" || c.Absent || (source == db.SourceBody && c.Key != "") {
+		conditions = append(conditions, c)
+	}
+	for _, c := range conditions {
+		if err := agent.ValidateCondition(c); err != nil {
+			return nil, []string{fmt.Sprintf("%s: %v", where, err)}, false
+		}
+	}
+	return conditions, problems, true
+}
+
+// jsonFieldConditions matches every scalar field of a JSON document by its
+// JSONPath, e.g. $.order.items[0].sku.
+func jsonFieldConditions(raw json.RawMessage) ([]db.Condition, error) {
+	var doc any
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	if s, ok := doc.(string); ok {
+		if err := json.Unmarshal([]byte(s), &doc); err != nil { // JSON given as a string
+			return nil, err
+		}
+	}
+
+	var conditions []db.Condition
+	var walk func(expr string, v any)
+	walk = func(expr string, v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			for _, k := range sortedKeys(v) {
+				walk(expr+jsonPathKey(k), v[k])
+			}
+			if len(v) > 0 {
+				return
+			}
+		case []any:
+			for i, e := range v {
+				walk(fmt.Sprintf("%s[%d]", expr, i), e)
+			}
+			if len(v) > 0 {
+				return
+			}
+		}
+		var value string
+		if s, ok := v.(string); ok {
+			value = s
+		} else {
+			b, _ := json.Marshal(v) // As the body lookup renders non-strings
+			value = string(b)
+		}
+		conditions = append(conditions, db.Condition{Source: db.SourceBody, Key: expr, Predicate: db.Predicate{Equals: &value}})
+	}
+	walk("$", doc)
+	return conditions, nil
+}
+
+var jsonPathIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+func jsonPathKey(k string) string {
+	if jsonPathIdentifier.MatchString(k) {
+		return "." + k
+	}
+	return "['" + strings.ReplaceAll(k, "'", `\'`) + "']"
+}
+
+func wireMockResponse(s wireMockStub, files fs.FS, note func(format string, args ...any)) db.MockResponse {
+	r := s.Response
+	m := db.MockResponse{StatusCode: r.Status, Headers: map[string]string{}}
+	for _, name := range sortedKeys(r.Headers) {
+		var value string
+		var values []string
+		if json.Unmarshal(r.Headers[name], &value) != nil && json.Unmarshal(r.Headers[name], &values) == nil {
+			value = strings.Join(values, ", ")
+		}
+		m.Headers[name] = value
+	}
+
+	switch {
+	case len(r.JSONBody) > 0:
+		m.Response = string(r.JSONBody)
+	case r.Base64Body != "":
+		m.Response, m.Encoding = r.Base64Body, db.EncodingBase64
+	case r.BodyFileName != "":
+		data, err := readBodyFile(files, r.BodyFileName)
+		if err != nil {
+			note("body file %s: %v", r.BodyFileName, err)
+			break
+		}
+		m.Response = string(data)
+		if !utf8.Valid(data) {
+			m.Response, m.Encoding = base64.StdEncoding.EncodeToString(data), db.EncodingBase64
+		}
+	default:
+		m.Response = r.Body
+	}
+
+	if r.Fault != "" {
+		if fault, ok := wireMockFaults[r.Fault]; ok {
+			m.Fault = &db.Fault{Type: fault}
+		} else {
+			note("fault %s is not supported", r.Fault)
+		}
+	}
+	for _, t := range r.Transformers {
+		if t == "response-template" {
+			note("response templates are served as is; rewrite them as Go templates and set templated")
+		} else {
+			note("transformer %s is not supported", t)
+		}
+	}
+	return m
+}
+
+// readBodyFile reads a file from __files, whose name is relative to it.
+func readBodyFile(files fs.FS, name string) ([]byte, error) {
+	if files == nil {
+		return nil, errors.New("no __files directory to read it from")
+	}
+	if strings.Contains(name, "{{") {
+		return nil, errors.New("templated file names are not supported")
+	}
+	return fs.ReadFile(files, path.Clean(strings.TrimPrefix(name, "/")))
+}
+
+func wireMockDelay(s wireMockStub) *db.Delay {
+	r := s.Response
+	if d := r.DelayDistribution; d != nil {
+		switch d.Type {
+		case "lognormal":
+			return &db.Delay{Distribution: db.DelayLogNormal, MedianMs: int(d.Median), Sigma: d.Sigma}
+		case "uniform":
+			return &db.Delay{Distribution: db.DelayUniform, MinMs: d.Lower, MaxMs: d.Upper}
+		}
+	}
+	if r.FixedDelayMilliseconds > 0 {
+		return &db.Delay{Distribution: db.DelayFixed, FixedMs: r.FixedDelayMilliseconds}
+	}
+	return nil
+}
+
+// wireMockThrottle spreads the body over the chunks of a chunked dribble
+// delay, pausing between them.
+func wireMockThrottle(s wireMockStub, m db.MockResponse) *db.Throttle {
+	d := s.Response.ChunkedDribbleDelay
+	if d == nil || d.NumberOfChunks < 1 {
+		return nil
+	}
+	size := len(m.Response)
+	if m.Encoding == db.EncodingBase64 {
+		size = base64.StdEncoding.DecodedLen(size)
+	}
+	chunk := (size + d.NumberOfChunks - 1) / d.NumberOfChunks
+	return &db.Throttle{ChunkSize: max(chunk, 1), ChunkDelayMs: d.TotalDuration / d.NumberOfChunks}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// WireMock creates an agent from the stub mappings of a WireMock root
+// directory or archive. See WireMockPaths.
+func WireMock(ctx context.Context, repo db.AgentRepository, a *db.Agent, fsys fs.FS) (*Result, error) {
+	paths, report, err := WireMockPaths(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return createReported(ctx, repo, a, paths, report)
+}
+
+// WireMockStubs creates an agent from stub mappings given as one JSON document.
+func WireMockStubs(ctx context.Context, repo db.AgentRepository, a *db.Agent, data []byte) (*Result, error) {
+	paths, report, err := WireMockStubPaths(data)
+	if err != nil {
+		return nil, err
+	}
+	return createReported(ctx, repo, a, paths, report)
+}
+
+// createReported creates an agent, attaching the report of what the import
+// could not translate.
+func createReported(ctx context.Context, repo db.AgentRepository, a *db.Agent, paths []db.AgentPath, report []string) (*Result, error) {
+	result, err := CreateAgent(ctx, repo, a, paths)
+	if err != nil {
+		return nil, err
+	}
+	result.Unsupported = report
+	return result, nil
+}
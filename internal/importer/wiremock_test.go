@@ -0,0 +1,246 @@
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"mi6/internal/db"
+)
+
+// describe summarizes conditions, e.g. "header Accept equals json".
+func describe(conditions []db.Condition) string {
+	var out []string
+	for _, c := range conditions {
+		s := c.Source
+		if c.Key != "" {
+			s += " " + c.Key
+		}
+		switch {
+		case c.Equals != nil:
+			s += " equals " + *c.Equals
+		case c.Contains != "":
+			s += " contains " + c.Contains
+		case c.Matches != "":
+			s += " matches " + c.Matches
+		case c.Absent:
+			s += " absent"
+		}
+		out = append(out, s)
+	}
+	return strings.Join(out, "; ")
+}
+
+func TestWireMockCondition(t *testing.T) {
+	tests := []struct {
+		name        string
+		source, key string
+		matcher     string
+		want        string
+		wantProblem string // Substring of the single problem reported, if any
+		wantSkip    bool
+	}{
+		{"equalTo", db.SourceQuery, "page", `{"equalTo": "2"}`, "query page equals 2", "", false},
+		{"case insensitive", db.SourceHeader, "Accept", `{"equalTo": "a.b", "caseInsensitive": true}`, `header Accept matches (?i)^a\.b$`, "", false},
+		{"contains", db.SourceHeader, "Accept", `{"contains": "json"}`, "header Accept contains json", "", false},
+		{"matches", db.SourceQuery, "id", `{"matches": "[0-9]+"}`, "query id matches ^(?:[0-9]+)$", "", false},
+		{"absent", db.SourceHeader, "X-Debug", `{"absent": true}`, "header X-Debug absent", "", false},
+		{
+			"equalToJson ignoring extra elements", db.SourceBody, "",
+			`{"equalToJson": {"order": {"id": 1}, "tags": ["new"]}, "ignoreExtraElements": true}`,
+			"body $.order.id equals 1; body $.tags[0] equals new", "", false,
+		},
+		{
+			"equalToJson as a string", db.SourceBody, "",
+			`{"equalToJson": "{\"odd key\": true}"}`,
+			"body $['odd key'] equals true", "extra fields are not rejected", false,
+		},
+		{"matchesJsonPath presence", db.SourceBody, "", `{"matchesJsonPath": "$.id"}`, "body $.id", "", false},
+		{
+			"matchesJsonPath with a matcher", db.SourceBody, "",
+			`{"matchesJsonPath": {"expression": "$.status", "equalTo": "paid"}}`,
+			"body $.status equals paid", "", false,
+		},
+		{"unsupported matcher", db.SourceQuery, "q", `{"doesNotMatch": "x"}`, "", `matcher "doesNotMatch" is not supported`, true},
+		{"invalid regexp", db.SourceQuery, "q", `{"matches": "("}`, "", "query q", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m wireMockMatcher
+			if err := json.Unmarshal([]byte(tt.matcher), &m); err != nil {
+				t.Fatal(err)
+			}
+			conditions, problems, ok := wireMockCondition(tt.source, tt.key, m)
+			if ok == tt.wantSkip {
+				t.Fatalf("got ok %v, want %v (problems %q)", ok, !tt.wantSkip, problems)
+			}
+			if got := describe(conditions); got != tt.want {
+				t.Errorf("got conditions %q, want %q", got, tt.want)
+			}
+			switch {
+			case tt.wantProblem == "" && len(problems) > 0:
+				t.Errorf("unexpected problems %q", problems)
+			case tt.wantProblem != "" && (len(problems) != 1 || !strings.Contains(problems[0], tt.wantProblem)):
+				t.Errorf("got problems %q, want one mentioning %q", problems, tt.wantProblem)
+			}
+		})
+	}
+}
+
+func TestWireMockURL(t *testing.T) {
+	tests := []struct {
+		request  string
+		want     string
+		wantCond string
+		wantSkip bool
+	}{
+		{`{"urlPathTemplate": "/users/{id}"}`, "/users/{id}", "", false},
+		{`{"urlPath": "/users"}`, "/users", "", false},
+		{`{"url": "/users?page=2&sort=name"}`, "/users", "query page equals 2; query sort equals name", false},
+		{`{"url": "/files/a%20b?v=2"}`, "/files/a b", "query v equals 2", false},
+		{`{"url": "/docs/a%2Fb"}`, "/docs/a%2Fb", "", false},
+		{`{"urlPathPattern": "/users/[0-9]+/orders"}`, "/users/{p1:[0-9]+}/orders", "", false},
+		{`{"urlPattern": "^/files/.*$"}`, "/files/*", "", false},
+		{`{"urlPattern": "/search\\?q=.*"}`, "", "", true},
+		{`{"urlPathPattern": "users/.*"}`, "", "", true},
+		{`{"urlPathPattern": "/codes/[a-z]{3}"}`, "", "", true},
+		{`{}`, "/*", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.request, func(t *testing.T) {
+			var s wireMockStub
+			if err := json.Unmarshal([]byte(`{"request": `+tt.request+`}`), &s); err != nil {
+				t.Fatal(err)
+			}
+			var notes []string
+			path, conditions, ok := wireMockURL(s, func(format string, args ...any) { notes = append(notes, fmt.Sprintf(format, args...)) })
+			if ok == tt.wantSkip {
+				t.Fatalf("got ok %v, want %v", ok, !tt.wantSkip)
+			}
+			if tt.wantSkip {
+				if len(notes) != 1 || !strings.Contains(notes[0], "stub skipped") {
+					t.Errorf("got notes %q, want the skip explained", notes)
+				}
+				return
+			}
+			if path != tt.want || describe(conditions) != tt.wantCond {
+				t.Errorf("got %q with %q, want %q with %q", path, describe(conditions), tt.want, tt.wantCond)
+			}
+		})
+	}
+}
+
+func TestWireMockPaths(t *testing.T) {
+	fsys := fstest.MapFS{
+		"wiremock/mappings/orders.json": {Data: []byte(`{"mappings": [
+			{"name": "paid", "priority": 1,
+			 "request": {"method": "GET", "urlPath": "/orders", "queryParameters": {"status": {"equalTo": "paid"}}},
+			 "response": {"status": 200, "bodyFileName": "paid.json", "headers": {"Content-Type": "application/json"}}},
+			{"request": {"method": "GET", "urlPath": "/orders"},
+			 "response": {"status": 200, "jsonBody": [], "fixedDelayMilliseconds": 50}},
+			{"request": {"method": "GET", "urlPath": "/orders", "cookies": {"session": {"equalTo": "x"}}},
+			 "response": {"status": 401}}
+		]}`)},
+		"wiremock/mappings/admin/login.json": {Data: []byte(`{
+			"scenarioName": "login", "requiredScenarioState": "Started", "newScenarioState": "in",
+			"request": {"method": "POST", "url": "/login", "basicAuthCredentials": {"username": "ada", "password": "pw"}},
+			"response": {"status": 204, "fault": "CONNECTION_RESET_BY_PEER", "transformers": ["response-template"],
+			             "headers": {"Vary": ["Accept", "Origin"]}}
+		}`)},
+		"wiremock/mappings/proxy.json": {Data: []byte(`{"request": {"urlPath": "/legacy"}, "response": {"proxyBaseUrl": "http://old"}}`)},
+		"wiremock/mappings/notes.txt":  {Data: []byte("not a mapping")},
+		"wiremock/__files/paid.json":   {Data: []byte(`["paid"]`)},
+	}
+
+	paths, report, err := WireMockPaths(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byRoute := map[string]db.AgentPath{}
+	for _, p := range paths {
+		byRoute[p.Method+" "+p.Path] = p
+	}
+	if len(paths) != 2 {
+		t.Fatalf("got %d paths, want 2: %+v", len(paths), paths)
+	}
+
+	orders := byRoute["GET /orders"]
+	if orders.Response != "[]" || orders.Delay == nil || orders.Delay.FixedMs != 50 {
+		t.Errorf("GET /orders falls back to %q with delay %+v, want [] after 50ms", orders.Response, orders.Delay)
+	}
+	if len(orders.Variants) != 1 || orders.Variants[0].Response != `["paid"]` || describe(orders.Variants[0].Conditions) != "query status equals paid" {
+		t.Errorf("got variants %+v, want the paid variant read from __files", orders.Variants)
+	}
+
+	login := byRoute["POST /login"]
+	if len(login.Variants) != 1 || login.StatusCode != 404 {
+		t.Fatalf("POST /login: got %d variants and fallback %d, want the stub as a variant and a 404", len(login.Variants), login.StatusCode)
+	}
+	v := login.Variants[0]
+	if describe(v.Conditions) != "header Authorization equals Basic YWRhOnB3" {
+		t.Errorf("got conditions %q, want basic auth", describe(v.Conditions))
+	}
+	if v.Scenario != "login" || v.RequiredState != "Started" || v.NewState != "in" {
+		t.Errorf("got scenario step %+v", v.ScenarioStep)
+	}
+	if v.Fault == nil || v.Fault.Type != db.FaultConnectionReset || v.Headers["Vary"] != "Accept, Origin" {
+		t.Errorf("got fault %+v and headers %v", v.Fault, v.Headers)
+	}
+
+	for _, want := range []string{
+		"orders.json #3: cookie matchers are not supported",
+		"orders.json #3: stub skipped",
+		"login.json: response templates are served as is",
+		"proxy.json: proxying to http://old is not supported",
+	} {
+		if !strings.Contains(strings.Join(report, "\n"), want) {
+			t.Errorf("report lacks %q:\n%s", want, strings.Join(report, "\n"))
+		}
+	}
+}
+
+func TestWireMockServesEscapedURLs(t *testing.T) {
+	repo := newTestRepository(t)
+	port := freePort(t)
+	data := []byte(`{"mappings": [
+		{"request": {"method": "GET", "url": "/files/a%20b"}, "response": {"status": 200, "body": "space"}},
+		{"request": {"method": "GET", "url": "/caf%C3%A9?lang=fr"}, "response": {"status": 200, "body": "accent"}}
+	]}`)
+
+	result, err := WireMockStubs(context.Background(), repo, &db.Agent{Name: "escaped", Port: port}, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serve(t, repo, result)
+
+	for rawPath, want := range map[string]string{"/files/a%20b": "space", "/caf%C3%A9?lang=fr": "accent"} {
+		if status, body := get(t, port, rawPath); status != http.StatusOK || body != want {
+			t.Errorf("GET %s: got %d %q, want 200 %q", rawPath, status, body, want)
+		}
+	}
+}
+
+func TestWireMockStubsImport(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepository(t)
+	data := []byte(`{"mappings": [
+		{"request": {"method": "GET", "urlPath": "/ping"}, "response": {"status": 200, "body": "pong"}},
+		{"request": {"method": "GET", "urlPath": "/ping"}, "response": {"status": 200, "bodyFileName": "pong.txt"}}
+	]}`)
+
+	result, err := WireMockStubs(ctx, repo, &db.Agent{Name: "stubs", Port: "18086"}, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Paths) != 1 || len(result.Unsupported) != 1 || !strings.Contains(result.Unsupported[0], "no __files directory") {
+		t.Errorf("got %d paths and unsupported %q, want 1 path and the missing body file", len(result.Paths), result.Unsupported)
+	}
+
+	if _, _, err := WireMockPaths(fstest.MapFS{"mappings/README.md": {Data: []byte("#")}}); err == nil {
+		t.Error("expected a directory without mappings to be rejected")
+	}
+}
@@ -0,0 +1,283 @@
+// Package openapi turns OpenAPI 3 and Swagger 2 specifications into mock paths.
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"mi6/internal/db"
+)
+
+// Spec is a parsed specification. Both JSON and YAML documents are accepted.
+type Spec struct {
+	Title   string
+	Version string // "2.0" for Swagger, "3.x.y" for OpenAPI
+	doc     map[string]any
+}
+
+// Parse reads an OpenAPI 3 or Swagger 2 document.
+func Parse(data []byte) (*Spec, error) {
+	var raw any
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid specification: %w", err)
+	}
+	doc, ok := normalize(raw).(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid specification: not an object")
+	}
+
+	s := &Spec{doc: doc}
+	if v, ok := doc["openapi"].(string); ok && strings.HasPrefix(v, "3.") {
+		s.Version = v
+	} else if v, ok := doc["swagger"].(string); ok && v == "2.0" {
+		s.Version = v
+	} else {
+		return nil, fmt.Errorf("unsupported specification: expected openapi 3.x or swagger 2.0")
+	}
+	if info, ok := doc["info"].(map[string]any); ok {
+		s.Title, _ = info["title"].(string)
+	}
+	return s, nil
+}
+
+// normalize converts what YAML decodes into plain JSON values: maps with
+// non-string keys, such as unquoted status codes, get string keys.
+func normalize(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			v[k] = normalize(e)
+		}
+		return v
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = normalize(e)
+		}
+		return m
+	case []any:
+		for i, e := range v {
+			v[i] = normalize(e)
+		}
+		return v
+	}
+	return v
+}
+
+func (s *Spec) swagger() bool { return s.Version == "2.0" }
+
+// operationMethods are the operations of a path item, in the order paths are created.
+var operationMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// Paths returns one mock path per operation of the specification, answering
+// with the operation's first 2xx response.
+func (s *Spec) Paths() ([]db.AgentPath, error) {
+	items, _ := s.doc["paths"].(map[string]any)
+	if len(items) == 0 {
+		return nil, fmt.Errorf("specification has no paths")
+	}
+	base := s.basePath()
+
+	templates := make([]string, 0, len(items))
+	for template := range items {
+		templates = append(templates, template)
+	}
+	sort.Strings(templates)
+
+	var paths []db.AgentPath
+	for _, template := range templates {
+		item, _ := s.resolve(items[template]).(map[string]any)
+		for _, method := range operationMethods {
+			op, ok := item[method].(map[string]any)
+			if !ok {
+				continue
+			}
+			p := db.AgentPath{
+				Method: strings.ToUpper(method),
+				Path:   chiPattern(base + template),
+			}
+			p.MockResponse = s.response(op)
+			paths = append(paths, p)
+		}
+	}
+	return paths, nil
+}
+
+// basePath is the path prefix every operation is served under: Swagger's
+// basePath, or the path of OpenAPI's first server when it has no variables.
+func (s *Spec) basePath() string {
+	var base string
+	if s.swagger() {
+		base, _ = s.doc["basePath"].(string)
+	} else if servers, ok := s.doc["servers"].([]any); ok && len(servers) > 0 {
+		server, _ := servers[0].(map[string]any)
+		if raw, ok := server["url"].(string); ok && !strings.Contains(raw, "{") {
+			if u, err := url.Parse(raw); err == nil {
+				base = u.Path
+			}
+		}
+	}
+	return strings.TrimSuffix(base, "/")
+}
+
+var templateParam = regexp.MustCompile(`\{([^}]*)\}`)
+var unsafeParamChars = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// chiPattern converts an OpenAPI path template into a chi pattern. The
+// {param} syntax is shared, but chi reserves ':' in parameter names for
+// regular expressions, so names are reduced to word characters.
+func chiPattern(template string) string {
+	return templateParam.ReplaceAllStringFunc(template, func(m string) string {
+		name := unsafeParamChars.ReplaceAllString(m[1:len(m)-1], "_")
+		return "{" + name + "}"
+	})
+}
+
+// response builds the mock response for an operation from its first 2xx
+// response, falling back to the default response and then to an empty 200.
+func (s *Spec) response(op map[string]any) db.MockResponse {
+	responses, _ := op["responses"].(map[string]any)
+	code, resp := successResponse(responses)
+	resp = s.resolveMap(resp)
+
+	m := db.MockResponse{StatusCode: code}
+	contentType, body, ok := s.example(op, resp)
+	if !ok {
+		return m
+	}
+	m.Headers = map[string]string{"Content-Type": contentType}
+	if text, isText := body.(string); isText && !isJSON(contentType) {
+		m.Response = text
+		return m
+	}
+	encoded, err := json.MarshalIndent(body, "", "  ")
+	if err == nil {
+		m.Response = string(encoded)
+	}
+	return m
+}
+
+// successResponse picks the lowest 2xx status code, including wildcards such as "2XX".
+func successResponse(responses map[string]any) (int, map[string]any) {
+	codes := make([]string, 0, len(responses))
+	for code := range responses {
+		if strings.HasPrefix(code, "2") && len(code) == 3 {
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes)
+	if len(codes) > 0 {
+		resp, _ := responses[codes[0]].(map[string]any)
+		status, err := strconv.Atoi(codes[0])
+		if err != nil {
+			status = http.StatusOK // "2XX"
+		}
+		return status, resp
+	}
+
+	resp, _ := responses["default"].(map[string]any)
+	return http.StatusOK, resp
+}
+
+// example finds the body of a response: an explicit example if there is one,
+// or one generated from the schema. It prefers JSON media types.
+func (s *Spec) example(op, resp map[string]any) (contentType string, body any, ok bool) {
+	if s.swagger() {
+		return s.swaggerExample(op, resp)
+	}
+
+	content, _ := resp["content"].(map[string]any)
+	contentType = preferredMediaType(keys(content))
+	if contentType == "" {
+		return "", nil, false
+	}
+	media := s.resolveMap(asMap(content[contentType]))
+
+	if example, ok := media["example"]; ok {
+		return contentType, example, true
+	}
+	if examples, ok := media["examples"].(map[string]any); ok && len(examples) > 0 {
+		first := s.resolveMap(asMap(examples[keys(examples)[0]]))
+		if value, ok := first["value"]; ok {
+			return contentType, value, true
+		}
+	}
+	if schema, ok := media["schema"]; ok {
+		return contentType, s.generate(schema), true
+	}
+	return contentType, nil, false
+}
+
+func (s *Spec) swaggerExample(op, resp map[string]any) (string, any, bool) {
+	if examples, ok := resp["examples"].(map[string]any); ok && len(examples) > 0 {
+		contentType := preferredMediaType(keys(examples))
+		return contentType, examples[contentType], true
+	}
+
+	schema, ok := resp["schema"]
+	if !ok {
+		return "", nil, false
+	}
+	produces, _ := op["produces"].([]any)
+	if len(produces) == 0 {
+		produces, _ = s.doc["produces"].([]any)
+	}
+	var mediaTypes []string
+	for _, p := range produces {
+		if mt, ok := p.(string); ok {
+			mediaTypes = append(mediaTypes, mt)
+		}
+	}
+	contentType := preferredMediaType(mediaTypes)
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	return contentType, s.generate(schema), true
+}
+
+// preferredMediaType picks application/json, then any other JSON type, then
+// the first type in alphabetical order.
+func preferredMediaType(types []string) string {
+	sort.Strings(types)
+	for _, t := range types {
+		if t == "application/json" {
+			return t
+		}
+	}
+	for _, t := range types {
+		if isJSON(t) {
+			return t
+		}
+	}
+	if len(types) > 0 {
+		return types[0]
+	}
+	return ""
+}
+
+func isJSON(mediaType string) bool {
+	return strings.Contains(mediaType, "json")
+}
+
+// keys returns a map's keys in sorted order, so imports are deterministic.
+func keys(m map[string]any) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func asMap(v any) map[string]any {
+	m, _ := v.(map[string]any)
+	return m
+}
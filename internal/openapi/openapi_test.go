@@ -0,0 +1,156 @@
+package openapi
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPaths(t *testing.T) {
+	type want struct {
+		method, path string
+		status       int
+		contentType  string
+		body         string // Compared as JSON when the content type is JSON
+	}
+	tests := []struct {
+		name string
+		spec string
+		want []want
+	}{
+		{
+			name: "OpenAPI 3 with a server path and examples",
+			spec: `
+openapi: 3.0.3
+info: {title: Users, version: "1"}
+servers: [{url: "https://api.example.com/v1/"}]
+paths:
+  /users/{user-id}:
+    get:
+      responses:
+        "404": {description: missing}
+        "200":
+          description: ok
+          content:
+            text/plain: {example: "ada"}
+            application/json: {example: {id: 1, name: ada}}
+    delete:
+      responses:
+        "204": {description: gone}
+`,
+			want: []want{
+				{"GET", "/v1/users/{user_id}", 200, "application/json", `{"id":1,"name":"ada"}`},
+				{"DELETE", "/v1/users/{user_id}", 204, "", ""},
+			},
+		},
+		{
+			name: "OpenAPI 3 schema and server variables",
+			spec: `
+openapi: 3.1.0
+info: {title: Orders, version: "1"}
+servers: [{url: "https://{region}.example.com/api"}]
+paths:
+  /orders:
+    post:
+      responses:
+        "2XX":
+          description: created
+          content:
+            application/json:
+              schema: {$ref: "#/components/schemas/Order"}
+components:
+  schemas:
+    Order:
+      type: object
+      properties:
+        id: {type: integer, example: 42}
+`,
+			want: []want{
+				{"POST", "/orders", 200, "application/json", `{"id":42}`},
+			},
+		},
+		{
+			name: "Swagger 2 with a base path",
+			spec: `{
+  "swagger": "2.0",
+  "info": {"title": "Pets", "version": "1"},
+  "basePath": "/pets-api",
+  "produces": ["application/json"],
+  "paths": {
+    "/pets/{id}": {
+      "get": {
+        "responses": {
+          "200": {"description": "ok", "examples": {"application/json": {"name": "rex"}}}
+        }
+      }
+    }
+  }
+}`,
+			want: []want{
+				{"GET", "/pets-api/pets/{id}", 200, "application/json", `{"name":"rex"}`},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse([]byte(tt.spec))
+			if err != nil {
+				t.Fatal(err)
+			}
+			paths, err := s.Paths()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(paths) != len(tt.want) {
+				t.Fatalf("got %d paths, want %d: %+v", len(paths), len(tt.want), paths)
+			}
+			for i, w := range tt.want {
+				p := paths[i]
+				if p.Method != w.method || p.Path != w.path || p.StatusCode != w.status || p.Headers["Content-Type"] != w.contentType {
+					t.Errorf("path %d: got %s %s %d %q, want %s %s %d %q",
+						i, p.Method, p.Path, p.StatusCode, p.Headers["Content-Type"], w.method, w.path, w.status, w.contentType)
+				}
+				if !sameJSON(p.Response, w.body) {
+					t.Errorf("path %d: got body %s, want %s", i, p.Response, w.body)
+				}
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := map[string]string{
+		"not a document":  "just text",
+		"no version":      `{"info": {"title": "x"}, "paths": {}}`,
+		"unknown version": `{"openapi": "4.0.0", "paths": {}}`,
+	}
+	for name, spec := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Parse([]byte(spec)); err == nil {
+				t.Error("expected a parse error")
+			}
+		})
+	}
+}
+
+func TestPathsWithoutOperations(t *testing.T) {
+	s, err := Parse([]byte(`{"openapi": "3.0.0", "info": {"title": "x"}, "paths": {}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Paths(); err == nil {
+		t.Error("expected an error for a specification without paths")
+	}
+}
+
+func sameJSON(a, b string) bool {
+	if a == b {
+		return true
+	}
+	var va, vb any
+	if json.Unmarshal([]byte(a), &va) != nil || json.Unmarshal([]byte(b), &vb) != nil {
+		return false
+	}
+	ja, _ := json.Marshal(va)
+	jb, _ := json.Marshal(vb)
+	return string(ja) == string(jb)
+}
@@ -0,0 +1,179 @@
+package openapi
+
+import (
+	"slices"
+	"strings"
+)
+
+// maxDepth bounds how many $refs are followed in a row.
+const maxDepth = 8
+
+// resolve follows a local $ref such as "#/components/schemas/User". Refs to
+// other documents are not followed and resolve to nothing.
+func (s *Spec) resolve(v any) any {
+	for range maxDepth {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return v
+		}
+		ref, ok := m["$ref"].(string)
+		if !ok {
+			return v
+		}
+		v = s.lookup(ref)
+	}
+	return nil
+}
+
+func (s *Spec) resolveMap(m map[string]any) map[string]any {
+	resolved, _ := s.resolve(m).(map[string]any)
+	return resolved
+}
+
+// lookup evaluates a JSON pointer within the document.
+func (s *Spec) lookup(ref string) any {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil
+	}
+	var v any = s.doc
+	for _, token := range strings.Split(ref[2:], "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[token]
+	}
+	return v
+}
+
+// generate builds an example value that satisfies a schema, using the
+// schema's own example, default or enum values wherever they are given.
+func (s *Spec) generate(schema any) any {
+	v, _ := s.generateValue(schema, nil)
+	return v
+}
+
+// generateValue does the work of generate. refs holds the $refs being
+// expanded; a schema that refers back to one of them is left out, reported
+// by ok being false, so recursive schemas yield finite examples.
+func (s *Spec) generateValue(schema any, refs []string) (v any, ok bool) {
+	if ref, isRef := asMap(schema)["$ref"].(string); isRef {
+		if slices.Contains(refs, ref) || len(refs) >= maxDepth {
+			return nil, false
+		}
+		refs = append(refs, ref)
+	}
+	sc := s.resolveMap(asMap(schema))
+	if sc == nil {
+		return nil, true
+	}
+
+	if example, ok := sc["example"]; ok {
+		return example, true
+	}
+	if examples, ok := sc["examples"].([]any); ok && len(examples) > 0 {
+		return examples[0], true
+	}
+	if def, ok := sc["default"]; ok {
+		return def, true
+	}
+	if enum, ok := sc["enum"].([]any); ok && len(enum) > 0 {
+		return enum[0], true
+	}
+
+	if all, ok := sc["allOf"].([]any); ok {
+		merged := map[string]any{}
+		for _, part := range all {
+			value, _ := s.generateValue(part, refs)
+			for k, v := range asMap(value) {
+				merged[k] = v
+			}
+		}
+		return merged, true
+	}
+	for _, choice := range []string{"oneOf", "anyOf"} {
+		if options, ok := sc[choice].([]any); ok && len(options) > 0 {
+			return s.generateValue(options[0], refs)
+		}
+	}
+
+	switch schemaType(sc) {
+	case "object":
+		obj := map[string]any{}
+		props, _ := sc["properties"].(map[string]any)
+		for name, prop := range props {
+			if value, ok := s.generateValue(prop, refs); ok {
+				obj[name] = value
+			}
+		}
+		return obj, true
+	case "array":
+		if item, ok := s.generateValue(sc["items"], refs); ok {
+			return []any{item}, true
+		}
+		return []any{}, true
+	case "string":
+		return exampleString(sc), true
+	case "integer":
+		return numberOr(sc["minimum"], 0), true
+	case "number":
+		return numberOr(sc["minimum"], 0.0), true
+	case "boolean":
+		return true, true
+	}
+	return nil, true
+}
+
+// schemaType reads the schema's type, which OpenAPI 3.1 allows to be a list,
+// and infers "object" from the presence of properties.
+func schemaType(sc map[string]any) string {
+	switch t := sc["type"].(type) {
+	case string:
+		return t
+	case []any:
+		for _, e := range t {
+			if name, ok := e.(string); ok && name != "null" {
+				return name
+			}
+		}
+	}
+	if _, ok := sc["properties"]; ok {
+		return "object"
+	}
+	return ""
+}
+
+func exampleString(sc map[string]any) string {
+	format, _ := sc["format"].(string)
+	switch format {
+	case "date-time":
+		return "2024-01-01T00:00:00Z"
+	case "date":
+		return "2024-01-01"
+	case "time":
+		return "00:00:00"
+	case "uuid":
+		return "3fa85f64-5717-4562-b3fc-2c963f66afa6"
+	case "email":
+		return "user@example.com"
+	case "uri", "url":
+		return "https://example.com"
+	case "hostname":
+		return "example.com"
+	case "ipv4":
+		return "192.0.2.1"
+	case "ipv6":
+		return "2001:db8::1"
+	case "byte":
+		return "c3RyaW5n"
+	}
+	return "string"
+}
+
+func numberOr(v any, fallback any) any {
+	if v != nil {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,488 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxCheckDepth bounds how deeply values and schemas are walked while validating.
+const maxCheckDepth = 64
+
+// Validator checks requests against the operations of a spec.
+type Validator struct {
+	spec       *Spec
+	operations []operation // Most specific templates first
+}
+
+// operation is a spec operation together with the pattern matching its path.
+type operation struct {
+	method   string
+	template string
+	pattern  *regexp.Regexp
+	params   []string // Path parameter names, in the order of the pattern's groups
+	item, op map[string]any
+}
+
+// Validator prepares the spec for validating requests.
+func (s *Spec) Validator() *Validator {
+	v := &Validator{spec: s}
+	base := s.basePath()
+	items, _ := s.doc["paths"].(map[string]any)
+	for template, raw := range items {
+		item, _ := s.resolve(raw).(map[string]any)
+		pattern, params := templatePattern(base + template)
+		for _, method := range operationMethods {
+			if op, ok := item[method].(map[string]any); ok {
+				v.operations = append(v.operations, operation{
+					method: strings.ToUpper(method), template: base + template,
+					pattern: pattern, params: params, item: item, op: op,
+				})
+			}
+		}
+	}
+
+	// Literal segments win over parameters, e.g. /pets/mine over /pets/{id}.
+	sort.SliceStable(v.operations, func(i, j int) bool {
+		a, b := v.operations[i], v.operations[j]
+		if len(a.params) != len(b.params) {
+			return len(a.params) < len(b.params)
+		}
+		return a.template < b.template
+	})
+	return v
+}
+
+// templatePattern compiles a path template into a regular expression with one
+// group per parameter.
+func templatePattern(template string) (*regexp.Regexp, []string) {
+	var expr strings.Builder
+	var params []string
+	rest := template
+	for {
+		m := templateParam.FindStringSubmatchIndex(rest)
+		if m == nil {
+			break
+		}
+		expr.WriteString(regexp.QuoteMeta(rest[:m[0]]))
+		expr.WriteString("([^/]+)")
+		params = append(params, rest[m[2]:m[3]])
+		rest = rest[m[1]:]
+	}
+	expr.WriteString(regexp.QuoteMeta(rest))
+	return regexp.MustCompile("^" + expr.String() + "/?$"), params
+}
+
+// Validate returns every way the request violates the spec, or nothing when it
+// conforms or its path is not in the spec. The request body is read and
+// restored for later handlers.
+func (v *Validator) Validate(r *http.Request) []string {
+	var match *operation
+	var values []string
+	allowed := false
+	for i := range v.operations {
+		o := &v.operations[i]
+		groups := o.pattern.FindStringSubmatch(r.URL.Path)
+		if groups == nil {
+			continue
+		}
+		allowed = true
+		if o.method == r.Method {
+			match, values = o, groups[1:]
+			break
+		}
+	}
+	switch {
+	case match == nil && allowed:
+		return []string{fmt.Sprintf("method %s is not allowed for %s", r.Method, r.URL.Path)}
+	case match == nil:
+		return nil // Paths the spec does not describe, such as /health, are not checked
+	}
+
+	var violations []string
+	var bodyParam map[string]any
+	for _, p := range v.parameters(match) {
+		in, _ := p["in"].(string)
+		name, _ := p["name"].(string)
+		required, _ := p["required"].(bool)
+		schema := v.paramSchema(p)
+
+		var raw []string
+		switch in {
+		case "path":
+			for i, param := range match.params {
+				if param == name {
+					raw = []string{values[i]}
+				}
+			}
+		case "query":
+			raw = r.URL.Query()[name]
+		case "header":
+			raw = r.Header.Values(name)
+		case "body":
+			bodyParam = p
+			continue
+		default:
+			continue // Cookies and form data are not validated
+		}
+
+		where := fmt.Sprintf("%s parameter %q", in, name)
+		if len(raw) == 0 {
+			if required || in == "path" {
+				violations = append(violations, where+" is required")
+			}
+			continue
+		}
+		for _, s := range raw {
+			value, err := v.spec.coerce(s, schema)
+			if err != nil {
+				violations = append(violations, fmt.Sprintf("%s: %v", where, err))
+				continue
+			}
+			violations = append(violations, v.spec.check(value, schema, where, 0)...)
+		}
+	}
+
+	return append(violations, v.validateBody(r, match, bodyParam)...)
+}
+
+// parameters merges the path item's parameters with the operation's, which
+// take precedence.
+func (v *Validator) parameters(o *operation) []map[string]any {
+	var params []map[string]any
+	index := map[string]int{}
+	for _, source := range []map[string]any{o.item, o.op} {
+		list, _ := source["parameters"].([]any)
+		for _, raw := range list {
+			p := v.spec.resolveMap(asMap(raw))
+			if p == nil {
+				continue
+			}
+			key := fmt.Sprint(p["in"], " ", p["name"])
+			if i, ok := index[key]; ok {
+				params[i] = p
+				continue
+			}
+			index[key] = len(params)
+			params = append(params, p)
+		}
+	}
+	return params
+}
+
+// paramSchema is the schema of a parameter: its own schema in OpenAPI 3, or
+// the parameter itself in Swagger 2.
+func (v *Validator) paramSchema(p map[string]any) any {
+	if schema, ok := p["schema"]; ok {
+		return schema
+	}
+	return p
+}
+
+// validateBody checks the request body against the operation's request body
+// (OpenAPI 3) or body parameter (Swagger 2). Only JSON bodies are validated
+// against schemas.
+func (v *Validator) validateBody(r *http.Request, o *operation, bodyParam map[string]any) []string {
+	body := []byte{}
+	if r.Body != nil {
+		body, _ = io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	var required bool
+	var schema any
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if v.spec.swagger() {
+		if bodyParam == nil {
+			return nil
+		}
+		required, _ = bodyParam["required"].(bool)
+		schema = bodyParam["schema"]
+	} else {
+		rb := v.spec.resolveMap(asMap(o.op["requestBody"]))
+		if rb == nil {
+			return nil
+		}
+		required, _ = rb["required"].(bool)
+		content, _ := rb["content"].(map[string]any)
+		if len(body) > 0 && len(content) > 0 {
+			media, ok := mediaFor(content, mediaType)
+			if !ok {
+				return []string{fmt.Sprintf("content type %q is not accepted", mediaType)}
+			}
+			schema = asMap(media)["schema"]
+		}
+	}
+
+	if len(body) == 0 {
+		if required {
+			return []string{"request body is required"}
+		}
+		return nil
+	}
+	if schema == nil || (mediaType != "" && !isJSON(mediaType)) {
+		return nil
+	}
+	var doc any
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return []string{"request body is not valid JSON"}
+	}
+	return v.spec.check(doc, schema, "body", 0)
+}
+
+// mediaFor finds the content entry for a media type, trying exact matches
+// before wildcards such as "application/*" and "*/*".
+func mediaFor(content map[string]any, mediaType string) (any, bool) {
+	if mediaType == "" {
+		mediaType = "application/json"
+	}
+	major, _, _ := strings.Cut(mediaType, "/")
+	for _, candidate := range []string{mediaType, major + "/*", "*/*"} {
+		if media, ok := content[candidate]; ok {
+			return media, true
+		}
+	}
+	return nil, false
+}
+
+// coerce converts a parameter's text into the JSON value its schema describes.
+func (s *Spec) coerce(raw string, schema any) (any, error) {
+	sc := s.resolveMap(asMap(schema))
+	switch schemaType(sc) {
+	case "integer":
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an integer", raw)
+		}
+		return float64(n), nil
+	case "number":
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", raw)
+		}
+		return f, nil
+	case "boolean":
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a boolean", raw)
+		}
+		return b, nil
+	case "array":
+		var items []any
+		for _, part := range strings.Split(raw, ",") {
+			item, err := s.coerce(part, sc["items"])
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	}
+	return raw, nil
+}
+
+// check validates a JSON value against a schema. where names the value in
+// the violations, e.g. body.items[0].name.
+func (s *Spec) check(value, schema any, where string, depth int) []string {
+	if depth > maxCheckDepth {
+		return nil // Schemas such as A: {allOf: [A]} would never end
+	}
+	sc := s.resolveMap(asMap(schema))
+	if len(sc) == 0 {
+		return nil
+	}
+
+	if all, ok := sc["allOf"].([]any); ok {
+		var violations []string
+		for _, part := range all {
+			violations = append(violations, s.check(value, part, where, depth+1)...)
+		}
+		return violations
+	}
+	for _, choice := range []string{"oneOf", "anyOf"} {
+		options, ok := sc[choice].([]any)
+		if !ok {
+			continue
+		}
+		passed := 0
+		for _, option := range options {
+			if len(s.check(value, option, where, depth+1)) == 0 {
+				passed++
+			}
+		}
+		if passed == 0 || (choice == "oneOf" && passed > 1) {
+			return []string{fmt.Sprintf("%s: does not match exactly one of its %d alternatives", where, len(options))}
+		}
+	}
+
+	if value == nil {
+		if nullable, _ := sc["nullable"].(bool); nullable || allowsNull(sc) || schemaType(sc) == "" {
+			return nil
+		}
+		return []string{fmt.Sprintf("%s: must not be null", where)}
+	}
+	if enum, ok := sc["enum"].([]any); ok && !inEnum(value, enum) {
+		return []string{fmt.Sprintf("%s: %s is not one of the allowed values", where, compact(value))}
+	}
+
+	expected := schemaType(sc)
+	if expected != "" && !hasType(value, expected) {
+		return []string{fmt.Sprintf("%s: expected %s, got %s", where, expected, jsonType(value))}
+	}
+
+	var violations []string
+	switch value := value.(type) {
+	case string:
+		if n, ok := number(sc["minLength"]); ok && float64(len([]rune(value))) < n {
+			violations = append(violations, fmt.Sprintf("%s: shorter than %v characters", where, n))
+		}
+		if n, ok := number(sc["maxLength"]); ok && float64(len([]rune(value))) > n {
+			violations = append(violations, fmt.Sprintf("%s: longer than %v characters", where, n))
+		}
+		if pattern, ok := sc["pattern"].(string); ok {
+			if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(value) {
+				violations = append(violations, fmt.Sprintf("%s: does not match pattern %q", where, pattern))
+			}
+		}
+	case float64:
+		violations = append(violations, checkRange(value, sc, where)...)
+	case []any:
+		if n, ok := number(sc["minItems"]); ok && float64(len(value)) < n {
+			violations = append(violations, fmt.Sprintf("%s: fewer than %v items", where, n))
+		}
+		if n, ok := number(sc["maxItems"]); ok && float64(len(value)) > n {
+			violations = append(violations, fmt.Sprintf("%s: more than %v items", where, n))
+		}
+		for i, item := range value {
+			violations = append(violations, s.check(item, sc["items"], fmt.Sprintf("%s[%d]", where, i), depth+1)...)
+		}
+	case map[string]any:
+		required, _ := sc["required"].([]any)
+		for _, name := range required {
+			if _, ok := value[fmt.Sprint(name)]; !ok {
+				violations = append(violations, fmt.Sprintf("%s: missing required property %q", where, name))
+			}
+		}
+		props, _ := sc["properties"].(map[string]any)
+		for _, name := range keys(value) {
+			if prop, ok := props[name]; ok {
+				violations = append(violations, s.check(value[name], prop, where+"."+name, depth+1)...)
+				continue
+			}
+			switch extra := sc["additionalProperties"].(type) {
+			case bool:
+				if !extra {
+					violations = append(violations, fmt.Sprintf("%s: unexpected property %q", where, name))
+				}
+			case map[string]any:
+				violations = append(violations, s.check(value[name], extra, where+"."+name, depth+1)...)
+			}
+		}
+	}
+	return violations
+}
+
+// checkRange applies minimum and maximum, with OpenAPI 3.0's boolean and 3.1's
+// numeric forms of the exclusive bounds.
+func checkRange(value float64, sc map[string]any, where string) []string {
+	var violations []string
+	if min, ok := number(sc["minimum"]); ok {
+		if exclusive, _ := sc["exclusiveMinimum"].(bool); exclusive && value <= min {
+			violations = append(violations, fmt.Sprintf("%s: must be greater than %v", where, min))
+		} else if value < min {
+			violations = append(violations, fmt.Sprintf("%s: must be at least %v", where, min))
+		}
+	}
+	if min, ok := number(sc["exclusiveMinimum"]); ok && value <= min {
+		violations = append(violations, fmt.Sprintf("%s: must be greater than %v", where, min))
+	}
+	if max, ok := number(sc["maximum"]); ok {
+		if exclusive, _ := sc["exclusiveMaximum"].(bool); exclusive && value >= max {
+			violations = append(violations, fmt.Sprintf("%s: must be less than %v", where, max))
+		} else if value > max {
+			violations = append(violations, fmt.Sprintf("%s: must be at most %v", where, max))
+		}
+	}
+	if max, ok := number(sc["exclusiveMaximum"]); ok && value >= max {
+		violations = append(violations, fmt.Sprintf("%s: must be less than %v", where, max))
+	}
+	return violations
+}
+
+func allowsNull(sc map[string]any) bool {
+	types, _ := sc["type"].([]any)
+	for _, t := range types {
+		if t == "null" {
+			return true
+		}
+	}
+	return false
+}
+
+func hasType(value any, expected string) bool {
+	actual := jsonType(value)
+	return actual == expected || (expected == "number" && actual == "integer")
+}
+
+// jsonType names the JSON type of a decoded value; whole numbers are integers.
+func jsonType(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if value == float64(int64(value)) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// number reads a numeric schema keyword; YAML documents decode them as ints.
+func number(v any) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// inEnum compares values by their JSON encoding, so that e.g. YAML's 1 and JSON's 1.0 are equal.
+func inEnum(value any, enum []any) bool {
+	encoded := compact(value)
+	for _, e := range enum {
+		if n, ok := number(e); ok {
+			e = n
+		}
+		if compact(e) == encoded {
+			return true
+		}
+	}
+	return false
+}
+
+func compact(v any) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -0,0 +1,126 @@
+package openapi
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const petstore3 = `
+openapi: 3.0.3
+info: {title: Pets, version: "1"}
+servers: [{url: /v1}]
+paths:
+  /pets:
+    get:
+      parameters:
+        - {name: limit, in: query, schema: {type: integer, minimum: 1, maximum: 100}}
+        - {name: X-Api-Key, in: header, required: true, schema: {type: string}}
+      responses: {"200": {description: ok}}
+    post:
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              type: object
+              required: [name]
+              additionalProperties: false
+              properties:
+                name: {type: string, minLength: 1}
+                tags: {type: array, items: {type: string}, maxItems: 2}
+      responses: {"201": {description: created}}
+  /pets/{id}:
+    parameters:
+      - {name: id, in: path, required: true, schema: {type: integer}}
+    get:
+      responses: {"200": {description: ok}}
+  /pets/mine:
+    get:
+      responses: {"200": {description: ok}}
+`
+
+const petstore2 = `
+swagger: "2.0"
+info: {title: Pets, version: "1"}
+basePath: /v2
+paths:
+  /pets:
+    post:
+      parameters:
+        - {name: dry_run, in: query, type: boolean}
+        - name: pet
+          in: body
+          required: true
+          schema: {type: object, required: [name], properties: {name: {type: string}}}
+      responses: {"201": {description: created}}
+`
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name         string
+		spec         string
+		method, url  string
+		header, body string // header as "Name: value"
+		want         []string
+	}{
+		{"valid query and header", petstore3, "GET", "/v1/pets?limit=10", "X-Api-Key: k", "", nil},
+		{"query of the wrong type", petstore3, "GET", "/v1/pets?limit=ten", "X-Api-Key: k", "", []string{`query parameter "limit": "ten" is not an integer`}},
+		{"query out of range", petstore3, "GET", "/v1/pets?limit=500", "X-Api-Key: k", "", []string{`query parameter "limit": must be at most 100`}},
+		{"missing required header", petstore3, "GET", "/v1/pets", "", "", []string{`header parameter "X-Api-Key" is required`}},
+		{"path parameter", petstore3, "GET", "/v1/pets/7", "", "", nil},
+		{"path parameter of the wrong type", petstore3, "GET", "/v1/pets/seven", "", "", []string{`path parameter "id": "seven" is not an integer`}},
+		{"literal segment before a parameter", petstore3, "GET", "/v1/pets/mine", "", "", nil},
+		{"method not in the spec", petstore3, "DELETE", "/v1/pets/7", "", "", []string{"method DELETE is not allowed for /v1/pets/7"}},
+		{"path not in the spec", petstore3, "GET", "/health", "", "", nil},
+		{"path outside the base path", petstore3, "GET", "/pets", "", "", nil},
+		{"valid body", petstore3, "POST", "/v1/pets", "Content-Type: application/json", `{"name": "rex", "tags": ["dog"]}`, nil},
+		{"missing body", petstore3, "POST", "/v1/pets", "", "", []string{"request body is required"}},
+		{"body breaking the schema", petstore3, "POST", "/v1/pets", "Content-Type: application/json", `{"name": "", "tags": ["a", "b", 3], "age": 2}`, []string{
+			`body: unexpected property "age"`,
+			"body.name: shorter than 1 characters",
+			"body.tags: more than 2 items",
+			"body.tags[2]: expected string, got integer",
+		}},
+		{"body that is not JSON", petstore3, "POST", "/v1/pets", "Content-Type: application/json", `{name`, []string{"request body is not valid JSON"}},
+		{"body of another content type", petstore3, "POST", "/v1/pets", "Content-Type: text/plain", "rex", []string{`content type "text/plain" is not accepted`}},
+		{"Swagger body parameter", petstore2, "POST", "/v2/pets?dry_run=true", "", `{"name": "rex"}`, nil},
+		{"Swagger body breaking the schema", petstore2, "POST", "/v2/pets?dry_run=maybe", "", `{}`, []string{
+			`query parameter "dry_run": "maybe" is not a boolean`,
+			`body: missing required property "name"`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, err := Parse([]byte(tt.spec))
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			if name, value, ok := strings.Cut(tt.header, ": "); ok {
+				r.Header.Set(name, value)
+			}
+
+			got := spec.Validator().Validate(r)
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("got violations:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestValidateRestoresBody(t *testing.T) {
+	spec, err := Parse([]byte(petstore3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := `{"name": "rex"}`
+	r := httptest.NewRequest("POST", "/v1/pets", strings.NewReader(body))
+	spec.Validator().Validate(r)
+
+	rest, err := io.ReadAll(r.Body)
+	if err != nil || string(rest) != body {
+		t.Errorf("later handlers read %q, %v; want the body intact", rest, err)
+	}
+}
@@ -0,0 +1,162 @@
+package postman
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"mi6/internal/db"
+)
+
+// Export builds a collection with a request for each of an agent's paths,
+// aimed at the agent on localhost through the {{baseUrl}} variable. The
+// path's responses are attached as saved examples, and its group becomes
+// the folder it is filed in.
+func Export(a *db.Agent, paths []db.AgentPath) *Collection {
+	c := &Collection{
+		Info:     Info{Name: a.Name, Schema: SchemaURL},
+		Variable: []KeyValue{{Key: "baseUrl", Value: "http://localhost:" + a.Port}},
+	}
+
+	sorted := append([]db.AgentPath(nil), paths...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Group != sorted[j].Group {
+			return sorted[i].Group < sorted[j].Group
+		}
+		return sorted[i].Path < sorted[j].Path
+	})
+
+	root := &Item{}
+	for _, p := range sorted {
+		folder := root
+		if p.Group != "" {
+			for _, name := range strings.Split(p.Group, "/") {
+				folder = child(folder, name)
+			}
+		}
+		folder.Item = append(folder.Item, exportPath(p))
+	}
+	c.Item = root.Item
+	if c.Item == nil {
+		c.Item = []Item{}
+	}
+	return c
+}
+
+// child finds or creates the folder of that name within parent.
+func child(parent *Item, name string) *Item {
+	for i := range parent.Item {
+		if parent.Item[i].Request == nil && parent.Item[i].Name == name {
+			return &parent.Item[i]
+		}
+	}
+	parent.Item = append(parent.Item, Item{Name: name, Item: []Item{}})
+	return &parent.Item[len(parent.Item)-1]
+}
+
+func exportPath(p db.AgentPath) Item {
+	method := p.Method
+	if method == db.MethodAny {
+		method = http.MethodGet
+	}
+	request := &Request{Method: method, Header: []KeyValue{}, URL: exportURL(p.Path, nil)}
+	item := Item{Name: method + " " + p.Path, Request: request}
+
+	if len(p.Sequence) > 0 {
+		for i, m := range p.Sequence {
+			item.Response = append(item.Response, exportResponse(fmt.Sprintf("Sequence #%d", i+1), request, m))
+		}
+	} else {
+		item.Response = append(item.Response, exportResponse("Default", request, p.MockResponse))
+	}
+
+	for i, v := range p.Variants {
+		name := v.Name
+		if name == "" {
+			name = fmt.Sprintf("Variant #%d", i+1)
+		}
+		original := &Request{Method: method, Header: []KeyValue{}}
+		var query url.Values
+		for _, c := range v.Conditions {
+			if c.Equals == nil {
+				continue
+			}
+			switch c.Source {
+			case db.SourceQuery:
+				if query == nil {
+					query = url.Values{}
+				}
+				query.Add(c.Key, *c.Equals)
+			case db.SourceHeader:
+				original.Header = append(original.Header, KeyValue{Key: c.Key, Value: *c.Equals})
+			}
+		}
+		original.URL = exportURL(p.Path, query)
+		item.Response = append(item.Response, exportResponse(name, original, v.MockResponse))
+	}
+	return item
+}
+
+// exportURL turns a chi pattern into a Postman URL: {id} and {id:[0-9]+}
+// become the path variable :id.
+func exportURL(pattern string, query url.Values) URL {
+	u := URL{Host: []string{"{{baseUrl}}"}}
+	for _, segment := range strings.Split(strings.TrimPrefix(pattern, "/"), "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			name, _, _ := strings.Cut(segment[1:len(segment)-1], ":")
+			u.Variable = append(u.Variable, KeyValue{Key: name})
+			segment = ":" + name
+		}
+		u.Path = append(u.Path, segment)
+	}
+	u.Raw = "{{baseUrl}}/" + strings.Join(u.Path, "/")
+
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range query[k] {
+			u.Query = append(u.Query, KeyValue{Key: k, Value: v})
+		}
+	}
+	if len(query) > 0 {
+		u.Raw += "?" + query.Encode()
+	}
+	return u
+}
+
+func exportResponse(name string, original *Request, m db.MockResponse) Response {
+	status := m.StatusCode
+	if status == 0 {
+		status = http.StatusOK
+	}
+	body := m.Response
+	if m.Encoding == db.EncodingBase64 {
+		if decoded, err := base64.StdEncoding.DecodeString(body); err == nil {
+			body = string(decoded)
+		}
+	}
+
+	r := Response{
+		Name: name, OriginalRequest: original,
+		Status: http.StatusText(status), Code: status,
+		Header: []KeyValue{}, Body: body,
+	}
+	names := make([]string, 0, len(m.Headers))
+	for k := range m.Headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		r.Header = append(r.Header, KeyValue{Key: k, Value: m.Headers[k]})
+		if strings.EqualFold(k, "Content-Type") && strings.Contains(m.Headers[k], "json") {
+			r.PreviewLanguage = "json"
+		}
+	}
+	return r
+}
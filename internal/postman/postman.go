@@ -0,0 +1,184 @@
+// Package postman reads and writes Postman Collection v2.1 documents.
+package postman
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// SchemaURL identifies the v2.1 collection format.
+const SchemaURL = "https://schema.getpostman.com/json/collection/v2.1.0/collection.json"
+
+// Collection is a Postman collection: a tree of folders and requests.
+type Collection struct {
+	Info     Info       `json:"info"`
+	Item     []Item     `json:"item"`
+	Variable []KeyValue `json:"variable,omitempty"`
+}
+
+// Parse reads a v2.0 or v2.1 collection.
+func Parse(data []byte) (*Collection, error) {
+	var c Collection
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("invalid Postman collection: %w", err)
+	}
+	if c.Info.Schema != "" && !strings.Contains(c.Info.Schema, "/v2.") {
+		return nil, fmt.Errorf("unsupported Postman collection format %s", c.Info.Schema)
+	}
+	return &c, nil
+}
+
+// ParseEnvironment reads an exported environment.
+func ParseEnvironment(data []byte) (*Environment, error) {
+	var env Environment
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, fmt.Errorf("invalid Postman environment: %w", err)
+	}
+	return &env, nil
+}
+
+// Info names the collection and the format it is written in.
+type Info struct {
+	PostmanID   string `json:"_postman_id,omitempty"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Schema      string `json:"schema"`
+}
+
+// Item is either a folder, holding more items, or a request with its saved
+// example responses.
+type Item struct {
+	Name     string     `json:"name"`
+	Item     []Item     `json:"item,omitempty"`
+	Request  *Request   `json:"request,omitempty"`
+	Response []Response `json:"response,omitempty"`
+}
+
+// Request is a saved request.
+type Request struct {
+	Method string     `json:"method"`
+	Header []KeyValue `json:"header"`
+	Body   *Body      `json:"body,omitempty"`
+	URL    URL        `json:"url"`
+}
+
+// UnmarshalJSON also accepts the shorthand of a request given as its URL.
+func (r *Request) UnmarshalJSON(data []byte) error {
+	var raw string
+	if json.Unmarshal(data, &raw) == nil {
+		*r = Request{Method: "GET", URL: URL{Raw: raw}}
+		return nil
+	}
+	type plain Request
+	return json.Unmarshal(data, (*plain)(r))
+}
+
+// URL is a request URL, both as typed (Raw) and split into its parts.
+type URL struct {
+	Raw      string     `json:"raw"`
+	Host     []string   `json:"host,omitempty"`
+	Path     []string   `json:"path,omitempty"`
+	Query    []KeyValue `json:"query,omitempty"`
+	Variable []KeyValue `json:"variable,omitempty"`
+}
+
+// UnmarshalJSON also accepts the shorthand of a URL given as a string.
+func (u *URL) UnmarshalJSON(data []byte) error {
+	var raw string
+	if json.Unmarshal(data, &raw) == nil {
+		*u = URL{Raw: raw}
+		return nil
+	}
+	type plain URL
+	return json.Unmarshal(data, (*plain)(u))
+}
+
+// Body is a request body; only raw bodies are kept.
+type Body struct {
+	Mode string `json:"mode"`
+	Raw  string `json:"raw,omitempty"`
+}
+
+// Response is an example response saved with a request.
+type Response struct {
+	Name            string     `json:"name"`
+	OriginalRequest *Request   `json:"originalRequest,omitempty"`
+	Status          string     `json:"status,omitempty"`
+	Code            int        `json:"code"`
+	Header          []KeyValue `json:"header"`
+	Body            string     `json:"body"`
+	PreviewLanguage string     `json:"_postman_previewlanguage,omitempty"`
+}
+
+// KeyValue is a header, query parameter or variable.
+type KeyValue struct {
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	Disabled bool   `json:"disabled,omitempty"`
+}
+
+// Environment is a Postman environment file.
+type Environment struct {
+	Name   string `json:"name"`
+	Values []struct {
+		Key     string `json:"key"`
+		Value   string `json:"value"`
+		Enabled *bool  `json:"enabled"` // Absent means enabled
+	} `json:"values"`
+}
+
+// Walk calls fn for every request of the collection, with the names of the
+// folders it is in joined by "/".
+func (c *Collection) Walk(fn func(folder string, item Item)) {
+	var walk func(folder string, items []Item)
+	walk = func(folder string, items []Item) {
+		for _, item := range items {
+			if item.Request == nil {
+				sub := item.Name
+				if folder != "" {
+					sub = folder + "/" + item.Name
+				}
+				walk(sub, item.Item)
+				continue
+			}
+			fn(folder, item)
+		}
+	}
+	walk("", c.Item)
+}
+
+// Variables are the values {{name}} placeholders are replaced with.
+type Variables map[string]string
+
+// Variables collects the collection's variables, overridden by those of the
+// environment, if any.
+func (c *Collection) Variables(env *Environment) Variables {
+	vars := Variables{}
+	for _, v := range c.Variable {
+		if !v.Disabled {
+			vars[v.Key] = v.Value
+		}
+	}
+	if env != nil {
+		for _, v := range env.Values {
+			if v.Enabled == nil || *v.Enabled {
+				vars[v.Key] = v.Value
+			}
+		}
+	}
+	return vars
+}
+
+var placeholder = regexp.MustCompile(`\{\{([^{}]+)\}\}`)
+
+// Resolve replaces the known {{name}} placeholders in s; unknown ones are kept.
+func (vars Variables) Resolve(s string) string {
+	return placeholder.ReplaceAllStringFunc(s, func(m string) string {
+		if v, ok := vars[strings.TrimSpace(m[2:len(m)-2])]; ok {
+			return v
+		}
+		return m
+	})
+}
@@ -4,12 +4,14 @@ import (
 	"log"
 	"net/http"
 
+	"mi6/internal/config"
 	"mi6/internal/db"
 	"mi6/web/template" // Import your templ components
 )
 
 type Handlers struct {
-	Repo db.AgentRepository
+	Repo    db.AgentRepository
+	Watcher *config.Watcher // Set when a directory of agent documents is watched
 }
 
 func NewHandlers(repo db.AgentRepository) *Handlers {
@@ -25,7 +27,21 @@ func (h *Handlers) DashboardPage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Render the main layout, injecting the list of agents
-	template.Dashboard(agents).Render(r.Context(), w)
+	template.Dashboard(agents, h.watchStatus()).Render(r.Context(), w)
+}
+
+// watchStatus returns the state of the watched directory, or nil when none is.
+func (h *Handlers) watchStatus() *config.WatchStatus {
+	if h.Watcher == nil {
+		return nil
+	}
+	status := h.Watcher.Status()
+	return &status
+}
+
+// WatchFragment handles HTMX requests to refresh the watch banner (partial HTML render)
+func (h *Handlers) WatchFragment(w http.ResponseWriter, r *http.Request) {
+	template.WatchBanner(h.watchStatus()).Render(r.Context(), w)
 }
 
 // AgentTableFragment handles HTMX requests to refresh the agent table (partial HTML render)
@@ -11,6 +11,7 @@ import "github.com/a-h/templ"
 import templruntime "github.com/a-h/templ/runtime"
 
 import (
+	"mi6/internal/config"
 	"mi6/internal/db" // Import the db package to use the Agent struct
 )
 
@@ -43,7 +44,7 @@ func Layout(title string) templ.Component {
 		var templ_7745c5c3_Var2 string
 		templ_7745c5c3_Var2, templ_7745c5c3_Err = templ.JoinStringErrs(title)
 		if templ_7745c5c3_Err != nil {
-			return templ.Error{Err: templ_7745c5c3_Err, FileName: `layout.templ`, Line: 15, Col: 22}
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `layout.templ`, Line: 16, Col: 22}
 		}
 		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var2))
 		if templ_7745c5c3_Err != nil {
@@ -66,7 +67,8 @@ func Layout(title string) templ.Component {
 }
 
 // Dashboard component uses the Layout and provides the main dashboard content.
-func Dashboard(agents []db.Agent) templ.Component {
+// watch is the state of the watched directory of agent documents, if any.
+func Dashboard(agents []db.Agent, watch *config.WatchStatus) templ.Component {
 	return templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
 		templ_7745c5c3_W, ctx := templ_7745c5c3_Input.Writer, templ_7745c5c3_Input.Context
 		if templ_7745c5c3_CtxErr := ctx.Err(); templ_7745c5c3_CtxErr != nil {
@@ -99,7 +101,25 @@ func Dashboard(agents []db.Agent) templ.Component {
 				}()
 			}
 			ctx = templ.InitializeContext(ctx)
-			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 4, "<h1 class=\"text-4xl font-bold mb-6 text-primary\">MI6 Agent Registry</h1><div class=\"card bg-base-100 shadow-xl p-6\"><h2 class=\"text-2xl font-semibold mb-4 text-secondary\">Active Agents</h2><div id=\"agent-list-target\" hx-get=\"/ui/agents\" hx-trigger=\"load, every 5s\" hx-swap=\"innerHTML\">")
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 4, "<h1 class=\"text-4xl font-bold mb-6 text-primary\">MI6 Agent Registry</h1>")
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+			if watch != nil {
+				templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 5, " <div id=\"watch-target\" hx-get=\"/ui/watch\" hx-trigger=\"every 5s\" hx-swap=\"innerHTML\">")
+				if templ_7745c5c3_Err != nil {
+					return templ_7745c5c3_Err
+				}
+				templ_7745c5c3_Err = WatchBanner(watch).Render(ctx, templ_7745c5c3_Buffer)
+				if templ_7745c5c3_Err != nil {
+					return templ_7745c5c3_Err
+				}
+				templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 6, "</div>")
+				if templ_7745c5c3_Err != nil {
+					return templ_7745c5c3_Err
+				}
+			}
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 7, " <div class=\"card bg-base-100 shadow-xl p-6\"><h2 class=\"text-2xl font-semibold mb-4 text-secondary\">Active Agents</h2><div id=\"agent-list-target\" hx-get=\"/ui/agents\" hx-trigger=\"load, every 5s\" hx-swap=\"innerHTML\">")
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}
@@ -107,7 +127,7 @@ func Dashboard(agents []db.Agent) templ.Component {
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}
-			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 5, "</div></div><div class=\"mt-8\"><h2 class=\"text-2xl font-semibold mb-4 text-secondary\">Create New Agent</h2><p>Use the API endpoint to create new agents for now: POST /agents</p></div>")
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 8, "</div></div><div class=\"mt-8\"><h2 class=\"text-2xl font-semibold mb-4 text-secondary\">Create New Agent</h2><p>Use the API endpoint to create new agents for now: POST /agents</p></div>")
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}